@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/audit"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+	"go.uber.org/zap"
+)
+
+// adminHandlers serves the gateway admin API on its own listener
+type adminHandlers struct {
+	routes  *routeTable
+	limiter *rateLimiter
+	audit   *audit.Writer // nil when no audit database is configured
+	logger  *zap.Logger
+}
+
+// RouteView is the admin API representation of a registered route
+type RouteView struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	PathBase     string         `json:"path_base"`
+	Methods      []string       `json:"methods"`
+	CacheTTL     string         `json:"cache_ttl"`
+	MaxBodyBytes int64          `json:"max_body_bytes"`
+	Mode         string         `json:"mode"`
+	InFlight     int64          `json:"in_flight"`
+	Upstreams    []UpstreamView `json:"upstreams"`
+	Rules        []MatchRule    `json:"rules,omitempty"`
+}
+
+// UpstreamView is the admin API representation of one upstream variant
+type UpstreamView struct {
+	Variant string          `json:"variant"`
+	URL     string          `json:"url"`
+	Weight  int             `json:"weight"`
+	Health  UpstreamHealth  `json:"health"`
+	Breaker BreakerSnapshot `json:"circuit_breaker"`
+}
+
+func newRouteView(state *routeState) RouteView {
+	view := RouteView{
+		ID:           state.ID,
+		Name:         state.Route.Name,
+		PathBase:     state.Route.PathBase,
+		Methods:      state.Route.Methods,
+		CacheTTL:     state.Route.CacheTTL.String(),
+		MaxBodyBytes: state.Route.MaxBodyBytes,
+		Mode:         state.Mode(),
+		InFlight:     state.inFlight.Load(),
+		Rules:        state.Route.Rules,
+	}
+	for _, upstream := range state.upstreams {
+		view.Upstreams = append(view.Upstreams, UpstreamView{
+			Variant: upstream.Variant,
+			URL:     upstream.URL,
+			Weight:  upstream.Weight,
+			Health:  upstream.Health(),
+			Breaker: upstream.Breaker.Snapshot(),
+		})
+	}
+	return view
+}
+
+// adminAuthMiddleware requires the static admin bearer token, independent of end-user authentication
+func adminAuthMiddleware(token string, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		presented := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if presented == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			logger.Warn("Rejected admin API request", zap.String("path", c.Request.URL.Path), zap.String("remote_addr", c.ClientIP()))
+			problem.Abort(c, problem.CodeUnauthorized, "Invalid admin token")
+			return
+		}
+		c.Next()
+	}
+}
+
+// newAdminRouter builds the admin API engine
+func newAdminRouter(h *adminHandlers, token string) *gin.Engine {
+	router := gin.New()
+	router.NoRoute(problem.NoRoute)
+	router.Use(requestid.Middleware())
+	router.Use(problem.Recovery())
+	router.Use(adminAuthMiddleware(token, h.logger))
+
+	admin := router.Group("/admin")
+	{
+		admin.GET("/routes", h.listRoutes)
+		admin.GET("/routes/:id", h.getRoute)
+		admin.POST("/routes/:id/drain", h.drainRoute)
+		admin.POST("/routes/:id/disable", h.setRouteMode(routeDisabled, "disable_route"))
+		admin.POST("/routes/:id/enable", h.setRouteMode(routeActive, "enable_route"))
+		admin.GET("/ratelimit", h.getRateLimit)
+	}
+	return router
+}
+
+// listRoutes handles GET /admin/routes
+func (h *adminHandlers) listRoutes(c *gin.Context) {
+	views := make([]RouteView, 0, len(h.routes.All()))
+	for _, state := range h.routes.All() {
+		views = append(views, newRouteView(state))
+	}
+	h.recordAdminAction(c, "list_routes", "*", "success", "")
+	c.JSON(http.StatusOK, gin.H{"items": views})
+}
+
+// getRoute handles GET /admin/routes/:id
+func (h *adminHandlers) getRoute(c *gin.Context) {
+	state, ok := h.routes.Get(c.Param("id"))
+	if !ok {
+		h.recordAdminAction(c, "get_route", c.Param("id"), "failure", "route not found")
+		problem.Abort(c, problem.CodeNotFound, "Route not found")
+		return
+	}
+	h.recordAdminAction(c, "get_route", state.ID, "success", "")
+	c.JSON(http.StatusOK, newRouteView(state))
+}
+
+// drainRoute handles POST /admin/routes/:id/drain. New requests are rejected while in-flight
+// requests finish; with ?wait=<duration> the call blocks until the route is idle or the wait expires
+func (h *adminHandlers) drainRoute(c *gin.Context) {
+	state, ok := h.routes.Get(c.Param("id"))
+	if !ok {
+		h.recordAdminAction(c, "drain_route", c.Param("id"), "failure", "route not found")
+		problem.Abort(c, problem.CodeNotFound, "Route not found")
+		return
+	}
+
+	var wait time.Duration
+	if waitParam := c.Query("wait"); waitParam != "" {
+		var err error
+		if wait, err = time.ParseDuration(waitParam); err != nil || wait < 0 {
+			problem.Abort(c, problem.CodeBadRequest, "Invalid wait duration")
+			return
+		}
+	}
+
+	state.SetMode(routeDraining)
+	h.logger.Info("Route draining", zap.String("route", state.Route.Name), zap.Int64("in_flight", state.inFlight.Load()))
+
+	if wait > 0 {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+		defer cancel()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+	waitLoop:
+		for state.inFlight.Load() > 0 {
+			select {
+			case <-ctx.Done():
+				break waitLoop
+			case <-ticker.C:
+			}
+		}
+	}
+
+	drained := state.inFlight.Load() == 0
+	h.recordAdminAction(c, "drain_route", state.ID, "success", "")
+	c.JSON(http.StatusOK, gin.H{"route": newRouteView(state), "drained": drained})
+}
+
+// setRouteMode returns a handler that switches a route to the given mode
+func (h *adminHandlers) setRouteMode(mode, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, ok := h.routes.Get(c.Param("id"))
+		if !ok {
+			h.recordAdminAction(c, action, c.Param("id"), "failure", "route not found")
+			problem.Abort(c, problem.CodeNotFound, "Route not found")
+			return
+		}
+
+		previous := state.Mode()
+		state.SetMode(mode)
+		h.logger.Info("Route mode changed", zap.String("route", state.Route.Name), zap.String("from", previous), zap.String("to", mode))
+		h.recordAdminAction(c, action, state.ID, "success", "mode changed from "+previous+" to "+mode)
+		c.JSON(http.StatusOK, newRouteView(state))
+	}
+}
+
+// getRateLimit handles GET /admin/ratelimit
+func (h *adminHandlers) getRateLimit(c *gin.Context) {
+	h.recordAdminAction(c, "get_ratelimit", "global", "success", "")
+	c.JSON(http.StatusOK, h.limiter.Usage())
+}
+
+// recordAdminAction queues the admin action for audit_logs, it is only logged when no database is configured
+func (h *adminHandlers) recordAdminAction(c *gin.Context, action, resourceName, status, message string) {
+	actor := c.GetHeader("X-Admin-User")
+	if actor == "" {
+		actor = "admin-token"
+	}
+
+	h.logger.Info("Admin action",
+		zap.String("action", action),
+		zap.String("resource", resourceName),
+		zap.String("status", status),
+		zap.String("actor", actor),
+		zap.String("remote_addr", c.ClientIP()),
+	)
+	if h.audit == nil {
+		return
+	}
+
+	requestData, _ := json.Marshal(map[string]string{
+		"actor":  actor,
+		"method": c.Request.Method,
+		"path":   c.Request.URL.RequestURI(),
+	})
+
+	h.audit.Record(audit.Event{
+		Action:       "admin." + action,
+		ResourceType: "gateway_route",
+		ResourceName: resourceName,
+		Namespace:    "gateway",
+		RequestData:  string(requestData),
+		Status:       status,
+		Message:      message,
+		ClientIP:     c.ClientIP(),
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/audit"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+)
+
+// auditActions maps audited methods to the action stored in audit_logs
+var auditActions = map[string]string{
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "patch",
+	http.MethodDelete: "delete",
+}
+
+// auditMiddleware records every mutating request on a proxied route once the response status is
+// known. The event is queued on the writer, so the request never waits on the database.
+func auditMiddleware(route ServiceRoute, writer *audit.Writer, maxBodyBytes int) gin.HandlerFunc {
+	resourceType := path.Base(route.PathBase)
+	return func(c *gin.Context) {
+		action, audited := auditActions[c.Request.Method]
+		if !audited || writer == nil {
+			c.Next()
+			return
+		}
+
+		body, size := captureBody(c.Request, maxBodyBytes)
+		c.Next()
+
+		// Fields used to identify the resource are read from the body before redaction
+		var fields struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		}
+		if int64(len(body)) == size {
+			json.Unmarshal(body, &fields)
+		}
+
+		resourceName, _, _ := strings.Cut(strings.TrimPrefix(c.Param("proxyPath"), "/"), "/")
+		if resourceName == "" {
+			resourceName = fields.Name
+		}
+		namespace := c.Query("namespace")
+		if namespace == "" {
+			namespace = fields.Namespace
+		}
+
+		subject := auditSubject(c)
+		status := c.Writer.Status()
+		outcome := "success"
+		if status >= http.StatusBadRequest {
+			outcome = "failure"
+		}
+
+		requestData, _ := json.Marshal(map[string]interface{}{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"request_id": requestid.Get(c),
+			"subject":    subject,
+			"body":       audit.RedactJSON(body, size),
+		})
+
+		userID, _ := strconv.Atoi(subject) // Service accounts have no numeric user ID and are stored as NULL
+		writer.Record(audit.Event{
+			UserID:       userID,
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceName: resourceName,
+			Namespace:    namespace,
+			RequestData:  string(requestData),
+			Status:       outcome,
+			Message:      fmt.Sprintf("%d %s", status, http.StatusText(status)),
+			ClientIP:     c.ClientIP(),
+		})
+	}
+}
+
+// captureBody reads up to max+1 bytes of the request body for the audit record and puts them back
+// in front of the unread remainder, so the proxy still streams the complete body. size is the
+// body length when known, otherwise a lower bound.
+func captureBody(req *http.Request, max int) ([]byte, int64) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, 0
+	}
+	prefix, err := io.ReadAll(io.LimitReader(req.Body, int64(max)+1))
+	req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(prefix), req.Body), Closer: req.Body}
+	if err != nil {
+		return nil, req.ContentLength
+	}
+
+	size := int64(len(prefix))
+	if req.ContentLength > size {
+		size = req.ContentLength
+	}
+	if len(prefix) > max {
+		prefix = prefix[:max]
+	}
+	return prefix, size
+}
+
+// readCloser pairs a replacement reader with the original body's Close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// auditSubject returns the authenticated subject set by authMiddleware
+func auditSubject(c *gin.Context) string {
+	if user, exists := c.Get("user"); exists {
+		if claims, ok := user.(map[string]interface{}); ok {
+			if sub, ok := claims["sub"].(string); ok {
+				return sub
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops proxying to an upstream after consecutive failures and
+// lets a single probe request through once the open timeout has elapsed
+type circuitBreaker struct {
+	mu               sync.Mutex
+	state            string
+	failures         int
+	failureThreshold int
+	openTimeout      time.Duration
+	openedAt         time.Time
+	probeInFlight    bool
+}
+
+// BreakerSnapshot is the externally visible state of a circuit breaker
+type BreakerSnapshot struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+}
+
+func newCircuitBreaker(failureThreshold int, openTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		state:            breakerClosed,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+	}
+}
+
+// Allow reports whether a request may be sent to the upstream
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probeInFlight = true
+		return true
+	case breakerHalfOpen:
+		if b.probeInFlight {
+			return false
+		}
+		b.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the breaker and resets the failure count
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+	b.probeInFlight = false
+}
+
+// RecordFailure counts a failed upstream call and opens the breaker once the threshold is reached
+func (b *circuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probeInFlight = false
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends a call that produced no outcome, such as one the client cancelled, so that a
+// half-open breaker lets the next request probe instead of waiting for this one forever
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probeInFlight = false
+	}
+}
+
+// Snapshot returns the current breaker state
+func (b *circuitBreaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := BreakerSnapshot{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != breakerClosed {
+		snapshot.OpenedAt = b.openedAt
+	}
+	return snapshot
+}
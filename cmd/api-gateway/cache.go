@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCachedBodyBytes caps how much of an upstream response is buffered for ETag computation and caching
+const maxCachedBodyBytes = 1 << 20
+
+// cacheEntry is a stored upstream GET response
+type cacheEntry struct {
+	group     string
+	status    int
+	header    http.Header
+	body      []byte
+	etag      string
+	expiresAt time.Time
+}
+
+// responseCache holds per-user GET responses and tracks hit/miss metrics
+type responseCache struct {
+	mu         sync.RWMutex
+	entries    map[string]*cacheEntry
+	maxEntries int
+
+	hitCount  atomic.Uint64
+	missCount atomic.Uint64
+	requests  *prometheus.CounterVec
+}
+
+// newResponseCache creates a cache and registers its metrics with the given registry
+func newResponseCache(maxEntries int, registry *prometheus.Registry) *responseCache {
+	rc := &responseCache{
+		entries:    make(map[string]*cacheEntry),
+		maxEntries: maxEntries,
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gateway_cache_requests_total",
+				Help: "Number of cacheable GET requests by route and cache result",
+			},
+			[]string{"route", "result"},
+		),
+	}
+
+	hitRatio := prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "gateway_cache_hit_ratio",
+			Help: "Ratio of cache hits to cacheable GET requests since startup",
+		},
+		rc.hitRatio,
+	)
+	entries := prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "gateway_cache_entries",
+			Help: "Number of responses currently held in the gateway cache",
+		},
+		func() float64 {
+			rc.mu.RLock()
+			defer rc.mu.RUnlock()
+			return float64(len(rc.entries))
+		},
+	)
+
+	registry.MustRegister(rc.requests, hitRatio, entries)
+	return rc
+}
+
+func (rc *responseCache) hitRatio() float64 {
+	hits := rc.hitCount.Load()
+	total := hits + rc.missCount.Load()
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+func (rc *responseCache) get(key string) (*cacheEntry, bool) {
+	rc.mu.RLock()
+	entry, ok := rc.entries[key]
+	rc.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		rc.mu.Lock()
+		delete(rc.entries, key)
+		rc.mu.Unlock()
+		return nil, false
+	}
+	return entry, true
+}
+
+func (rc *responseCache) set(key string, entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, exists := rc.entries[key]; !exists && len(rc.entries) >= rc.maxEntries {
+		rc.evictLocked()
+	}
+	rc.entries[key] = entry
+}
+
+// evictLocked drops expired entries, or an arbitrary one if nothing has expired yet
+func (rc *responseCache) evictLocked() {
+	now := time.Now()
+	for key, entry := range rc.entries {
+		if now.After(entry.expiresAt) {
+			delete(rc.entries, key)
+		}
+	}
+	if len(rc.entries) < rc.maxEntries {
+		return
+	}
+	for key := range rc.entries {
+		delete(rc.entries, key)
+		return
+	}
+}
+
+// invalidate removes every cached response of a cache group. A mutation can change what any route
+// of the group returns, e.g. an import or an approved promotion changes config listings, resolved
+// overlays and exports alike, so nothing narrower is safe.
+func (rc *responseCache) invalidate(group string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for key, entry := range rc.entries {
+		if entry.group == group {
+			delete(rc.entries, key)
+		}
+	}
+}
+
+// cacheKey scopes a cached response to the calling user, the selected upstream variant, the
+// negotiated encoding (upstreams may compress their own responses) and the full request URI
+func cacheKey(c *gin.Context) string {
+	return userKey(c) + "|" + c.GetString("variant") + "|" + c.GetString(encodingContextKey) + "|" + c.Request.URL.RequestURI()
+}
+
+// userKey identifies the caller for per-user caching, preferring the validated subject claim
+func userKey(c *gin.Context) string {
+	if sub := subjectFromContext(c); sub != "" {
+		return "sub:" + sub
+	}
+	if authz := c.GetHeader("Authorization"); authz != "" {
+		sum := sha256.Sum256([]byte(authz))
+		return "token:" + hex.EncodeToString(sum[:8])
+	}
+	return "anonymous"
+}
+
+// computeETag derives a strong ETag from the response body
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison used for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	target := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == target {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter holds back the upstream response so the gateway can compute an ETag
+// and decide between 304, a cached copy, or the full body
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	wrote    bool // A status or body was written, a handler that gave up without a response leaves it unset
+	overflow bool // Buffering stopped, the body is too large or an event stream
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.wrote = true
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	// Event streams are never buffered, each event must reach the client as it is written
+	if !w.overflow && isEventStream(w.Header().Get("Content-Type")) {
+		if err := w.passThrough(); err != nil {
+			return 0, err
+		}
+	}
+	if w.overflow {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.body.Len()+len(data) > maxCachedBodyBytes {
+		// Too large to buffer, stream the rest straight through
+		if err := w.passThrough(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+// passThrough stops buffering, writing the status and the body so far to the client
+func (w *bufferedResponseWriter) passThrough() error {
+	w.overflow = true
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+	return err
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferedResponseWriter) Flush() {
+	if !w.overflow && isEventStream(w.Header().Get("Content-Type")) {
+		w.passThrough()
+	}
+	// Flushing a partially buffered body would defeat ETag computation
+	if w.overflow {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift the write deadline of a stream
+func (w *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cacheMiddleware answers conditional GETs, serves cached responses for routes with a TTL,
+// and invalidates cached responses after successful mutations
+func cacheMiddleware(route ServiceRoute, cache *responseCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			if status := c.Writer.Status(); status >= 200 && status < 300 {
+				cache.invalidate(route.cacheGroup())
+			}
+			return
+		}
+
+		key := cacheKey(c)
+		ifNoneMatch := c.GetHeader("If-None-Match")
+
+		// A client asking for no-cache is answered by the upstream, whose response replaces the entry
+		if route.CacheTTL > 0 {
+			if entry, ok := cache.get(key); ok && !strings.Contains(c.GetHeader("Cache-Control"), "no-cache") {
+				cache.hitCount.Add(1)
+				cache.requests.WithLabelValues(route.Name, "hit").Inc()
+
+				if etagMatches(ifNoneMatch, entry.etag) {
+					c.Header("ETag", entry.etag)
+					c.AbortWithStatus(http.StatusNotModified)
+					return
+				}
+				copyResponseHeaders(entry.header, c.Writer.Header())
+				c.Header("X-Cache", "HIT")
+				c.Status(entry.status)
+				c.Writer.Write(entry.body)
+				c.Abort()
+				return
+			}
+			cache.missCount.Add(1)
+			cache.requests.WithLabelValues(route.Name, "miss").Inc()
+		}
+
+		original := c.Writer
+		buffered := &bufferedResponseWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = buffered
+		c.Next()
+		c.Writer = original
+
+		// Nothing was produced for a client that went away, and an empty 200 must not be cached
+		if buffered.overflow || !buffered.wrote {
+			return
+		}
+
+		body := buffered.body.Bytes()
+		header := original.Header()
+		if buffered.status != http.StatusOK {
+			original.WriteHeader(buffered.status)
+			original.Write(body)
+			return
+		}
+
+		etag := header.Get("ETag")
+		if etag == "" {
+			etag = computeETag(body)
+			header.Set("ETag", etag)
+		}
+
+		// A body cut short by a cancelled request is still relayed, but never cached
+		complete := c.Request.Context().Err() == nil
+		if route.CacheTTL > 0 && complete && !strings.Contains(header.Get("Cache-Control"), "no-store") {
+			cache.set(key, &cacheEntry{
+				group:     route.cacheGroup(),
+				status:    buffered.status,
+				header:    relayableHeaders(header), // Without the request ID of the first caller
+				body:      append([]byte(nil), body...),
+				etag:      etag,
+				expiresAt: time.Now().Add(route.CacheTTL),
+			})
+			header.Set("X-Cache", "MISS")
+		}
+
+		if etagMatches(ifNoneMatch, etag) {
+			header.Del("Content-Length")
+			original.WriteHeader(http.StatusNotModified)
+			original.WriteHeaderNow()
+			return
+		}
+
+		original.WriteHeader(buffered.status)
+		original.Write(body)
+	}
+}
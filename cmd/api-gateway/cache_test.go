@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// newTestRouter registers a cached config route proxying to upstream, the way registerRoutes does
+// without authentication and auditing. done receives once the handler chain of each request returned.
+func newTestRouter(upstream *httptest.Server) (router *gin.Engine, done chan struct{}) {
+	gin.SetMode(gin.TestMode)
+	route := ServiceRoute{
+		Name:         "Configuration Service",
+		PathBase:     "/api/v1/configs",
+		URL:          upstream.URL + "/configs",
+		Methods:      []string{"GET"},
+		CacheTTL:     time.Minute,
+		MaxBodyBytes: 1 << 20,
+	}
+	state := newRouteState(route)
+	cache := newResponseCache(100, prometheus.NewRegistry())
+
+	done = make(chan struct{}, 4)
+	router = gin.New()
+	router.GET("/api/v1/configs/*proxyPath",
+		func(c *gin.Context) {
+			defer func() { done <- struct{}{} }()
+			c.Next()
+		},
+		bodyLimitMiddleware(route), routeModeMiddleware(state), upstreamSelectionMiddleware(state),
+		cacheMiddleware(route, cache), createProxyHandler(state, zap.NewNop()))
+	return router, done
+}
+
+// newTestRoute serves newTestRouter until the test ends
+func newTestRoute(t *testing.T, upstream *httptest.Server) (gateway *httptest.Server, done chan struct{}) {
+	t.Helper()
+	router, done := newTestRouter(upstream)
+	gateway = httptest.NewServer(router)
+	t.Cleanup(gateway.Close)
+	return gateway, done
+}
+
+func TestCancelledGetIsNotCached(t *testing.T) {
+	started := make(chan struct{}, 1)
+	first := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if first {
+			// Hold the first request until the gateway gives up on it
+			first = false
+			started <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, `{"name":"app"}`)
+	}))
+	defer upstream.Close()
+	gateway, done := newTestRoute(t, upstream)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gateway.URL+"/api/v1/configs/app", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestErr := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestErr <- err
+	}()
+	<-started
+	cancel()
+	if err := <-requestErr; err == nil {
+		t.Fatal("cancelled request succeeded")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("gateway did not finish the cancelled request")
+	}
+
+	resp, err := http.Get(gateway.URL + "/api/v1/configs/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got := resp.Header.Get("X-Cache"); got != "MISS" {
+		t.Fatalf("X-Cache after a cancelled request = %q, want MISS", got)
+	}
+	if string(body) != `{"name":"app"}` {
+		t.Fatalf("body = %q, want the upstream response", body)
+	}
+}
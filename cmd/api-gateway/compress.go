@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// encodingContextKey holds the response encoding negotiated from Accept-Encoding, empty for identity
+const encodingContextKey = "accept_encoding"
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+// brotliLevel trades ratio for CPU, levels above 5 are too slow for on-the-fly compression
+const brotliLevel = 4
+
+// compressor negotiates response compression and decodes compressed request bodies
+type compressor struct {
+	minSize         int
+	maxDecompressed int
+
+	gzipWriters   sync.Pool
+	brotliWriters sync.Pool
+
+	ratio *prometheus.HistogramVec
+	bytes *prometheus.CounterVec
+}
+
+// newCompressor creates a compressor and registers its metrics with the given registry
+func newCompressor(minSize, maxDecompressed int, registry *prometheus.Registry) *compressor {
+	cp := &compressor{
+		minSize:         minSize,
+		maxDecompressed: maxDecompressed,
+		ratio: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gateway_compression_ratio",
+				Help:    "Compressed size divided by uncompressed size, by direction and encoding",
+				Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.8, 1},
+			},
+			[]string{"direction", "encoding"},
+		),
+		bytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gateway_compression_bytes_total",
+				Help: "Bytes before and after compression, by direction, encoding and stage",
+			},
+			[]string{"direction", "encoding", "stage"},
+		),
+	}
+	cp.gzipWriters.New = func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}
+	cp.brotliWriters.New = func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, brotliLevel)
+	}
+	registry.MustRegister(cp.ratio, cp.bytes)
+	return cp
+}
+
+func (cp *compressor) observe(direction, encoding string, compressed, uncompressed int64) {
+	cp.bytes.WithLabelValues(direction, encoding, "compressed").Add(float64(compressed))
+	cp.bytes.WithLabelValues(direction, encoding, "uncompressed").Add(float64(uncompressed))
+	if uncompressed > 0 {
+		cp.ratio.WithLabelValues(direction, encoding).Observe(float64(compressed) / float64(uncompressed))
+	}
+}
+
+// middleware compresses eligible responses with the best encoding the client accepts
+func (cp *compressor) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		c.Set(encodingContextKey, encoding)
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, cp: cp, encoding: encoding}
+		c.Writer = writer
+		defer func() {
+			writer.finish()
+			c.Writer = writer.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// decompressMiddleware decodes gzip and br request bodies. Decoding costs CPU and memory up to
+// maxDecompressed per request, so it runs only once the caller is authenticated and admitted.
+func (cp *compressor) decompressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !cp.decompressRequest(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// decompressRequest replaces a compressed request body with its decoded form. The decoded body is
+// read into memory up to maxDecompressed bytes so a decompression bomb is rejected before any of
+// it reaches an upstream.
+func (cp *compressor) decompressRequest(c *gin.Context) bool {
+	encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || c.Request.Body == nil {
+		return true
+	}
+
+	compressed := &countingReader{Reader: c.Request.Body}
+	var decoder io.Reader
+	switch encoding {
+	case encodingGzip, "x-gzip":
+		gz, err := gzip.NewReader(compressed)
+		if err != nil {
+			problem.Abort(c, problem.CodeBadRequest, "The request body is not valid gzip")
+			return false
+		}
+		defer gz.Close()
+		decoder, encoding = gz, encodingGzip
+	case encodingBrotli:
+		decoder = brotli.NewReader(compressed)
+	default:
+		c.Header("Accept-Encoding", "gzip, br")
+		problem.Abort(c, problem.CodeUnsupportedMedia, "Content-Encoding "+encoding+" is not supported")
+		return false
+	}
+
+	// Read one byte past the limit to tell an exact fit from an oversized body
+	body, err := io.ReadAll(io.LimitReader(decoder, int64(cp.maxDecompressed)+1))
+	if err != nil {
+		problem.Abort(c, problem.CodeBadRequest, "The request body could not be decompressed")
+		return false
+	}
+	if len(body) > cp.maxDecompressed {
+		problem.Abort(c, problem.CodePayloadTooLarge, "The request body exceeds "+strconv.Itoa(cp.maxDecompressed)+" bytes after decompression")
+		return false
+	}
+	cp.observe("request", encoding, compressed.n, int64(len(body)))
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.Header.Del("Content-Encoding")
+	c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return true
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header by q-value, preferring br on ties
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	quality := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		quality[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		q, ok := quality[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressibleType reports whether a media type benefits from compression. Event streams are
+// excluded because buffering in the encoder would delay events.
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == eventStreamType:
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/javascript", "application/xml",
+		"application/yaml", "application/x-yaml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the first minSize bytes of a response to decide whether compressing
+// it is worthwhile, then streams the rest through the encoder
+type compressWriter struct {
+	gin.ResponseWriter
+	cp       *compressor
+	encoding string
+
+	buf     []byte
+	decided bool
+
+	encoder      io.WriteCloser
+	flusher      interface{ Flush() error }
+	out          *countingWriter
+	uncompressed int64
+}
+
+// eligible checks the response headers, upstream-encoded content is passed through untouched
+func (w *compressWriter) eligible() bool {
+	status := w.ResponseWriter.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	if ce := header.Get("Content-Encoding"); ce != "" && ce != "identity" {
+		return false
+	}
+	if strings.Contains(header.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	return compressibleType(header.Get("Content-Type"))
+}
+
+// decide fixes the response headers before anything reaches the client
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	header := w.Header()
+	if compressibleType(header.Get("Content-Type")) {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	if !compress {
+		return
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	// The compressed bytes differ from the identity representation, so a strong validator no longer holds
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	w.out = &countingWriter{Writer: w.ResponseWriter}
+	switch w.encoding {
+	case encodingBrotli:
+		bw := w.cp.brotliWriters.Get().(*brotli.Writer)
+		bw.Reset(w.out)
+		w.encoder, w.flusher = bw, bw
+	default:
+		gw := w.cp.gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(w.out)
+		w.encoder, w.flusher = gw, gw
+	}
+}
+
+// knownSize returns the declared Content-Length, if any
+func (w *compressWriter) knownSize() (int, bool) {
+	size, err := strconv.Atoi(w.Header().Get("Content-Length"))
+	return size, err == nil
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		return w.write(data)
+	}
+	if !w.eligible() {
+		w.decide(false)
+		return w.write(data)
+	}
+	if size, ok := w.knownSize(); ok {
+		w.decide(size >= w.cp.minSize)
+		return w.write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) < w.cp.minSize {
+		return len(data), nil
+	}
+	w.decide(true)
+	if err := w.drain(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) write(data []byte) (int, error) {
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	w.uncompressed += int64(len(data))
+	return w.encoder.Write(data)
+}
+
+// drain writes out the bytes held back while deciding
+func (w *compressWriter) drain() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// WriteHeaderNow is used for responses without a body, which are never compressed
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+		w.drain()
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush treats the response as a stream of unknown length and pushes buffered output to the client
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(w.eligible())
+		w.drain()
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift the write deadline of a stream
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes small responses uncompressed, closes the encoder and records the ratio
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+		w.drain()
+	}
+	if w.encoder == nil {
+		return
+	}
+	w.encoder.Close()
+	switch encoder := w.encoder.(type) {
+	case *brotli.Writer:
+		encoder.Reset(io.Discard)
+		w.cp.brotliWriters.Put(encoder)
+	case *gzip.Writer:
+		encoder.Reset(io.Discard)
+		w.cp.gzipWriters.Put(encoder)
+	}
+	w.encoder = nil
+	w.cp.observe("response", w.encoding, w.out.n, w.uncompressed)
+}
+
+// countingReader counts bytes read from the wrapped reader
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts bytes written to the wrapped writer
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
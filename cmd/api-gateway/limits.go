@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// headerLimitMiddleware rejects requests with too many header values or too many header bytes.
+// http.Server.MaxHeaderBytes is the hard cap enforced while parsing; this check applies the
+// configured limits exactly and answers with a problem response.
+func headerLimitMiddleware(maxCount, maxBytes int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, size := 0, 0
+		for name, values := range c.Request.Header {
+			for _, value := range values {
+				count++
+				size += len(name) + len(value)
+			}
+		}
+		if count > maxCount {
+			problem.Abort(c, problem.CodeHeadersTooLarge, fmt.Sprintf("The request has %d header values, at most %d are allowed", count, maxCount))
+			return
+		}
+		if size > maxBytes {
+			problem.Abort(c, problem.CodeHeadersTooLarge, fmt.Sprintf("The request headers exceed %d bytes", maxBytes))
+			return
+		}
+		c.Next()
+	}
+}
+
+// bodyLimitMiddleware enforces a route's maximum request body size. Declared lengths are rejected
+// up front; chunked bodies are cut off by http.MaxBytesReader while the proxy streams them.
+func bodyLimitMiddleware(route ServiceRoute) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxBytes := route.bodyLimit(c.Param("proxyPath"))
+		if c.Request.ContentLength > maxBytes {
+			problem.Abort(c, problem.CodePayloadTooLarge, fmt.Sprintf("The request body exceeds %d bytes", maxBytes))
+			return
+		}
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+		c.Next()
+	}
+}
+
+// concurrencyLimiter sheds load once too many proxied requests are in flight, so a burst fails
+// fast with 503 instead of queueing on upstreams and Postgres. Event streams stay open for as long
+// as their clients listen, so they are counted against a limit of their own and cannot starve
+// ordinary requests of slots.
+type concurrencyLimiter struct {
+	requests chan struct{} // nil when requests are not limited
+	streams  chan struct{} // nil when streams are not limited
+
+	inFlight    prometheus.GaugeFunc
+	openStreams prometheus.GaugeFunc
+	shed        *prometheus.CounterVec
+}
+
+// newConcurrencyLimiter creates a limiter for max concurrent requests and maxStreams concurrent
+// event streams, zero leaving either unlimited, and registers its metrics
+func newConcurrencyLimiter(max, maxStreams int, registry *prometheus.Registry) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_shed_requests_total",
+			Help: "Requests rejected because the gateway reached its in-flight limit, by kind of request",
+		}, []string{"kind"}),
+	}
+	if max > 0 {
+		l.requests = make(chan struct{}, max)
+	}
+	if maxStreams > 0 {
+		l.streams = make(chan struct{}, maxStreams)
+	}
+	l.inFlight = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "gateway_in_flight_requests",
+			Help: "Proxied requests currently being served, event streams excluded",
+		},
+		func() float64 { return float64(len(l.requests)) },
+	)
+	l.openStreams = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "gateway_open_streams",
+			Help: "Event streams currently proxied",
+		},
+		func() float64 { return float64(len(l.streams)) },
+	)
+	registry.MustRegister(l.inFlight, l.openStreams, l.shed)
+	return l
+}
+
+// middleware admits a request if a slot of its kind is free and rejects it immediately otherwise
+func (l *concurrencyLimiter) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slots, kind := l.requests, "request"
+		if isEventStream(c.GetHeader("Accept")) {
+			slots, kind = l.streams, "stream"
+		}
+		if slots == nil {
+			c.Next()
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			c.Next()
+		default:
+			l.shed.WithLabelValues(kind).Inc()
+			problem.Write(c, problem.New(problem.CodeUnavailable, "The gateway is at capacity").WithRetryAfter(1))
+		}
+	}
+}
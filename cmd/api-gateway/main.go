@@ -3,73 +3,123 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/audit"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/authz"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/config"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/health"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/lifecycle"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/tlsutil"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
-const internalServerErrorMessage = "Internal Server Error"
-
-// Config struct for API Gateway
-type Config struct {
-	Port              string `json:"port"`
-	AuthServiceURL    string `json:"auth_service_url"`
-	APIServiceURL     string `json:"api_service_url"`
-	RateLimit         int    `json:"rate_limit"`
-	RateLimitInterval int    `json:"rate_limit_interval"`
-	Timeout           int    `json:"timeout"`
-}
-
 // ServiceRoute defines a route to be proxied through the gateway
 type ServiceRoute struct {
 	Name     string
 	PathBase string
 	URL      string
 	Methods  []string
+	CacheTTL time.Duration // Zero disables response caching, conditional GETs are still answered
+
+	// CacheGroup names routes backed by the same data. A successful mutation through any of them
+	// drops the cached responses of all. Empty puts the route in a group of its own.
+	CacheGroup string
+
+	MaxBodyBytes int64 // Request body limit, zero uses the gateway-wide default
+
+	// PathBodyLimits replaces MaxBodyBytes for bulk endpoints, keyed by the path below PathBase
+	PathBodyLimits map[string]int64
+
+	// Timeout replaces proxyTimeout and the server write timeout for routes whose responses take
+	// longer, such as exports. Zero keeps both.
+	Timeout time.Duration
+
+	// Optional weighted upstream groups and match rules for canary traffic. When Upstreams is
+	// empty, URL receives all traffic as the primary variant.
+	Upstreams []Upstream
+	Rules     []MatchRule
 }
 
-// Initialize and return configuration from environment variables
-func loadConfig() Config {
-	config := Config{
-		Port:              "8080",
-		AuthServiceURL:    "http://auth-service:8080",
-		APIServiceURL:     "http://api-service:8080",
-		RateLimit:         100,
-		RateLimitInterval: 1,
-		Timeout:           30,
+// cacheGroup returns the group whose cached responses a mutation through the route invalidates
+func (r ServiceRoute) cacheGroup() string {
+	if r.CacheGroup != "" {
+		return r.CacheGroup
 	}
+	return r.Name
+}
 
-	// Override with environment variables if provided
-	if port := os.Getenv("PORT"); port != "" {
-		config.Port = port
-	}
-	if authURL := os.Getenv("AUTH_SERVICE_URL"); authURL != "" {
-		config.AuthServiceURL = authURL
-	}
-	if apiURL := os.Getenv("API_SERVICE_URL"); apiURL != "" {
-		config.APIServiceURL = apiURL
+// bodyLimit returns the request body limit for a path below PathBase
+func (r ServiceRoute) bodyLimit(path string) int64 {
+	if limit, ok := r.PathBodyLimits[strings.TrimSuffix(path, "/")]; ok {
+		return limit
 	}
+	return r.MaxBodyBytes
+}
+
+// configImportMaxBodyBytes matches the limit config-server applies to an import
+const configImportMaxBodyBytes = 10 << 20
+
+// proxyTimeout bounds a proxied request from start to the end of the response body
+const proxyTimeout = 30 * time.Second
 
-	return config
+// exportTimeout bounds routes that stream exports or walk whole tables, matching the write timeout
+// the upstream services allow themselves for the same requests
+const exportTimeout = 10 * time.Minute
+
+// eventStreamType is the media type of Server-Sent Events, relayed to the client as they arrive
+const eventStreamType = "text/event-stream"
+
+// streamClient proxies requests that accept an event stream. A stream stays open as long as the
+// client listens, so only the wait for the response headers is bounded.
+var streamClient = &http.Client{Transport: func() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = proxyTimeout
+	return transport
+}()}
+
+// isEventStream reports whether a Content-Type or Accept header names an event stream
+func isEventStream(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		if mediaType, _, err := mime.ParseMediaType(part); err == nil && mediaType == eventStreamType {
+			return true
+		}
+	}
+	return false
 }
 
-// Middleware for authentication
-func authMiddleware(authServiceURL string, logger *zap.Logger) gin.HandlerFunc {
+// Middleware for authentication. Machine clients presenting a verified client certificate whose
+// common name is mapped to a service account are authenticated without a bearer token.
+func authMiddleware(authServiceURL string, clientCertAccounts map[string]string, logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if claims, ok := clientCertClaims(c, clientCertAccounts); ok {
+			c.Set("user", claims)
+			c.Next()
+			return
+		}
+
 		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
 		if token == "" {
 			logger.Warn("Missing authentication token")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Missing token"})
+			problem.Abort(c, problem.CodeUnauthorized, "Missing bearer token")
 			return
 		}
 
@@ -81,7 +131,7 @@ func authMiddleware(authServiceURL string, logger *zap.Logger) gin.HandlerFunc {
 		req, err := http.NewRequestWithContext(ctx, "POST", authServiceURL+"/validate", nil)
 		if err != nil {
 			logger.Error("Failed to create auth request", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": internalServerErrorMessage})
+			problem.Abort(c, problem.CodeInternal, "Failed to validate credentials")
 			return
 		}
 		req.Header.Set("Authorization", "Bearer "+token)
@@ -90,14 +140,14 @@ func authMiddleware(authServiceURL string, logger *zap.Logger) gin.HandlerFunc {
 		resp, err := client.Do(req)
 		if err != nil {
 			logger.Error("Auth service request failed", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": internalServerErrorMessage})
+			problem.Abort(c, problem.CodeInternal, "Failed to validate credentials")
 			return
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			logger.Warn("Authentication failed", zap.Int("status_code", resp.StatusCode))
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			problem.Abort(c, problem.CodeUnauthorized, "Invalid or expired token")
 			return
 		}
 
@@ -105,7 +155,7 @@ func authMiddleware(authServiceURL string, logger *zap.Logger) gin.HandlerFunc {
 		var claims map[string]interface{}
 		if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
 			logger.Error("Failed to decode auth response", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": internalServerErrorMessage})
+			problem.Abort(c, problem.CodeInternal, "Failed to validate credentials")
 			return
 		}
 
@@ -115,19 +165,68 @@ func authMiddleware(authServiceURL string, logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
-// Middleware for rate limiting
-func rateLimitMiddleware(rps int, interval time.Duration) gin.HandlerFunc {
-	limiter := rate.NewLimiter(rate.Every(interval), rps)
+// clientCertClaims maps a verified client certificate to service account claims
+func clientCertClaims(c *gin.Context, accounts map[string]string) (map[string]interface{}, bool) {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(accounts) == 0 {
+		return nil, false
+	}
+	subject := c.Request.TLS.VerifiedChains[0][0].Subject
+	account, ok := accounts[subject.CommonName]
+	if !ok {
+		return nil, false
+	}
+	return map[string]interface{}{
+		"sub":             account,
+		"service_account": true,
+		"auth_method":     "mtls",
+		"cert_subject":    subject.String(),
+	}, true
+}
+
+// rateLimiter wraps the global token bucket and counts its decisions for the admin API
+type rateLimiter struct {
+	limiter  *rate.Limiter
+	allowed  atomic.Uint64
+	rejected atomic.Uint64
+}
 
+// RateLimiterUsage reports the current state of the global rate limiter
+type RateLimiterUsage struct {
+	LimitPerSecond  float64 `json:"limit_per_second"`
+	Burst           int     `json:"burst"`
+	TokensAvailable float64 `json:"tokens_available"`
+	Allowed         uint64  `json:"allowed_total"`
+	Rejected        uint64  `json:"rejected_total"`
+}
+
+func newRateLimiter(rps int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{limiter: rate.NewLimiter(rate.Every(interval), rps)}
+}
+
+// Middleware for rate limiting
+func (l *rateLimiter) middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !limiter.Allow() {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+		if !l.limiter.Allow() {
+			l.rejected.Add(1)
+			problem.Write(c, problem.New(problem.CodeRateLimited, "Rate limit exceeded").WithRetryAfter(1))
 			return
 		}
+		l.allowed.Add(1)
 		c.Next()
 	}
 }
 
+// Usage returns a snapshot of the limiter's configuration and counters
+func (l *rateLimiter) Usage() RateLimiterUsage {
+	return RateLimiterUsage{
+		LimitPerSecond:  float64(l.limiter.Limit()),
+		Burst:           l.limiter.Burst(),
+		TokensAvailable: l.limiter.Tokens(),
+		Allowed:         l.allowed.Load(),
+		Rejected:        l.rejected.Load(),
+	}
+}
+
 // Middleware for request logging
 func loggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -146,18 +245,43 @@ func loggingMiddleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("remote_addr", c.ClientIP()),
 			zap.Int("status", c.Writer.Status()),
 			zap.Duration("duration", duration),
+			zap.String("request_id", requestid.Get(c)),
 		)
 	}
 }
 
 // Create a reverse proxy handler for service routes
-func createProxyHandler(route ServiceRoute, logger *zap.Logger) gin.HandlerFunc {
+func createProxyHandler(state *routeState, logger *zap.Logger) gin.HandlerFunc {
+	route := state.Route
 	return func(c *gin.Context) {
+		upstream := selectedUpstream(state, c)
+		if !upstream.Breaker.Allow() {
+			// Fall back to the primary variant when a canary's circuit is open
+			primary := state.Primary()
+			if upstream == primary || !primary.Breaker.Allow() {
+				problem.Write(c, problem.New(problem.CodeUnavailable, "Upstream circuit is open").WithRetryAfter(30))
+				return
+			}
+			upstream = primary
+			c.Set("variant", upstream.Variant)
+		}
+		state.inFlight.Add(1)
+		defer state.inFlight.Add(-1)
+
+		// Every path that does not record an outcome releases the call, a half-open breaker would
+		// otherwise wait for its probe forever
+		recorded := false
+		defer func() {
+			if !recorded {
+				upstream.Breaker.Release()
+			}
+		}()
+
 		// Extract path without the base path
 		path := strings.TrimPrefix(c.Request.URL.Path, route.PathBase)
 
 		// Create the target URL
-		targetURL := fmt.Sprintf("%s%s", route.URL, path)
+		targetURL := fmt.Sprintf("%s%s", upstream.URL, path)
 		if c.Request.URL.RawQuery != "" {
 			targetURL = fmt.Sprintf("%s?%s", targetURL, c.Request.URL.RawQuery)
 		}
@@ -169,7 +293,7 @@ func createProxyHandler(route ServiceRoute, logger *zap.Logger) gin.HandlerFunc
 				zap.String("target", targetURL),
 				zap.Error(err),
 			)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": internalServerErrorMessage})
+			problem.Abort(c, problem.CodeInternal, "Failed to create upstream request")
 			return
 		}
 
@@ -183,31 +307,90 @@ func createProxyHandler(route ServiceRoute, logger *zap.Logger) gin.HandlerFunc
 		addForwardedHeaders(c, outReq)
 
 		// Send the request to the target service
+		timeout := proxyTimeout
+		if route.Timeout > 0 {
+			timeout = route.Timeout
+			if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+				logger.Warn("Could not extend the write deadline", zap.String("service", route.Name), zap.Error(err))
+			}
+		}
 		client := &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
+		}
+		if isEventStream(c.GetHeader("Accept")) {
+			client = streamClient
 		}
 
 		resp, err := client.Do(outReq)
 		if err != nil {
+			// A chunked body that outgrew the route limit is the client's fault, not the upstream's
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				problem.Abort(c, problem.CodePayloadTooLarge, fmt.Sprintf("The request body exceeds %d bytes", maxBytesErr.Limit))
+				return
+			}
+			// A client that went away says nothing about the upstream
+			if c.Request.Context().Err() != nil {
+				logger.Debug("Client cancelled proxied request", zap.String("service", route.Name), zap.Error(err))
+				c.Abort()
+				return
+			}
 			logger.Error("Proxy request failed",
 				zap.String("service", route.Name),
+				zap.String("variant", upstream.Variant),
 				zap.String("target", targetURL),
 				zap.Error(err),
 			)
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service Unavailable"})
+			upstream.Breaker.RecordFailure()
+			recorded = true
+			problem.Abort(c, problem.CodeUnavailable, route.Name+" is unavailable")
 			return
 		}
 		defer resp.Body.Close()
 
+		// Gateway-level upstream errors count against the breaker, application errors do not
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			upstream.Breaker.RecordFailure()
+		default:
+			upstream.Breaker.RecordSuccess()
+		}
+		recorded = true
+
 		// Copy response headers
-		copyHeaders(resp.Header, c.Writer.Header())
+		copyResponseHeaders(resp.Header, c.Writer.Header())
+		c.Header("X-Upstream-Variant", upstream.Variant)
 
 		// Set status code and copy response body
 		c.Status(resp.StatusCode)
+		if isEventStream(resp.Header.Get("Content-Type")) {
+			streamResponse(c, resp.Body)
+			return
+		}
 		io.Copy(c.Writer, resp.Body)
 	}
 }
 
+// streamResponse relays an event stream, flushing after every read so that no event is held back
+// in the gateway. The server's write timeout is lifted for the lifetime of the stream.
+func streamResponse(c *gin.Context, body io.Reader) {
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Writer.Flush()
+	buf := make([]byte, 4096)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, err := c.Writer.Write(buf[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 // Helper function to copy headers
 func copyHeaders(src, dst http.Header) {
 	for name, values := range src {
@@ -217,12 +400,53 @@ func copyHeaders(src, dst http.Header) {
 	}
 }
 
-// Helper function to forward user context
+// hopByHopHeaders describe a single connection and are never relayed (RFC 9110, section 7.6.1)
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// gatewayResponseHeaders are set by the gateway on every response, an upstream's copy is dropped
+var gatewayResponseHeaders = []string{requestid.Header, "X-Cache"}
+
+// copyResponseHeaders relays upstream response headers. Each replaces any value the gateway set
+// before, so a header the upstream echoes is not sent twice. Hop-by-hop headers and those the
+// gateway owns are skipped.
+func copyResponseHeaders(src, dst http.Header) {
+	for name, values := range relayableHeaders(src) {
+		dst[name] = append([]string(nil), values...)
+	}
+}
+
+// relayableHeaders returns a copy of header without hop-by-hop headers and those the gateway owns
+func relayableHeaders(header http.Header) http.Header {
+	out := header.Clone()
+	for _, name := range header.Values("Connection") {
+		for _, token := range strings.Split(name, ",") {
+			out.Del(strings.TrimSpace(token))
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		out.Del(name)
+	}
+	for _, name := range gatewayResponseHeaders {
+		out.Del(name)
+	}
+	return out
+}
+
+// Helper function to forward user context. Identity headers sent by the client are always
+// dropped, only the gateway asserts who the caller is.
 func forwardUserContext(c *gin.Context, req *http.Request) {
+	req.Header.Del(authz.UserIDHeader)
+	req.Header.Del(authz.RolesHeader)
 	if user, exists := c.Get("user"); exists {
 		if userMap, ok := user.(map[string]interface{}); ok {
 			if userID, ok := userMap["sub"].(string); ok {
-				req.Header.Set("X-User-ID", userID)
+				req.Header.Set(authz.UserIDHeader, userID)
+			}
+			if roles := authz.RolesFromClaims(userMap); len(roles) > 0 {
+				req.Header.Set(authz.RolesHeader, strings.Join(roles, ","))
 			}
 		}
 	}
@@ -245,7 +469,7 @@ func setupMetrics() (*prometheus.Registry, gin.HandlerFunc) {
 			Name: "gateway_requests_total",
 			Help: "Total number of requests processed by the API Gateway",
 		},
-		[]string{"method", "path", "status"},
+		[]string{"method", "path", "status", "variant"},
 	)
 
 	// Request duration
@@ -255,7 +479,7 @@ func setupMetrics() (*prometheus.Registry, gin.HandlerFunc) {
 			Help:    "Request duration in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"method", "path"},
+		[]string{"method", "path", "variant"},
 	)
 
 	registry.MustRegister(requestCounter, requestDuration)
@@ -270,144 +494,301 @@ func setupMetrics() (*prometheus.Registry, gin.HandlerFunc) {
 		duration := time.Since(start).Seconds()
 		status := fmt.Sprintf("%d", c.Writer.Status())
 
-		requestCounter.WithLabelValues(c.Request.Method, path, status).Inc()
-		requestDuration.WithLabelValues(c.Request.Method, path).Observe(duration)
+		// Upstream variant chosen by traffic splitting, empty for requests that were not proxied
+		variant := c.GetString("variant")
+
+		requestCounter.WithLabelValues(c.Request.Method, path, status, variant).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, path, variant).Observe(duration)
 	}
 
 	return registry, metricMiddleware
 }
 
 // registerRoutes handles registering the service routes
-func registerRoutes(engine *gin.Engine, routes []ServiceRoute, logger *zap.Logger) {
-	// API routes with authentication
-	api := engine.Group("/api/v1") // Use /api/v1 as base for all proxied routes
+func registerRoutes(api *gin.RouterGroup, routes *routeTable, cache *responseCache, auditWriter *audit.Writer, auditMaxBody int, logger *zap.Logger) {
+	// API routes with authentication, api is the /api/v1 group carrying the auth middleware
 	{
 		// Register service routes
-		for _, route := range routes {
+		for _, state := range routes.All() {
+			route := state.Route
 			logger.Info("Registering route",
 				zap.String("name", route.Name),
 				zap.String("path", route.PathBase), // This is the path base the gateway listens on
 				zap.Strings("methods", route.Methods),
 				zap.String("target", route.URL), // Log target URL
+				zap.Duration("cache_ttl", route.CacheTTL),
+				zap.Int64("max_body_bytes", route.MaxBodyBytes),
 			)
 
-			handler := createProxyHandler(route, logger)
+			handler := createProxyHandler(state, logger)
 			// Dynamically create the gin route path based on PathBase
 			relativePath := strings.TrimPrefix(route.PathBase, "/api/v1/")
 			ginPath := relativePath + "/*proxyPath" // Use a named parameter to capture the rest
 
 			for _, method := range route.Methods {
-				api.Handle(method, ginPath, handler) // Use Handle for flexibility
+				api.Handle(method, ginPath, auditMiddleware(route, auditWriter, auditMaxBody), bodyLimitMiddleware(route), routeModeMiddleware(state), upstreamSelectionMiddleware(state), cacheMiddleware(route, cache), handler) // Use Handle for flexibility
 			}
 		}
 	}
 }
 
 func main() {
+	// Load configuration: config.yaml, then environment variables, then flags
+	cfg, err := config.Load("api-gateway", os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	// Initialize logger
-	logger, err := zap.NewProduction()
+	logger, err := config.NewLogger(cfg.Logging)
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Sync()
 
-	// Load configuration
-	config := loadConfig()
-
 	// Define service routes
 	routes := []ServiceRoute{
 		// { // This seems redundant if API Service just proxies others? Keep for now.
 		// 	Name:     "API Service",
 		// 	PathBase: "/api/v1", // Base path handled by the group
-		// 	URL:      config.APIServiceURL,
+		// 	URL:      cfg.Services.APIURL,
 		// 	Methods:  []string{"GET", "POST", "PUT", "DELETE"},
 		// },
 		{
 			Name:     "Deployment Service",
 			PathBase: "/api/v1/deployments",
-			URL:      os.Getenv("DEPLOYMENT_SERVICE_URL"),
+			URL:      cfg.Services.DeploymentURL,
 			Methods:  []string{"GET", "POST", "PUT", "DELETE"},
 		},
 		{
 			Name:     "Monitoring Service",
 			PathBase: "/api/v1/monitoring",
-			URL:      os.Getenv("MONITORING_SERVICE_URL"),
+			URL:      cfg.Services.MonitoringURL,
 			Methods:  []string{"GET"},
+			CacheTTL: cfg.Gateway.MonitoringCacheTTL,
 		},
 		{
-			Name:     "Configuration Service",
-			PathBase: "/api/v1/configs",
-			URL:      os.Getenv("CONFIG_SERVICE_URL"),
-			Methods:  []string{"GET", "POST", "PUT", "DELETE"},
+			Name:       "Configuration Service",
+			PathBase:   "/api/v1/configs",
+			URL:        cfg.Services.ConfigURL + "/configs",
+			Methods:    []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			CacheTTL:   cfg.Gateway.ConfigCacheTTL,
+			CacheGroup: "config", // Schemas and promotions change what config reads return
+			// Config documents are small, keep oversized payloads away from config-server and Postgres
+			MaxBodyBytes:   cfg.Gateway.ConfigMaxBodyBytes,
+			PathBodyLimits: map[string]int64{"/import": configImportMaxBodyBytes},
+		},
+		{
+			Name:         "Config Schemas",
+			PathBase:     "/api/v1/schemas",
+			URL:          cfg.Services.ConfigURL + "/schemas",
+			CacheGroup:   "config",
+			Methods:      []string{"GET", "POST", "DELETE"},
+			MaxBodyBytes: cfg.Gateway.ConfigMaxBodyBytes,
+		},
+		{
+			Name:         "Config Promotions",
+			PathBase:     "/api/v1/promotions",
+			URL:          cfg.Services.ConfigURL + "/promotions",
+			CacheGroup:   "config",
+			Methods:      []string{"GET", "POST"},
+			MaxBodyBytes: cfg.Gateway.ConfigMaxBodyBytes,
+		},
+		{
+			Name:     "Audit Log",
+			PathBase: "/api/v1/audit",
+			URL:      cfg.Services.APIURL + "/api/v1/audit",
+			Methods:  []string{"GET"},
+			Timeout:  exportTimeout, // CSV and NDJSON exports and chain verification
 		},
 		// { // Example for the core API service if it has its own endpoints besides proxying
 		// 	Name:     "Core API Service",
 		// 	PathBase: "/api/v1/core", // Example path
-		// 	URL:      config.APIServiceURL, // Target URL
+		// 	URL:      cfg.Services.APIURL, // Target URL
 		// 	Methods:  []string{"GET"},
 		// },
 	}
 
-	// Ensure fallback URLs if env vars are not set
 	for i := range routes {
-		switch routes[i].Name {
-		case "Deployment Service":
-			if routes[i].URL == "" {
-				routes[i].URL = "http://deployment-service:8080"
-			}
-		case "Monitoring Service":
-			if routes[i].URL == "" {
-				routes[i].URL = "http://monitoring-service:8080"
+		if routes[i].MaxBodyBytes == 0 {
+			routes[i].MaxBodyBytes = cfg.Gateway.MaxBodyBytes
+		}
+	}
+
+	// Canary rollout for the config service: a share of traffic by weight, or any request carrying X-Canary
+	if canaryURL := cfg.Gateway.ConfigCanaryURL; canaryURL != "" {
+		weight := cfg.Gateway.ConfigCanaryWeight
+		for i := range routes {
+			if routes[i].Name == "Configuration Service" {
+				routes[i].Upstreams = []Upstream{
+					{Variant: "stable", URL: routes[i].URL, Weight: 100 - weight},
+					{Variant: "canary", URL: canaryURL + "/configs", Weight: weight},
+				}
+				routes[i].Rules = []MatchRule{
+					{Type: matchHeader, Name: "X-Canary", Variant: "canary"},
+				}
 			}
-		case "Configuration Service":
-			if routes[i].URL == "" {
-				routes[i].URL = "http://config-service:8082"
-			} // Default internal URL for config service
-			// case "Core API Service":
-			//     if routes[i].URL == "" { routes[i].URL = config.APIServiceURL } // Use loaded config default
 		}
 	}
 
+	// Server lifecycle: signal handling, readiness and ordered shutdown
+	manager := lifecycle.New(lifecycle.DefaultOptions(logger))
+
 	// Set up Prometheus registry and middleware
 	registry, metricsMiddleware := setupMetrics()
 
+	// Per-user response cache for GET routes, metrics go to the same registry
+	cache := newResponseCache(cfg.Gateway.CacheMaxEntries, registry)
+
 	// Set Gin to release mode for production
 	gin.SetMode(gin.ReleaseMode)
 
 	// Create Gin router
 	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(problem.NoRoute)
+	router.NoMethod(problem.NoMethod)
 
 	// Apply global middleware
-	router.Use(gin.Recovery())
+	router.Use(requestid.Middleware())
+	router.Use(problem.Recovery())
+	router.Use(headerLimitMiddleware(cfg.Gateway.MaxHeaderCount, cfg.Gateway.MaxHeaderBytes))
 	router.Use(loggingMiddleware(logger))
-	router.Use(rateLimitMiddleware(config.RateLimit, time.Duration(config.RateLimitInterval)*time.Second))
+	limiter := newRateLimiter(cfg.Gateway.RateLimit, cfg.Gateway.RateLimitInterval)
+	router.Use(limiter.middleware())
 	router.Use(metricsMiddleware)
 
-	// Health check endpoint (no auth required)
+	// Response compression, outside the cache so cached bodies stay uncompressed
+	compression := newCompressor(cfg.Gateway.CompressionMinSize, cfg.Gateway.MaxDecompressedBytes, registry)
+	router.Use(compression.middleware())
+
+	// Health check endpoint (no auth required), fails while the gateway drains
 	router.GET("/health", func(c *gin.Context) {
+		if !manager.Ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	// Liveness and readiness probes, dependency checks are registered below
+	probes := health.NewRegistry(manager.Ready, 2*time.Second)
+	router.GET("/livez", gin.WrapH(probes.LivenessHandler()))
+	router.GET("/readyz", gin.WrapH(probes.ReadinessHandler()))
+
 	// Metrics endpoint (for Prometheus)
 	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
 
 	// Apply authentication middleware ONLY to the /api/v1 group
 	authGroup := router.Group("/api/v1")
-	authGroup.Use(authMiddleware(config.AuthServiceURL, logger))
+	if cfg.Gateway.MaxInFlight > 0 || cfg.Gateway.MaxStreams > 0 {
+		// Shed load before spending an auth service round trip on the request
+		authGroup.Use(newConcurrencyLimiter(cfg.Gateway.MaxInFlight, cfg.Gateway.MaxStreams, registry).middleware())
+	}
+	authGroup.Use(authMiddleware(cfg.Services.AuthURL, cfg.Gateway.ClientCertAccounts, logger))
+	authGroup.Use(compression.decompressMiddleware())
+
+	// Runtime state for every route, shared with the admin API
+	routeStates := newRouteTable(routes)
+	go runHealthChecks(manager.Context(), routeStates, cfg.Gateway.HealthCheckInterval, logger)
 
-	// (*) Register routes within the main router instance, the group is handled internally by registerRoutes
-	registerRoutes(router, routes, logger)
+	// Every request needs the auth service, upstreams only degrade their own routes
+	if authHealthURL, err := health.EndpointFor(cfg.Services.AuthURL); err == nil {
+		probes.Add(health.HTTP("auth-service", authHealthURL, &http.Client{Timeout: 2 * time.Second}))
+	}
+	for _, state := range routeStates.All() {
+		for _, upstream := range state.upstreams {
+			probes.AddOptional(upstreamChecker(state, upstream))
+		}
+	}
+
+	// Audit log of mutating requests and admin actions, written to postgres in batches
+	var auditWriter *audit.Writer
+	if cfg.Database.Postgres.Enabled() {
+		auditDB, err := postgres.NewClient(context.Background(), cfg.Database.Postgres.ClientConfig())
+		if err != nil {
+			logger.Fatal("Failed to connect to postgres for audit logging", zap.Error(err))
+		}
+		auditWriter = audit.NewWriter(auditDB, audit.Options{
+			BufferSize:    cfg.Audit.BufferSize,
+			BatchSize:     cfg.Audit.BatchSize,
+			FlushInterval: cfg.Audit.FlushInterval,
+			Logger:        logger,
+			Registerer:    registry,
+		})
+		// Closers run in order: queued events are written before the connection closes
+		manager.OnShutdown("flush audit log", auditWriter.Close)
+		manager.OnShutdown("close postgres", func(context.Context) error { return auditDB.Close() })
+		probes.AddOptional(health.Postgres(auditDB))
+
+		// Signed checkpoints of the chain head, a rewritten chain cannot be re-signed without the key
+		var signer *audit.Signer
+		if cfg.Audit.CheckpointKey != "" {
+			signer = audit.NewSigner(cfg.Audit.CheckpointKey)
+			go audit.RunCheckpoints(manager.Context(), auditDB, signer, cfg.Audit.CheckpointInterval, logger)
+		} else {
+			logger.Warn("Audit checkpoint key not set, the audit chain will not be checkpointed")
+		}
+
+		// Monthly partitions are created ahead of time and archived once past retention
+		go audit.RunRetention(manager.Context(), auditDB, audit.RetentionOptions{
+			Retention:       cfg.Audit.Retention,
+			ArchiveDir:      cfg.Audit.ArchiveDir,
+			PartitionsAhead: cfg.Audit.PartitionsAhead,
+			Interval:        cfg.Audit.MaintenanceInterval,
+			Signer:          signer,
+			Logger:          logger,
+		})
+	} else {
+		logger.Warn("Postgres not configured, requests and admin actions will not be audited")
+	}
+
+	// Register proxied routes on the authenticated group
+	registerRoutes(authGroup, routeStates, cache, auditWriter, cfg.Audit.MaxBodyBytes, logger)
+
+	// Admin API on a separate listener with its own credentials
+	if cfg.Gateway.AdminToken != "" {
+		adminServer := &http.Server{
+			Addr: net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Gateway.AdminPort)),
+			Handler: newAdminRouter(&adminHandlers{
+				routes:  routeStates,
+				limiter: limiter,
+				audit:   auditWriter,
+				logger:  logger,
+			}, cfg.Gateway.AdminToken),
+			ReadTimeout:       cfg.Server.Timeout,
+			ReadHeaderTimeout: cfg.Gateway.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.Timeout,
+		}
+		manager.AddServer("admin", adminServer)
+	} else {
+		logger.Warn("Admin token not set, admin API is disabled")
+	}
 
 	// Start server
 	server := &http.Server{
-		Addr:         ":" + config.Port,
-		Handler:      router,
-		ReadTimeout:  time.Duration(config.Timeout) * time.Second,
-		WriteTimeout: time.Duration(config.Timeout) * time.Second,
+		Addr:              cfg.Server.Addr(),
+		Handler:           router,
+		ReadTimeout:       cfg.Server.Timeout,
+		ReadHeaderTimeout: cfg.Gateway.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.Timeout,
+		IdleTimeout:       cfg.Gateway.IdleTimeout,
+		MaxHeaderBytes:    cfg.Gateway.MaxHeaderBytes,
+	}
+
+	if cfg.TLS.Enabled() {
+		tlsConfig, reloader, err := tlsutil.NewServerConfig(cfg.TLS, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", zap.Error(err))
+		}
+		go reloader.Watch(manager.Context())
+		server.TLSConfig = tlsConfig
 	}
+	manager.AddServer("gateway", server)
 
-	logger.Info("Starting API Gateway", zap.String("port", config.Port))
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatal("Server failed", zap.Error(err))
+	logger.Info("Starting API Gateway", zap.String("addr", server.Addr), zap.Bool("tls", cfg.TLS.Enabled()))
+	if err := manager.Run(); err != nil {
+		logger.Fatal("API Gateway shutdown with errors", zap.Error(err))
 	}
+	logger.Info("API Gateway stopped")
 }
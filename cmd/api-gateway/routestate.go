@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/health"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+)
+
+// Route runtime modes controlled through the admin API
+const (
+	routeActive   = "active"
+	routeDraining = "draining"
+	routeDisabled = "disabled"
+)
+
+// UpstreamHealth is the result of the last active health check against a route's upstream
+type UpstreamHealth struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// upstreamState tracks the runtime state of one upstream variant of a route
+type upstreamState struct {
+	Upstream
+	Breaker *circuitBreaker
+
+	healthMu sync.RWMutex
+	health   UpstreamHealth
+}
+
+func (u *upstreamState) Health() UpstreamHealth {
+	u.healthMu.RLock()
+	defer u.healthMu.RUnlock()
+	return u.health
+}
+
+func (u *upstreamState) setHealth(health UpstreamHealth) {
+	u.healthMu.Lock()
+	defer u.healthMu.Unlock()
+	u.health = health
+}
+
+// routeState tracks the runtime state of a registered route
+type routeState struct {
+	ID        string
+	Route     ServiceRoute
+	upstreams []*upstreamState
+
+	mode     atomic.Value // string
+	inFlight atomic.Int64
+}
+
+func newRouteState(route ServiceRoute) *routeState {
+	state := &routeState{
+		ID:    routeID(route.Name),
+		Route: route,
+	}
+	for _, upstream := range route.upstreamsOrDefault() {
+		state.upstreams = append(state.upstreams, &upstreamState{
+			Upstream: upstream,
+			Breaker:  newCircuitBreaker(5, 30*time.Second),
+			health:   UpstreamHealth{Status: "unknown"},
+		})
+	}
+	state.mode.Store(routeActive)
+	return state
+}
+
+// routeID turns a route name such as "Configuration Service" into "configuration-service"
+func routeID(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "-")
+}
+
+func (s *routeState) Mode() string {
+	return s.mode.Load().(string)
+}
+
+func (s *routeState) SetMode(mode string) {
+	s.mode.Store(mode)
+}
+
+// routeModeMiddleware rejects requests for routes that were drained or disabled through the admin
+// API. It runs before the cache, so a disabled route does not keep serving cached responses.
+func routeModeMiddleware(state *routeState) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if mode := state.Mode(); mode != routeActive {
+			problem.Write(c, problem.New(problem.CodeUnavailable, "Route is "+mode).WithRetryAfter(30))
+			return
+		}
+		c.Next()
+	}
+}
+
+// Upstream returns the state of the named variant
+func (s *routeState) Upstream(variant string) (*upstreamState, bool) {
+	for _, upstream := range s.upstreams {
+		if upstream.Variant == variant {
+			return upstream, true
+		}
+	}
+	return nil, false
+}
+
+// Primary returns the first configured upstream, which also serves as the fallback variant
+func (s *routeState) Primary() *upstreamState {
+	return s.upstreams[0]
+}
+
+// routeTable holds the runtime state of all routes in registration order
+type routeTable struct {
+	states []*routeState
+	byID   map[string]*routeState
+}
+
+func newRouteTable(routes []ServiceRoute) *routeTable {
+	table := &routeTable{byID: make(map[string]*routeState, len(routes))}
+	for _, route := range routes {
+		state := newRouteState(route)
+		table.states = append(table.states, state)
+		table.byID[state.ID] = state
+	}
+	return table
+}
+
+func (t *routeTable) Get(id string) (*routeState, bool) {
+	state, ok := t.byID[id]
+	return state, ok
+}
+
+func (t *routeTable) All() []*routeState {
+	return t.states
+}
+
+// checkUpstream performs a single active health check against an upstream
+func checkUpstream(ctx context.Context, client *http.Client, upstream *upstreamState) UpstreamHealth {
+	result := UpstreamHealth{Status: "unhealthy", CheckedAt: time.Now()}
+
+	healthURL, err := health.EndpointFor(upstream.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("health endpoint returned %d", resp.StatusCode)
+		return result
+	}
+	result.Status = "healthy"
+	return result
+}
+
+// upstreamChecker reports the last background health check of an upstream as a readiness check
+func upstreamChecker(state *routeState, upstream *upstreamState) health.Checker {
+	return health.NewChecker(state.ID+"/"+upstream.Variant, func(context.Context) error {
+		if result := upstream.Health(); result.Status != "healthy" {
+			return fmt.Errorf("upstream %s is %s: %s", upstream.URL, result.Status, result.Error)
+		}
+		return nil
+	})
+}
+
+// runHealthChecks probes every upstream on the given interval until ctx is cancelled
+func runHealthChecks(ctx context.Context, table *routeTable, interval time.Duration, logger *zap.Logger) {
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	check := func() {
+		for _, state := range table.All() {
+			for _, upstream := range state.upstreams {
+				health := checkUpstream(ctx, client, upstream)
+				if previous := upstream.Health(); previous.Status != health.Status {
+					logger.Info("Upstream health changed",
+						zap.String("route", state.Route.Name),
+						zap.String("variant", upstream.Variant),
+						zap.String("from", previous.Status),
+						zap.String("to", health.Status),
+						zap.String("error", health.Error),
+					)
+				}
+				upstream.setHealth(health)
+			}
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/lifecycle"
+)
+
+// freeAddr returns a loopback address with no listener on it
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func accepting(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// blockingUpstream answers once release is closed, and reports each request it starts on started
+func blockingUpstream(t *testing.T) (upstream *httptest.Server, started chan struct{}, release chan struct{}) {
+	started, release = make(chan struct{}, 1), make(chan struct{})
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		io.WriteString(w, "upstream done")
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream, started, release
+}
+
+// newGateway returns a manager, not yet running, serving the gateway's handler chain for a route
+// proxying to upstream
+func newGateway(t *testing.T, upstream *httptest.Server, opts lifecycle.Options) (*lifecycle.Manager, string) {
+	router, _ := newTestRouter(upstream)
+	addr := freeAddr(t)
+	m := lifecycle.New(opts)
+	m.AddServer("gateway", &http.Server{Addr: addr, Handler: router})
+	return m, addr
+}
+
+func TestShutdownDrainsInFlightProxiedRequest(t *testing.T) {
+	upstream, started, release := blockingUpstream(t)
+	m, addr := newGateway(t, upstream, lifecycle.Options{ReadinessGracePeriod: 50 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+
+	var mu sync.Mutex
+	var closed []string
+	for _, name := range []string{"postgres", "mongo"} {
+		m.OnShutdown(name, func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			closed = append(closed, name)
+			return nil
+		})
+	}
+
+	ctx, trigger := context.WithCancel(context.Background())
+	defer trigger()
+	runErr := make(chan error, 1)
+	go func() { runErr <- m.RunContext(ctx) }()
+	waitFor(t, "the server to accept connections", func() bool { return accepting(addr) })
+	if !m.Ready() {
+		t.Fatal("not ready after the servers started")
+	}
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/api/v1/configs/slow")
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+	<-started
+
+	// SIGTERM arrives while the proxied request is still waiting on the upstream
+	trigger()
+	waitFor(t, "readiness to fail", func() bool { return !m.Ready() && m.Draining() })
+	waitFor(t, "new connections to be refused", func() bool { return !accepting(addr) })
+
+	select {
+	case r := <-response:
+		t.Fatalf("in-flight request ended before the upstream answered: %+v", r)
+	case err := <-runErr:
+		t.Fatalf("run returned with a request in flight: %v", err)
+	case <-m.Context().Done():
+		t.Fatal("background context cancelled before servers drained")
+	default:
+	}
+	mu.Lock()
+	if len(closed) != 0 {
+		t.Fatalf("closers ran before servers drained: %v", closed)
+	}
+	mu.Unlock()
+
+	close(release)
+	r := <-response
+	if r.err != nil || r.status != http.StatusOK || r.body != "upstream done" {
+		t.Fatalf("in-flight response = %+v, want 200 upstream done", r)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("run returned %v", err)
+	}
+	if m.Context().Err() == nil {
+		t.Fatal("background context not cancelled after shutdown")
+	}
+	if len(closed) != 2 || closed[0] != "postgres" || closed[1] != "mongo" {
+		t.Fatalf("closers ran as %v, want [postgres mongo]", closed)
+	}
+}
+
+func TestShutdownCutsRequestsPastTheDeadline(t *testing.T) {
+	upstream, started, release := blockingUpstream(t)
+	defer close(release)
+	m, addr := newGateway(t, upstream, lifecycle.Options{ShutdownTimeout: 100 * time.Millisecond})
+	closerRan := make(chan struct{})
+	m.OnShutdown("postgres", func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			t.Error("closer got an expired context")
+		}
+		close(closerRan)
+		return nil
+	})
+
+	ctx, trigger := context.WithCancel(context.Background())
+	defer trigger()
+	runErr := make(chan error, 1)
+	go func() { runErr <- m.RunContext(ctx) }()
+	waitFor(t, "the server to accept connections", func() bool { return accepting(addr) })
+
+	requestErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/api/v1/configs/slow")
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		requestErr <- err
+	}()
+	<-started
+
+	trigger()
+	err := <-runErr
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("run returned %v, want the drain deadline", err)
+	}
+	if <-requestErr == nil {
+		t.Fatal("request past the deadline completed, want its connection closed")
+	}
+	select {
+	case <-closerRan:
+	default:
+		t.Fatal("closer did not run after the deadline")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// primaryVariant is the variant name used for routes without explicit upstream groups
+const primaryVariant = "primary"
+
+// upstreamContextKey stores the selected *upstreamState in the gin context
+const upstreamContextKey = "upstream"
+
+// Upstream is one weighted backend variant of a route, e.g. "stable" and "canary"
+type Upstream struct {
+	Variant string `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"` // Relative share of traffic that no rule matched
+}
+
+// Match rule types
+const (
+	matchHeader = "header"
+	matchCookie = "cookie"
+	matchUser   = "user"
+)
+
+// MatchRule pins matching requests to a variant regardless of weights. Rules are evaluated in order.
+type MatchRule struct {
+	Type    string `json:"type"`            // header, cookie or user
+	Name    string `json:"name,omitempty"`  // Header or cookie name, unused for user rules
+	Value   string `json:"value,omitempty"` // Required value, empty matches any value. For user rules, a comma separated list of user IDs
+	Variant string `json:"variant"`
+}
+
+// upstreamsOrDefault returns the route's upstream groups, or its single URL as the primary variant
+func (r ServiceRoute) upstreamsOrDefault() []Upstream {
+	if len(r.Upstreams) > 0 {
+		return r.Upstreams
+	}
+	return []Upstream{{Variant: primaryVariant, URL: r.URL, Weight: 100}}
+}
+
+// matches reports whether the request satisfies the rule
+func (m MatchRule) matches(c *gin.Context) bool {
+	switch m.Type {
+	case matchHeader:
+		value := c.GetHeader(m.Name)
+		return value != "" && (m.Value == "" || value == m.Value)
+	case matchCookie:
+		value, err := c.Cookie(m.Name)
+		return err == nil && (m.Value == "" || value == m.Value)
+	case matchUser:
+		userID := subjectFromContext(c)
+		if userID == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(m.Value, ",") {
+			if strings.TrimSpace(candidate) == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subjectFromContext returns the validated user ID, or an empty string for unauthenticated requests
+func subjectFromContext(c *gin.Context) string {
+	if user, exists := c.Get("user"); exists {
+		if userMap, ok := user.(map[string]interface{}); ok {
+			if sub, ok := userMap["sub"].(string); ok {
+				return sub
+			}
+		}
+	}
+	return ""
+}
+
+// selectUpstream picks the variant for a request: match rules first, then a weighted choice that is
+// sticky per user. Anonymous requests are assigned at random.
+func selectUpstream(state *routeState, c *gin.Context) *upstreamState {
+	for _, rule := range state.Route.Rules {
+		if rule.matches(c) {
+			if upstream, ok := state.Upstream(rule.Variant); ok {
+				return upstream
+			}
+		}
+	}
+
+	if len(state.upstreams) == 1 {
+		return state.Primary()
+	}
+
+	total := 0
+	for _, upstream := range state.upstreams {
+		total += upstream.Weight
+	}
+	if total <= 0 {
+		return state.Primary()
+	}
+
+	var bucket int
+	if userID := subjectFromContext(c); userID != "" {
+		h := fnv.New32a()
+		h.Write([]byte(state.ID + "/" + userID))
+		bucket = int(h.Sum32() % uint32(total))
+	} else {
+		bucket = rand.Intn(total)
+	}
+
+	for _, upstream := range state.upstreams {
+		if bucket < upstream.Weight {
+			return upstream
+		}
+		bucket -= upstream.Weight
+	}
+	return state.Primary()
+}
+
+// upstreamSelectionMiddleware chooses the upstream variant before caching and proxying so both see the same choice
+func upstreamSelectionMiddleware(state *routeState) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upstream := selectUpstream(state, c)
+		c.Set(upstreamContextKey, upstream)
+		c.Set("variant", upstream.Variant)
+		c.Next()
+	}
+}
+
+// selectedUpstream returns the upstream chosen for this request, defaulting to the primary
+func selectedUpstream(state *routeState, c *gin.Context) *upstreamState {
+	if value, exists := c.Get(upstreamContextKey); exists {
+		if upstream, ok := value.(*upstreamState); ok {
+			return upstream
+		}
+	}
+	return state.Primary()
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/audit"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/authz"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+
+	// exportWriteTimeout replaces the server write timeout for exports, which may stream many rows
+	exportWriteTimeout = 10 * time.Minute
+	// exportFlushEvery is how many rows are written between flushes to the client
+	exportFlushEvery = 500
+)
+
+// auditHandlers serves the audit log to auditors
+type auditHandlers struct {
+	dbClient *postgres.Client
+	signer   *audit.Signer // nil when no checkpoint key is configured
+	logger   *zap.Logger
+}
+
+// auditLogView is the API representation of an audit log entry
+type auditLogView struct {
+	ID           int64           `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UserID       *int            `json:"user_id"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceName string          `json:"resource_name"`
+	Namespace    string          `json:"namespace"`
+	Status       string          `json:"status"`
+	Message      string          `json:"message,omitempty"`
+	ClientIP     string          `json:"client_ip,omitempty"`
+	RequestData  json.RawMessage `json:"request_data,omitempty"`
+	EntryHash    string          `json:"entry_hash,omitempty"`
+}
+
+func newAuditLogView(log postgres.AuditLog) auditLogView {
+	view := auditLogView{
+		ID:           log.ID,
+		CreatedAt:    log.CreatedAt.UTC(),
+		Action:       log.Action,
+		ResourceType: log.ResourceType,
+		ResourceName: log.ResourceName,
+		Namespace:    log.Namespace,
+		Status:       log.Status,
+		Message:      log.Message,
+		ClientIP:     log.ClientIP,
+		EntryHash:    log.EntryHash,
+	}
+	if log.UserID != 0 {
+		view.UserID = &log.UserID
+	}
+	if log.RequestData != "" {
+		view.RequestData = json.RawMessage(log.RequestData)
+	}
+	return view
+}
+
+// registerAuditRoutes adds the audit log endpoints, restricted to the auditor role
+func (h *auditHandlers) registerAuditRoutes(r *gin.RouterGroup) {
+	group := r.Group("/audit", authz.RequireRole(authz.RoleAuditor))
+	group.GET("/logs", h.listAuditLogs)
+	group.GET("/logs/export", h.exportAuditLogs)
+	group.GET("/verify", h.verifyAuditChain)
+}
+
+// verifyAuditChain handles GET /audit/verify, walking the whole hash chain. It answers 200 with
+// valid=false and the first broken link when tampering is detected.
+func (h *auditHandlers) verifyAuditChain(c *gin.Context) {
+	controller := http.NewResponseController(c.Writer)
+	if err := controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+		h.logger.Warn("Could not extend the write deadline for audit verification", zap.Error(err))
+	}
+
+	report, err := audit.Verify(c.Request.Context(), h.dbClient, h.signer)
+	if err != nil {
+		h.logger.Error("Failed to verify audit chain", zap.Error(err))
+		problem.AbortError(c, err, "Audit log")
+		return
+	}
+	if !report.Valid {
+		h.logger.Warn("Audit chain verification failed",
+			zap.Int64("log_id", report.FirstBroken.LogID),
+			zap.String("reason", report.FirstBroken.Reason),
+		)
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// listAuditLogs handles GET /audit/logs, one page at a time, newest first
+func (h *auditHandlers) listAuditLogs(c *gin.Context) {
+	filter, p := parseAuditFilter(c)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	filter.Limit = defaultAuditPageSize
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditPageSize {
+			problem.Write(c, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+				Field:   "limit",
+				Message: fmt.Sprintf("must be a number between 1 and %d", maxAuditPageSize),
+			}))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	// Fetch one extra row to know whether another page exists
+	pageSize := filter.Limit
+	filter.Limit++
+	logs, err := h.dbClient.ListAuditLogs(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("Failed to list audit logs", zap.Error(err))
+		problem.AbortError(c, err, "Audit log")
+		return
+	}
+
+	response := struct {
+		Items      []auditLogView `json:"items"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+	}{Items: make([]auditLogView, 0, len(logs))}
+	if len(logs) > pageSize {
+		logs = logs[:pageSize]
+		last := logs[len(logs)-1]
+		response.NextCursor = encodeAuditCursor(postgres.AuditCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	for _, log := range logs {
+		response.Items = append(response.Items, newAuditLogView(log))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// exportAuditLogs handles GET /audit/logs/export, streaming every matching entry as CSV or NDJSON.
+// The format comes from ?format=csv|ndjson, then the Accept header, and defaults to NDJSON.
+func (h *auditHandlers) exportAuditLogs(c *gin.Context) {
+	filter, p := parseAuditFilter(c)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format = "ndjson"
+		if strings.Contains(c.GetHeader("Accept"), "text/csv") {
+			format = "csv"
+		}
+	}
+
+	var encode func(postgres.AuditLog) error
+	var flush func() error
+	switch format {
+	case "ndjson":
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		encode = func(log postgres.AuditLog) error { return encoder.Encode(newAuditLogView(log)) }
+		flush = func() error { return nil }
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		// csv.Writer buffers, so the header reaches the client with the first rows
+		writer := csv.NewWriter(c.Writer)
+		writer.Write(auditCSVHeader)
+		encode = func(log postgres.AuditLog) error { return writer.Write(auditCSVRecord(log)) }
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	default:
+		problem.Write(c, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+			Field:   "format",
+			Message: "must be one of: csv ndjson",
+		}))
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-logs-%s.%s"`, time.Now().UTC().Format("20060102T150405Z"), format))
+
+	controller := http.NewResponseController(c.Writer)
+	if err := controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+		h.logger.Warn("Could not extend the write deadline for the audit export", zap.Error(err))
+	}
+
+	rows := 0
+	err := h.dbClient.StreamAuditLogs(c.Request.Context(), filter, func(log postgres.AuditLog) error {
+		if err := encode(log); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		h.logger.Error("Audit export failed", zap.Int("rows", rows), zap.Error(err))
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Disposition")
+			problem.AbortError(c, err, "Audit log")
+		}
+		// Once rows have been sent the status cannot change, the truncated body is the signal
+		return
+	}
+	if !c.Writer.Written() {
+		c.Status(http.StatusOK)
+	}
+	h.logger.Info("Exported audit logs", zap.String("format", format), zap.Int("rows", rows), zap.String("user_id", c.GetHeader(authz.UserIDHeader)))
+}
+
+var auditCSVHeader = []string{
+	"id", "created_at", "user_id", "action", "resource_type", "resource_name",
+	"namespace", "status", "message", "client_ip", "request_data",
+}
+
+func auditCSVRecord(log postgres.AuditLog) []string {
+	userID := ""
+	if log.UserID != 0 {
+		userID = strconv.Itoa(log.UserID)
+	}
+	return []string{
+		strconv.FormatInt(log.ID, 10),
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		userID,
+		log.Action,
+		log.ResourceType,
+		log.ResourceName,
+		log.Namespace,
+		log.Status,
+		log.Message,
+		log.ClientIP,
+		log.RequestData,
+	}
+}
+
+// parseAuditFilter reads the filter query parameters shared by listing and export
+func parseAuditFilter(c *gin.Context) (postgres.AuditFilter, *problem.Problem) {
+	filter := postgres.AuditFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		Namespace:    c.Query("namespace"),
+		Status:       c.Query("status"),
+	}
+	var fields []problem.FieldError
+
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil || userID < 1 {
+			fields = append(fields, problem.FieldError{Field: "user_id", Message: "must be a positive number"})
+		}
+		filter.UserID = userID
+	}
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if value := c.Query(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				fields = append(fields, problem.FieldError{Field: param.name, Message: "must be an RFC 3339 timestamp"})
+				continue
+			}
+			*param.dst = t
+		}
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		fields = append(fields, problem.FieldError{Field: "until", Message: "must be after since"})
+	}
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeAuditCursor(value)
+		if err != nil {
+			fields = append(fields, problem.FieldError{Field: "cursor", Message: "is not a valid cursor"})
+		}
+		filter.After = cursor
+	}
+
+	if len(fields) > 0 {
+		return filter, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(fields...)
+	}
+	return filter, nil
+}
+
+// encodeAuditCursor makes an opaque cursor from the position of the last row of a page
+func encodeAuditCursor(cursor postgres.AuditCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixMicro(), 10) + ":" + strconv.FormatInt(cursor.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeAuditCursor(value string) (*postgres.AuditCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	cursorID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &postgres.AuditCursor{CreatedAt: time.UnixMicro(createdAt).UTC(), ID: cursorID}, nil
+}
@@ -7,9 +7,19 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/audit"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/config"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/mongodb"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/health"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/lifecycle"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/tlsutil"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
@@ -17,7 +27,6 @@ import (
 
 // ServiceConfig holds the configuration for the REST API service
 type ServiceConfig struct {
-	Port                 string
 	DeploymentServiceURL string
 	MonitoringServiceURL string
 	ConfigServiceURL     string
@@ -33,31 +42,19 @@ type ServiceClient struct {
 	config           ServiceConfig
 }
 
-// NewServiceConfig loads configuration from environment variables
-func NewServiceConfig() ServiceConfig {
+// NewServiceConfig takes the service URLs and timeout from the loaded configuration
+func NewServiceConfig(cfg *config.Config) ServiceConfig {
 	return ServiceConfig{
-		Port:                 os.Getenv("PORT"),
-		DeploymentServiceURL: os.Getenv("DEPLOYMENT_SERVICE_URL"),
-		MonitoringServiceURL: os.Getenv("MONITORING_SERVICE_URL"),
-		ConfigServiceURL:     os.Getenv("CONFIG_SERVICE_URL"),
-		Timeout:              30 * time.Second,
+		DeploymentServiceURL: cfg.Services.DeploymentURL,
+		MonitoringServiceURL: cfg.Services.MonitoringURL,
+		ConfigServiceURL:     cfg.Services.ConfigURL,
+		Timeout:              cfg.Server.Timeout,
 	}
 }
 
 // NewServiceClient creates clients for interacting with microservices
-func NewServiceClient(logger *zap.Logger) *ServiceClient {
-	config := NewServiceConfig()
-
-	// Set default URLs if env vars are empty
-	if config.DeploymentServiceURL == "" {
-		config.DeploymentServiceURL = os.Getenv("DEPLOYMENT_SERVICE_URL")
-	}
-	if config.MonitoringServiceURL == "" {
-		config.MonitoringServiceURL = os.Getenv("MONITORING_SERVICE_URL")
-	}
-	if config.ConfigServiceURL == "" {
-		config.ConfigServiceURL = os.Getenv("CONFIG_SERVICE_URL")
-	}
+func NewServiceClient(cfg *config.Config, logger *zap.Logger) *ServiceClient {
+	config := NewServiceConfig(cfg)
 
 	logger.Info("Service URLs",
 		zap.String("deployment", config.DeploymentServiceURL),
@@ -126,6 +123,8 @@ func extractServiceFromPath(path string) string {
 		return "monitoring"
 	case path == "/api/configs":
 		return "configuration"
+	case strings.HasPrefix(path, "/api/v1/audit"):
+		return "audit"
 	default:
 		return "unknown"
 	}
@@ -155,7 +154,7 @@ func (sc *ServiceClient) proxyRequest(targetBaseUrl string) gin.HandlerFunc {
 		req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, c.Request.Body)
 		if err != nil {
 			sc.logger.Error("Failed to create proxy request", zap.Error(err), zap.String("targetURL", targetURL))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error creating proxy request"})
+			problem.Abort(c, problem.CodeInternal, "Failed to create proxy request")
 
 			return
 		}
@@ -168,7 +167,7 @@ func (sc *ServiceClient) proxyRequest(targetBaseUrl string) gin.HandlerFunc {
 		resp, err := client.Do(req)
 		if err != nil {
 			sc.logger.Error("Proxy request failed", zap.Error(err), zap.String("target", targetURL))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Service Unavailable: %s", targetBaseUrl)})
+			problem.Abort(c, problem.CodeUnavailable, "Upstream service is unavailable")
 
 			return
 		}
@@ -210,13 +209,22 @@ func (sc *ServiceClient) registerConfigRoutes(r *gin.RouterGroup) {
 }
 
 func main() {
+	// Load configuration: config.yaml, then environment variables, then flags
+	cfg, err := config.Load("api-server", os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	// Initialize logger
-	logger, err := zap.NewProduction()
+	logger, err := config.NewLogger(cfg.Logging)
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Sync()
 
+	// Server lifecycle: signal handling, readiness and ordered shutdown
+	manager := lifecycle.New(lifecycle.DefaultOptions(logger))
+
 	// Set up Prometheus registry and middleware
 	registry, metricsMiddleware := setupMetrics()
 
@@ -225,11 +233,23 @@ func main() {
 
 	// Create Gin router
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(problem.NoRoute)
+	router.NoMethod(problem.NoMethod)
+	router.Use(requestid.Middleware())
+	router.Use(problem.Recovery())
 	router.Use(metricsMiddleware)
 
 	// Health check endpoint
+	probes := health.NewRegistry(manager.Ready, 2*time.Second)
+	router.GET("/livez", gin.WrapH(probes.LivenessHandler()))
+	router.GET("/readyz", gin.WrapH(probes.ReadinessHandler()))
+
 	router.GET("/health", func(c *gin.Context) {
+		if !manager.Ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
@@ -237,7 +257,40 @@ func main() {
 	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
 
 	// Service client for interacting with microservices
-	serviceClient := NewServiceClient(logger)
+	serviceClient := NewServiceClient(cfg, logger)
+
+	// Connect to the databases when configured, closed in this order on shutdown
+	var dbClient *postgres.Client
+	if cfg.Database.Postgres.Enabled() {
+		dbClient, err = postgres.NewClient(context.Background(), cfg.Database.Postgres.ClientConfig())
+		if err != nil {
+			logger.Fatal("Failed to connect to postgres", zap.Error(err))
+		}
+		logger.Info("Successfully connected to postgres")
+		manager.OnShutdown("close postgres", func(context.Context) error { return dbClient.Close() })
+		probes.Add(health.Postgres(dbClient))
+	}
+	if cfg.Database.MongoDB.Enabled() {
+		mongoClient, err := mongodb.NewClient(context.Background(), cfg.Database.MongoDB.ClientConfig())
+		if err != nil {
+			logger.Fatal("Failed to connect to mongodb", zap.Error(err))
+		}
+		logger.Info("Successfully connected to mongodb")
+		manager.OnShutdown("close mongodb", mongoClient.Close)
+		probes.Add(health.Mongo(mongoClient))
+	}
+
+	// Proxied services only degrade the routes that depend on them
+	checkClient := &http.Client{Timeout: 2 * time.Second}
+	for _, upstream := range []struct{ name, baseURL string }{
+		{"deployment-service", cfg.Services.DeploymentURL},
+		{"monitoring-service", cfg.Services.MonitoringURL},
+		{"config-service", cfg.Services.ConfigURL},
+	} {
+		if healthURL, err := health.EndpointFor(upstream.baseURL); err == nil {
+			probes.AddOptional(health.HTTP(upstream.name, healthURL, checkClient))
+		}
+	}
 
 	// API routes group
 	apiRoutes := router.Group("/api/v1") // Base path for API Server's own endpoints if any, or just groups
@@ -245,18 +298,43 @@ func main() {
 		serviceClient.registerDeploymentRoutes(apiRoutes)
 		serviceClient.registerMonitoringRoutes(apiRoutes)
 		serviceClient.registerConfigRoutes(apiRoutes)
+
+		// The audit log is read from postgres directly
+		if dbClient != nil {
+			auditAPI := &auditHandlers{dbClient: dbClient, logger: logger}
+			if cfg.Audit.CheckpointKey != "" {
+				auditAPI.signer = audit.NewSigner(cfg.Audit.CheckpointKey)
+			} else {
+				logger.Warn("Audit checkpoint key not set, checkpoint signatures will not be verified")
+			}
+			auditAPI.registerAuditRoutes(apiRoutes)
+		} else {
+			logger.Warn("Postgres not configured, audit log endpoints are disabled")
+		}
 	}
 
 	// Start server
 	server := &http.Server{
-		Addr:         ":" + serviceClient.config.Port,
+		Addr:         cfg.Server.Addr(),
 		Handler:      router,
-		ReadTimeout:  serviceClient.config.Timeout,
-		WriteTimeout: serviceClient.config.Timeout,
+		ReadTimeout:  cfg.Server.Timeout,
+		WriteTimeout: cfg.Server.Timeout,
+	}
+
+	// Optional TLS for internal traffic
+	if cfg.TLS.Enabled() {
+		tlsConfig, reloader, err := tlsutil.NewServerConfig(cfg.TLS, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", zap.Error(err))
+		}
+		go reloader.Watch(manager.Context())
+		server.TLSConfig = tlsConfig
 	}
+	manager.AddServer("api", server)
 
-	logger.Info("Starting REST API Service", zap.String("port", serviceClient.config.Port))
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatal("Server failed", zap.Error(err))
+	logger.Info("Starting REST API Service", zap.String("addr", server.Addr))
+	if err := manager.Run(); err != nil {
+		logger.Fatal("REST API Service shutdown with errors", zap.Error(err))
 	}
+	logger.Info("REST API Service stopped")
 }
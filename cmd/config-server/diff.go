@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/pmezard/go-difflib/difflib"
+	"go.uber.org/zap"
+)
+
+// Output formats of GET /configs/:name/diff
+const (
+	diffFormatJSON      = "json"
+	diffFormatJSONPatch = "json-patch" // RFC 6902, turns from into to
+	diffFormatUnified   = "unified"    // Unified diff of the pretty-printed documents
+)
+
+// diffContextLines is the number of unchanged lines around each hunk of a unified diff
+const diffContextLines = 3
+
+// Kinds of change in a JSON diff, named after the JSON Patch operations that would make them
+const (
+	changeAdd     = "add"
+	changeRemove  = "remove"
+	changeReplace = "replace"
+)
+
+// jsonChange is one difference between two JSON documents. Old is omitted for additions and New for
+// removals, a JSON null is kept.
+type jsonChange struct {
+	Op   string          `json:"op"`
+	Path string          `json:"path"` // JSON Pointer
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// decodeJSON parses a document keeping numbers exact
+func decodeJSON(data string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// diffJSON lists the changes that turn from into to. Objects are compared key by key in key order
+// and arrays element by element, so only the values that differ are reported. Numbers are compared
+// by value, 1 and 1.0 are equal.
+func diffJSON(from, to interface{}) []jsonChange {
+	var changes []jsonChange
+	diffValue(from, to, "", &changes)
+	return changes
+}
+
+func diffValue(from, to interface{}, path string, changes *[]jsonChange) {
+	switch f := from.(type) {
+	case map[string]interface{}:
+		if t, ok := to.(map[string]interface{}); ok {
+			diffObject(f, t, path, changes)
+			return
+		}
+	case []interface{}:
+		if t, ok := to.([]interface{}); ok {
+			diffArray(f, t, path, changes)
+			return
+		}
+	default:
+		if jsonEqual(from, to) {
+			return
+		}
+	}
+	*changes = append(*changes, jsonChange{Op: changeReplace, Path: path, Old: rawJSON(from), New: rawJSON(to)})
+}
+
+func diffObject(from, to map[string]interface{}, path string, changes *[]jsonChange) {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		pointer := path + "/" + escapePointer(key)
+		oldValue, inFrom := from[key]
+		newValue, inTo := to[key]
+		switch {
+		case !inTo:
+			*changes = append(*changes, jsonChange{Op: changeRemove, Path: pointer, Old: rawJSON(oldValue)})
+		case !inFrom:
+			*changes = append(*changes, jsonChange{Op: changeAdd, Path: pointer, New: rawJSON(newValue)})
+		default:
+			diffValue(oldValue, newValue, pointer, changes)
+		}
+	}
+}
+
+// diffArray compares elements at the same index. Trailing elements are removed from the end first,
+// so that the changes apply in order as a JSON Patch.
+func diffArray(from, to []interface{}, path string, changes *[]jsonChange) {
+	common := len(from)
+	if len(to) < common {
+		common = len(to)
+	}
+	for i := 0; i < common; i++ {
+		diffValue(from[i], to[i], path+"/"+strconv.Itoa(i), changes)
+	}
+	for i := len(from) - 1; i >= common; i-- {
+		*changes = append(*changes, jsonChange{Op: changeRemove, Path: path + "/" + strconv.Itoa(i), Old: rawJSON(from[i])})
+	}
+	for i := common; i < len(to); i++ {
+		*changes = append(*changes, jsonChange{Op: changeAdd, Path: path + "/" + strconv.Itoa(i), New: rawJSON(to[i])})
+	}
+}
+
+// jsonEqual compares two scalars, or a scalar with a container, as decoded by decodeJSON
+func jsonEqual(a, b interface{}) bool {
+	an, aIsNumber := a.(json.Number)
+	bn, bIsNumber := b.(json.Number)
+	if aIsNumber && bIsNumber {
+		x, okX := new(big.Rat).SetString(an.String())
+		y, okY := new(big.Rat).SetString(bn.String())
+		if okX && okY {
+			return x.Cmp(y) == 0
+		}
+		return an == bn
+	}
+	switch a.(type) {
+	case nil, bool, string:
+		return a == b
+	}
+	return false
+}
+
+func rawJSON(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+// jsonPatchOperation is one operation of an RFC 6902 JSON Patch
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// jsonPatchFor converts a diff into a JSON Patch. diffJSON orders array changes so that the
+// operations apply one after the other.
+func jsonPatchFor(changes []jsonChange) []jsonPatchOperation {
+	patch := make([]jsonPatchOperation, len(changes))
+	for i, change := range changes {
+		patch[i] = jsonPatchOperation{Op: change.Op, Path: change.Path, Value: change.New}
+	}
+	return patch
+}
+
+// unifiedDiff compares the documents pretty-printed with sorted keys, so that only content
+// differences show, not formatting or key order
+func unifiedDiff(from, to interface{}, fromLabel, toLabel string) (string, error) {
+	fromText, err := json.MarshalIndent(from, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	toText, err := json.MarshalIndent(to, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(fromText) + "\n"),
+		B:        difflib.SplitLines(string(toText) + "\n"),
+		FromFile: fromLabel,
+		ToFile:   toLabel,
+		Context:  diffContextLines,
+	})
+}
+
+// diffSummary counts the changes of each kind
+type diffSummary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+func summarize(changes []jsonChange) diffSummary {
+	var summary diffSummary
+	for _, change := range changes {
+		switch change.Op {
+		case changeAdd:
+			summary.Added++
+		case changeRemove:
+			summary.Removed++
+		default:
+			summary.Changed++
+		}
+	}
+	return summary
+}
+
+// diffSideParam reads one side of a diff from the query: <side>_namespace, defaulting to
+// ?namespace, and <side>_version, where zero means the current version
+func diffSideParam(c *gin.Context, side string) (string, int, *problem.Problem) {
+	namespace := c.Query(side + "_namespace")
+	if namespace == "" {
+		namespace = c.DefaultQuery("namespace", "default")
+	}
+	version := 0
+	if raw := c.Query(side + "_version"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 {
+			return "", 0, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+				Field:   side + "_version",
+				Message: "must be a positive number",
+			})
+		}
+		version = v
+	}
+	return namespace, version, nil
+}
+
+// loadDiffSide returns the data of a config at a version, or its current data when version is zero
+func (h *Handlers) loadDiffSide(ctx context.Context, name, namespace string, userID, version int) (configLayer, interface{}, error) {
+	layer := configLayer{Namespace: namespace, Name: name, Version: version}
+	var data string
+	if version == 0 {
+		config, err := h.dbClient.GetApplicationConfigByNameAndNamespace(ctx, name, namespace, userID)
+		if err != nil {
+			return layer, nil, err
+		}
+		layer.Version, data = config.Version, config.ConfigData
+	} else {
+		v, err := h.dbClient.GetApplicationConfigVersion(ctx, name, namespace, userID, version)
+		if err != nil {
+			return layer, nil, err
+		}
+		data = v.ConfigData
+	}
+	value, err := decodeJSON(data)
+	if err != nil {
+		return layer, nil, err
+	}
+	return layer, value, nil
+}
+
+// diffApplicationConfig handles GET /configs/:name/diff. Each side is a version of the config in a
+// namespace, chosen with from_namespace and from_version, and to_namespace and to_version. Omitted
+// namespaces default to ?namespace and omitted versions to the current one, so two versions are
+// compared with ?from_version=3&to_version=5 and two namespaces with ?from_namespace=dev&to_namespace=prod.
+// ?format picks a JSON list of changes (default), an RFC 6902 JSON Patch or a unified diff.
+func (h *Handlers) diffApplicationConfig(c *gin.Context) {
+	name := c.Param("name")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	format := c.DefaultQuery("format", diffFormatJSON)
+	switch format {
+	case diffFormatJSON, diffFormatJSONPatch, diffFormatUnified:
+	default:
+		problem.Write(c, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+			Field:   "format",
+			Message: "must be one of " + strings.Join([]string{diffFormatJSON, diffFormatJSONPatch, diffFormatUnified}, " "),
+		}))
+		return
+	}
+	fromNamespace, fromVersion, p := diffSideParam(c, "from")
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+	toNamespace, toVersion, p := diffSideParam(c, "to")
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	var sides [2]configLayer
+	var values [2]interface{}
+	for i, side := range []struct {
+		namespace string
+		version   int
+	}{{fromNamespace, fromVersion}, {toNamespace, toVersion}} {
+		layer, value, err := h.loadDiffSide(c.Request.Context(), name, side.namespace, userID, side.version)
+		if err != nil {
+			resource := "Application config"
+			if side.version != 0 {
+				resource = "Application config version"
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				h.logger.Warn("Failed to load config for diff", zap.Error(err), zap.String("name", name), zap.String("namespace", side.namespace), zap.Int("version", side.version))
+			}
+			problem.AbortError(c, err, resource)
+			return
+		}
+		sides[i], values[i] = layer, value
+	}
+
+	changes := diffJSON(values[0], values[1])
+	if changes == nil {
+		changes = []jsonChange{}
+	}
+	switch format {
+	case diffFormatJSONPatch:
+		c.Header("Content-Type", mediaTypeJSONPatch)
+		c.JSON(http.StatusOK, jsonPatchFor(changes))
+	case diffFormatUnified:
+		label := func(l configLayer) string {
+			return configKey(l.Namespace, l.Name) + "@" + strconv.Itoa(l.Version)
+		}
+		text, err := unifiedDiff(values[0], values[1], label(sides[0]), label(sides[1]))
+		if err != nil {
+			h.logger.Warn("Failed to render unified diff", zap.Error(err), zap.String("name", name))
+			problem.AbortError(c, err, "Application config")
+			return
+		}
+		c.Data(http.StatusOK, "text/x-diff; charset=utf-8", []byte(text))
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"from":    sides[0],
+			"to":      sides[1],
+			"summary": summarize(changes),
+			"changes": changes,
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+)
+
+// configETag formats the revision of a config as an entity tag, "<id>.<version>"
+func configETag(id, version int) string {
+	return fmt.Sprintf(`"%d.%d"`, id, version)
+}
+
+// setConfigETag returns the revision of config to the client
+func setConfigETag(c *gin.Context, config *postgres.ApplicationConfig) {
+	c.Header("ETag", configETag(config.ID, config.Version))
+}
+
+// bodyETag tags a derived representation, such as a resolved config, by its content. It never
+// parses as a revision, so it cannot be used in If-Match to change a config.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// parseConfigETag reads a revision from an entity tag. The weak prefix the gateway adds when it
+// compresses a response is accepted, the tag names a version rather than exact bytes.
+func parseConfigETag(tag string) (postgres.ConfigRevision, bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return postgres.ConfigRevision{}, false
+	}
+	var revision postgres.ConfigRevision
+	if _, err := fmt.Sscanf(tag[1:len(tag)-1], "%d.%d", &revision.ID, &revision.Version); err != nil {
+		return postgres.ConfigRevision{}, false
+	}
+	if configETag(revision.ID, revision.Version) != tag || revision.ID < 1 || revision.Version < 1 {
+		return postgres.ConfigRevision{}, false
+	}
+	return revision, true
+}
+
+// configPrecondition reads the revision a change must apply to from If-Match. "*" and ?force=true
+// skip the check. When required, a request with neither gets 428 so that a client cannot overwrite
+// a concurrent change by accident.
+func configPrecondition(c *gin.Context, required bool) (postgres.ConfigRevision, *problem.Problem) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" {
+		if !required || c.Query("force") == "true" {
+			return postgres.ConfigRevision{}, nil
+		}
+		return postgres.ConfigRevision{}, problem.New(problem.CodePreconditionRequired,
+			"Send the ETag of the config you read in If-Match, or add ?force=true to overwrite unconditionally")
+	}
+	if ifMatch == "*" {
+		return postgres.ConfigRevision{}, nil
+	}
+	if strings.Contains(ifMatch, ",") {
+		return postgres.ConfigRevision{}, problem.New(problem.CodeBadRequest, "If-Match must carry a single entity tag")
+	}
+	revision, ok := parseConfigETag(ifMatch)
+	if !ok {
+		// A tag this service never issued cannot match the current revision
+		return postgres.ConfigRevision{}, problem.New(problem.CodePreconditionFailed, "If-Match does not name a revision of this config")
+	}
+	return revision, nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the export endpoints
+const (
+	exportFormatYAML = "yaml" // Multi-document YAML
+	exportFormatJSON = "json" // A v1 List
+)
+
+// secretKeyword marks a property of a config schema whose value belongs in a Secret
+const secretKeyword = "x-secret"
+
+// rootEntryKey holds a config whose data is not an object
+const rootEntryKey = "config.json"
+
+// Limits from Kubernetes object validation
+const (
+	maxManifestNameLength = 253
+	maxExportSeparator    = 8
+	maxManifestDataBytes  = 1 << 20 // Keys and values of one ConfigMap or Secret together
+)
+
+var (
+	configMapKeyPattern   = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+	invalidManifestNameRe = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+// manifestMetadata is the metadata of an exported object. Nothing in it changes unless the config
+// does, so repeated exports of the same version are byte for byte identical.
+type manifestMetadata struct {
+	Name        string            `json:"name" yaml:"name"`
+	Namespace   string            `json:"namespace" yaml:"namespace"`
+	Labels      map[string]string `json:"labels" yaml:"labels"`
+	Annotations map[string]string `json:"annotations" yaml:"annotations"`
+}
+
+// manifest is a ConfigMap or Secret. Maps are written with sorted keys by both encoders.
+type manifest struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Metadata   manifestMetadata  `json:"metadata" yaml:"metadata"`
+	Type       string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Data       map[string]string `json:"data" yaml:"data"`
+}
+
+// exportOptions control how config data becomes ConfigMap keys
+type exportOptions struct {
+	format       string
+	flatten      bool   // Nested objects become one key per leaf
+	separator    string // Joins the keys of nested objects when flattening
+	k8sNamespace string // metadata.namespace, defaults to the config namespace
+}
+
+// exportEntry is one ConfigMap or Secret key
+type exportEntry struct {
+	key     string
+	pointer string // JSON Pointer of the value in the config data
+	value   string
+}
+
+// exportOptionsFrom reads ?format, ?flatten, ?separator and ?k8s_namespace
+func exportOptionsFrom(c *gin.Context) (exportOptions, *problem.Problem) {
+	opts := exportOptions{
+		format:       c.DefaultQuery("format", exportFormatYAML),
+		flatten:      true,
+		separator:    c.DefaultQuery("separator", "."),
+		k8sNamespace: c.Query("k8s_namespace"),
+	}
+	var fields []problem.FieldError
+	if opts.format != exportFormatYAML && opts.format != exportFormatJSON {
+		fields = append(fields, problem.FieldError{Field: "format", Message: "must be one of yaml json"})
+	}
+	if raw := c.Query("flatten"); raw != "" {
+		flatten, err := strconv.ParseBool(raw)
+		if err != nil {
+			fields = append(fields, problem.FieldError{Field: "flatten", Message: "must be true or false"})
+		}
+		opts.flatten = flatten
+	}
+	if len(opts.separator) > maxExportSeparator || !configMapKeyPattern.MatchString(opts.separator) {
+		fields = append(fields, problem.FieldError{Field: "separator", Message: "must be 1 to 8 of the characters allowed in ConfigMap keys"})
+	}
+	if opts.k8sNamespace != "" && manifestName(opts.k8sNamespace) != opts.k8sNamespace {
+		fields = append(fields, problem.FieldError{Field: "k8s_namespace", Message: "must be a valid Kubernetes namespace name"})
+	}
+	if len(fields) > 0 {
+		return opts, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(fields...)
+	}
+	return opts, nil
+}
+
+// manifestName turns a config name into a Kubernetes object name: lower case, with runs of other
+// characters replaced by a dash
+func manifestName(name string) string {
+	name = invalidManifestNameRe.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-.")
+	if len(name) > maxManifestNameLength {
+		name = strings.TrimRight(name[:maxManifestNameLength], "-.")
+	}
+	return name
+}
+
+// flattenConfig turns config data into ConfigMap entries in key order. Values that are not strings
+// are written as JSON, so numbers keep their exact text. Data that is not an object is exported
+// whole under config.json.
+func flattenConfig(data interface{}, opts exportOptions) []exportEntry {
+	object, ok := data.(map[string]interface{})
+	if !ok {
+		return []exportEntry{{key: rootEntryKey, value: entryValue(data)}}
+	}
+	var entries []exportEntry
+	var walk func(object map[string]interface{}, keyPrefix, pointerPrefix string)
+	walk = func(object map[string]interface{}, keyPrefix, pointerPrefix string) {
+		for key, value := range object {
+			entryKey, pointer := keyPrefix+key, pointerPrefix+"/"+escapePointer(key)
+			if nested, ok := value.(map[string]interface{}); ok && opts.flatten && len(nested) > 0 {
+				walk(nested, entryKey+opts.separator, pointer)
+				continue
+			}
+			entries = append(entries, exportEntry{key: entryKey, pointer: pointer, value: entryValue(value)})
+		}
+	}
+	walk(object, "", "")
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries
+}
+
+func entryValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// secretPointers collects the JSON Pointers of the properties a schema marks with "x-secret": true.
+// Properties are followed through allOf, anyOf and oneOf, references are not.
+func secretPointers(schema interface{}, pointer string, out map[string]bool) {
+	node, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if secret, _ := node[secretKeyword].(bool); secret {
+		out[pointer] = true
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		branches, _ := node[keyword].([]interface{})
+		for _, branch := range branches {
+			secretPointers(branch, pointer, out)
+		}
+	}
+	properties, _ := node["properties"].(map[string]interface{})
+	for name, property := range properties {
+		secretPointers(property, pointer+"/"+escapePointer(name), out)
+	}
+}
+
+// isSecret reports whether an entry holds a secret value, either because it sits beneath a secret
+// property or because, unflattened, it contains one
+func isSecret(pointer string, secrets map[string]bool) bool {
+	for secret := range secrets {
+		if pointer == secret || secret == "" || strings.HasPrefix(pointer, secret+"/") || strings.HasPrefix(secret, pointer+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// configManifests renders one config as a ConfigMap and, when its schema marks secret keys, a Secret
+// named <name>-secret. Configs with bases are exported resolved, as the application would see them.
+func (h *Handlers) configManifests(ctx context.Context, config *postgres.ApplicationConfig, schemas []postgres.ConfigSchema, opts exportOptions) ([]manifest, error) {
+	source := configKey(config.Namespace, config.Name)
+	var data interface{}
+	if len(config.Bases) > 0 {
+		resolved, err := h.resolveConfig(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		data = resolved.Data
+	} else {
+		value, err := decodeJSON(config.ConfigData)
+		if err != nil {
+			return nil, err
+		}
+		data = value
+	}
+
+	secrets := map[string]bool{}
+	if schema := matchSchema(schemas, config.Name); schema != nil {
+		document, err := decodeJSON(schema.Schema)
+		if err != nil {
+			return nil, err
+		}
+		secretPointers(document, "", secrets)
+	}
+
+	name := manifestName(config.Name)
+	if name == "" {
+		return nil, problem.Newf(problem.CodeValidation, "Config %s has no characters usable in a Kubernetes name", source)
+	}
+	namespace := opts.k8sNamespace
+	if namespace == "" {
+		namespace = manifestName(config.Namespace)
+	}
+	metadata := func(name string) manifestMetadata {
+		return manifestMetadata{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "config-server"},
+			Annotations: map[string]string{
+				"config-server/source":  source,
+				"config-server/version": strconv.Itoa(config.Version),
+			},
+		}
+	}
+	configMap := manifest{APIVersion: "v1", Kind: "ConfigMap", Metadata: metadata(name), Data: map[string]string{}}
+	secret := manifest{APIVersion: "v1", Kind: "Secret", Metadata: metadata(name + "-secret"), Type: "Opaque", Data: map[string]string{}}
+
+	var fields []problem.FieldError
+	var configMapBytes, secretBytes int
+	for _, entry := range flattenConfig(data, opts) {
+		if len(entry.key) > maxManifestNameLength || !configMapKeyPattern.MatchString(entry.key) {
+			fields = append(fields, problem.FieldError{Field: source + entry.pointer, Message: "key " + strconv.Quote(entry.key) + " is not a valid ConfigMap key"})
+			continue
+		}
+		if _, taken := configMap.Data[entry.key]; taken {
+			fields = append(fields, problem.FieldError{Field: source + entry.pointer, Message: "key " + strconv.Quote(entry.key) + " is produced twice"})
+			continue
+		}
+		if _, taken := secret.Data[entry.key]; taken {
+			fields = append(fields, problem.FieldError{Field: source + entry.pointer, Message: "key " + strconv.Quote(entry.key) + " is produced twice"})
+			continue
+		}
+		if isSecret(entry.pointer, secrets) {
+			secret.Data[entry.key] = base64.StdEncoding.EncodeToString([]byte(entry.value))
+			secretBytes += len(entry.key) + len(entry.value)
+		} else {
+			configMap.Data[entry.key] = entry.value
+			configMapBytes += len(entry.key) + len(entry.value)
+		}
+	}
+	// Kubernetes would reject the object when it is applied
+	if configMapBytes > maxManifestDataBytes {
+		fields = append(fields, problem.FieldError{Field: source, Message: "ConfigMap data is " + strconv.Itoa(configMapBytes) + " bytes, Kubernetes allows at most 1 MiB"})
+	}
+	if secretBytes > maxManifestDataBytes {
+		fields = append(fields, problem.FieldError{Field: source, Message: "Secret data is " + strconv.Itoa(secretBytes) + " bytes, Kubernetes allows at most 1 MiB"})
+	}
+	if len(fields) > 0 {
+		sortFieldErrors(fields)
+		return nil, problem.Newf(problem.CodeValidation, "Config %s cannot be exported as a ConfigMap", source).WithFields(fields...)
+	}
+
+	var manifests []manifest
+	if len(configMap.Data) > 0 || len(secret.Data) == 0 {
+		manifests = append(manifests, configMap)
+	}
+	if len(secret.Data) > 0 {
+		manifests = append(manifests, secret)
+	}
+	return manifests, nil
+}
+
+// writeManifests encodes manifests in the requested format. A response carrying a Secret must not
+// be kept by the gateway or any other cache.
+func writeManifests(c *gin.Context, manifests []manifest, format string) {
+	for _, m := range manifests {
+		if m.Kind == "Secret" {
+			c.Header("Cache-Control", "no-store")
+			break
+		}
+	}
+	var buf bytes.Buffer
+	if format == exportFormatJSON {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(gin.H{"apiVersion": "v1", "kind": "List", "items": manifests}); err != nil {
+			problem.AbortError(c, err, "Application config")
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", buf.Bytes())
+		return
+	}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, m := range manifests {
+		if err := encoder.Encode(m); err != nil {
+			problem.AbortError(c, err, "Application config")
+			return
+		}
+	}
+	encoder.Close()
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", buf.Bytes())
+}
+
+// exportApplicationConfig handles GET /configs/:name/export, rendering one config as Kubernetes
+// manifests. See exportApplicationConfigs for the options.
+func (h *Handlers) exportApplicationConfig(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	opts, p := exportOptionsFrom(c)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+	config, err := h.dbClient.GetApplicationConfigByNameAndNamespace(c.Request.Context(), name, namespace, userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to get application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+	schemas, err := h.dbClient.ListConfigSchemas(c.Request.Context(), namespace)
+	if err != nil {
+		h.logger.Warn("Failed to list config schemas", zap.Error(err), zap.String("namespace", namespace))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+
+	manifests, err := h.configManifests(c.Request.Context(), config, schemas, opts)
+	if err != nil {
+		var p *problem.Problem
+		if !errors.As(err, &p) {
+			h.logger.Warn("Failed to export application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+	writeManifests(c, manifests, opts.format)
+}
+
+// exportApplicationConfigs handles GET /configs/export, rendering every config of the caller in
+// ?namespace as a ConfigMap, plus a Secret for the keys its schema marks with "x-secret": true.
+// Configs come out in name order and keys in key order. ?flatten=false keeps nested objects as
+// JSON values of their top-level key, otherwise they are flattened into one key per leaf, joined
+// by ?separator (default "."). ?format is yaml (default) or json, and ?k8s_namespace overrides
+// metadata.namespace.
+func (h *Handlers) exportApplicationConfigs(c *gin.Context) {
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	opts, p := exportOptionsFrom(c)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+	configs, err := h.dbClient.ListApplicationConfigs(c.Request.Context(), namespace, userID)
+	if err != nil {
+		h.logger.Warn("Failed to list application configs", zap.Error(err), zap.String("namespace", namespace))
+		problem.Abort(c, problem.CodeInternal, "Failed to list application configs")
+		return
+	}
+	schemas, err := h.dbClient.ListConfigSchemas(c.Request.Context(), namespace)
+	if err != nil {
+		h.logger.Warn("Failed to list config schemas", zap.Error(err), zap.String("namespace", namespace))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].Name < configs[j].Name })
+
+	manifests := []manifest{}
+	owners := map[string]string{} // Object name to the config it came from
+	for i := range configs {
+		config := &configs[i]
+		rendered, err := h.configManifests(c.Request.Context(), config, schemas, opts)
+		if err != nil {
+			var p *problem.Problem
+			if !errors.As(err, &p) {
+				h.logger.Warn("Failed to export application config", zap.Error(err), zap.String("name", config.Name), zap.String("namespace", namespace))
+			}
+			problem.AbortError(c, err, "Application config")
+			return
+		}
+		for _, m := range rendered {
+			key := m.Kind + "/" + m.Metadata.Name
+			if owner, taken := owners[key]; taken {
+				problem.Write(c, problem.Newf(problem.CodeValidation, "Configs %s and %s both export as %s", owner, config.Name, key))
+				return
+			}
+			owners[key] = config.Name
+		}
+		manifests = append(manifests, rendered...)
+	}
+	writeManifests(c, manifests, opts.format)
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Input formats of the import endpoint
+const (
+	importFormatConfigMap  = "configmap"  // Multi-document YAML of ConfigMaps, or a v1 List
+	importFormatDotenv     = "dotenv"     // KEY=VALUE lines
+	importFormatProperties = "properties" // Java properties
+)
+
+// Limits on one import, it runs in a single transaction. The gateway allows import bodies of the
+// same size.
+const (
+	maxImportSize    = 10 << 20
+	maxImportConfigs = 500
+)
+
+// importUnsupportedKind is the reason a document that is not a ConfigMap is skipped
+const importUnsupportedKind = "unsupported_kind"
+
+var dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// importOptions are the query parameters of an import
+type importOptions struct {
+	format    string
+	name      string // Config name of a dotenv or properties file
+	namespace string // Namespace of a file, or of ConfigMaps without metadata.namespace
+	separator string // Splits keys into nested objects when set
+	overwrite bool   // Update configs that exist with different data
+	dryRun    bool
+	message   string
+}
+
+// importedObject is a document of a ConfigMap import. Items is set on a v1 List, as written by
+// the export endpoint with format=json.
+type importedObject struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+	BinaryData map[string]string `yaml:"binaryData"`
+	Items      []importedObject  `yaml:"items"`
+}
+
+// importEntry is one config, or one skipped document, of an import
+type importEntry struct {
+	document int // 1-based position in the input
+	kind     string
+	config   postgres.ApplicationConfig
+	skipped  bool
+}
+
+// importItemView reports the outcome of one entry
+type importItemView struct {
+	Document  int    `json:"document"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Action    string `json:"action"`
+	Reason    string `json:"reason,omitempty"`
+	Version   int    `json:"version,omitempty"` // Version stored, or that would be with dry_run
+}
+
+// importOptionsFrom reads ?format, ?name, ?namespace, ?separator, ?overwrite, ?dry_run and ?message
+func importOptionsFrom(c *gin.Context) (importOptions, *problem.Problem) {
+	opts := importOptions{
+		format:    c.DefaultQuery("format", importFormatConfigMap),
+		name:      c.Query("name"),
+		namespace: c.DefaultQuery("namespace", "default"),
+		separator: c.Query("separator"),
+		overwrite: true,
+		message:   c.DefaultQuery("message", "Imported"),
+	}
+	var fields []problem.FieldError
+	switch opts.format {
+	case importFormatConfigMap:
+	case importFormatDotenv, importFormatProperties:
+		if opts.name == "" {
+			fields = append(fields, problem.FieldError{Field: "name", Message: "is required for " + opts.format + " files"})
+		} else if fe := reservedNameError("name", opts.name); fe != nil {
+			fields = append(fields, *fe)
+		}
+	default:
+		fields = append(fields, problem.FieldError{Field: "format", Message: "must be one of configmap dotenv properties"})
+	}
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{{"overwrite", &opts.overwrite}, {"dry_run", &opts.dryRun}} {
+		raw := c.Query(flag.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			fields = append(fields, problem.FieldError{Field: flag.name, Message: "must be true or false"})
+		}
+		*flag.value = value
+	}
+	if len(opts.message) > maxChangeMessage {
+		fields = append(fields, problem.FieldError{Field: "message", Message: "must be at most " + strconv.Itoa(maxChangeMessage) + " characters"})
+	}
+	if len(fields) > 0 {
+		return opts, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(fields...)
+	}
+	return opts, nil
+}
+
+// parseConfigMaps turns each ConfigMap of a multi-document YAML stream into an entry. Lists are
+// expanded, empty documents ignored, and documents of other kinds, Secrets included, are skipped.
+func parseConfigMaps(body []byte, opts importOptions) ([]importEntry, []problem.FieldError) {
+	var entries []importEntry
+	var fields []problem.FieldError
+	seen := map[string]int{} // Document that imports each config
+	var add func(document int, object *importedObject)
+	add = func(document int, object *importedObject) {
+		field := fmt.Sprintf("document %d", document)
+		switch {
+		case object.Kind == "List":
+			for i := range object.Items {
+				add(document, &object.Items[i])
+			}
+			return
+		case object.Kind != "ConfigMap":
+			entries = append(entries, importEntry{document: document, kind: object.Kind, skipped: true, config: postgres.ApplicationConfig{
+				Name:      object.Metadata.Name,
+				Namespace: object.Metadata.Namespace,
+			}})
+			return
+		case object.Metadata.Name == "":
+			fields = append(fields, problem.FieldError{Field: field, Message: "metadata.name is required"})
+			return
+		case reservedConfigNames[object.Metadata.Name]:
+			fields = append(fields, *reservedNameError(field, object.Metadata.Name))
+			return
+		case len(object.BinaryData) > 0:
+			fields = append(fields, problem.FieldError{Field: field, Message: "binaryData cannot be imported"})
+			return
+		}
+		data, errs := importedData(object.Data, opts.separator, field)
+		if len(errs) > 0 {
+			fields = append(fields, errs...)
+			return
+		}
+		namespace := object.Metadata.Namespace
+		if namespace == "" {
+			namespace = opts.namespace
+		}
+		key := configKey(namespace, object.Metadata.Name)
+		if first, taken := seen[key]; taken {
+			fields = append(fields, problem.FieldError{Field: field, Message: fmt.Sprintf("config %s is also imported by document %d", key, first)})
+			return
+		}
+		seen[key] = document
+		entries = append(entries, importEntry{document: document, kind: object.Kind, config: postgres.ApplicationConfig{
+			Name:       object.Metadata.Name,
+			Namespace:  namespace,
+			ConfigData: data,
+		}})
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	for document := 1; ; document++ {
+		var object importedObject
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// The decoder cannot continue past a syntax error
+			fields = append(fields, problem.FieldError{Field: fmt.Sprintf("document %d", document), Message: err.Error()})
+			break
+		}
+		if object.Kind == "" && object.Metadata.Name == "" && object.Data == nil {
+			continue
+		}
+		add(document, &object)
+	}
+	return entries, fields
+}
+
+// parseDotenv reads KEY=VALUE lines. Lines may start with export, # starts a comment, and values
+// may be quoted. Double-quoted values may span lines and understand \n, \r, \t, \" and \\ escapes,
+// single-quoted values are taken literally. Variables are not expanded, and a repeated key keeps
+// its last value.
+func parseDotenv(body []byte) (map[string]string, []problem.FieldError) {
+	data := map[string]string{}
+	var fields []problem.FieldError
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !dotenvKeyPattern.MatchString(key) {
+			fields = append(fields, problem.FieldError{Field: fmt.Sprintf("line %d", number), Message: "expected KEY=VALUE"})
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		var rest string
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// Take further lines until the closing quote
+			text := value[1:]
+			for {
+				end := closingQuote(text)
+				if end >= 0 {
+					value, rest = unescapeDotenv(text[:end]), text[end+1:]
+					break
+				}
+				if i+1 >= len(lines) {
+					fields = append(fields, problem.FieldError{Field: fmt.Sprintf("line %d", number), Message: "unterminated double-quoted value"})
+					return data, fields
+				}
+				i++
+				text += "\n" + lines[i]
+			}
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				fields = append(fields, problem.FieldError{Field: fmt.Sprintf("line %d", number), Message: "unterminated single-quoted value"})
+				continue
+			}
+			value, rest = value[1:end+1], value[end+2:]
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = value[:comment]
+			}
+			value = strings.TrimSpace(value)
+		}
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			fields = append(fields, problem.FieldError{Field: fmt.Sprintf("line %d", number), Message: "unexpected text after the closing quote"})
+			continue
+		}
+		data[key] = value
+	}
+	return data, fields
+}
+
+// closingQuote finds the first double quote in s that is not escaped, -1 when there is none
+func closingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// parseProperties reads a Java properties file. Keys end at the first unescaped =, : or white
+// space, lines ending in an odd number of backslashes continue on the next line, and # or ! start a
+// comment. The file is read as UTF-8 rather than ISO 8859-1, \uXXXX escapes work either way. A
+// repeated key keeps its last value.
+func parseProperties(body []byte) (map[string]string, []problem.FieldError) {
+	data := map[string]string{}
+	var fields []problem.FieldError
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continues(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if continues(line) {
+			line = line[:len(line)-1]
+		}
+
+		// The key ends at the first unescaped separator, which may be surrounded by white space
+		end := len(line)
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", line[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+		rawKey, value := line[:end], strings.TrimLeft(line[end:], " \t\f")
+		if value != "" && (value[0] == '=' || value[0] == ':') {
+			value = strings.TrimLeft(value[1:], " \t\f")
+		}
+		key, err := unescapeProperty(rawKey)
+		if err == nil {
+			value, err = unescapeProperty(value)
+		}
+		if err != nil {
+			fields = append(fields, problem.FieldError{Field: fmt.Sprintf("line %d", number), Message: err.Error()})
+			continue
+		}
+		data[key] = value
+	}
+	return data, fields
+}
+
+// continues reports whether a properties line ends in an odd number of backslashes
+func continues(line string) bool {
+	n := 0
+	for n < len(line) && line[len(line)-1-n] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", errors.New(`malformed \uXXXX escape`)
+			}
+			code, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", errors.New(`malformed \uXXXX escape`)
+			}
+			b.WriteRune(rune(code))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// importedData turns string entries into config data. With a separator, keys are split into nested
+// objects, so that db.host=x becomes {"db": {"host": "x"}}, reversing a flattened export.
+func importedData(entries map[string]string, separator, field string) (string, []problem.FieldError) {
+	for key, value := range entries {
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			return "", []problem.FieldError{{Field: field, Message: "keys and values must be UTF-8"}}
+		}
+	}
+	data := map[string]interface{}{}
+	if separator == "" {
+		for key, value := range entries {
+			data[key] = value
+		}
+		return string(rawJSON(data)), nil
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var fields []problem.FieldError
+	for _, key := range keys {
+		parts := strings.Split(key, separator)
+		object := data
+		parent := ""
+		for i, part := range parts[:len(parts)-1] {
+			next, exists := object[part]
+			if !exists {
+				child := map[string]interface{}{}
+				object[part], object = child, child
+				continue
+			}
+			child, ok := next.(map[string]interface{})
+			if !ok {
+				parent = strings.Join(parts[:i+1], separator)
+				break
+			}
+			object = child
+		}
+		// Keys are sorted, so a value is always placed before the keys that would nest beneath it
+		if parent != "" {
+			fields = append(fields, problem.FieldError{Field: field, Message: "key " + strconv.Quote(key) + " nests beneath " + strconv.Quote(parent) + ", which holds a value"})
+			continue
+		}
+		object[parts[len(parts)-1]] = entries[key]
+	}
+	if len(fields) > 0 {
+		return "", fields
+	}
+	return string(rawJSON(data)), nil
+}
+
+// parseImport turns the request body into entries in input order
+func parseImport(body []byte, opts importOptions) ([]importEntry, []problem.FieldError) {
+	if opts.format == importFormatConfigMap {
+		return parseConfigMaps(body, opts)
+	}
+	var entries map[string]string
+	var fields []problem.FieldError
+	if opts.format == importFormatDotenv {
+		entries, fields = parseDotenv(body)
+	} else {
+		entries, fields = parseProperties(body)
+	}
+	if len(fields) > 0 {
+		return nil, fields
+	}
+	data, fields := importedData(entries, opts.separator, "document 1")
+	if len(fields) > 0 {
+		return nil, fields
+	}
+	return []importEntry{{document: 1, config: postgres.ApplicationConfig{Name: opts.name, Namespace: opts.namespace, ConfigData: data}}}, nil
+}
+
+// checkImport validates each config to be written against its schema, with the bases it has when
+// it exists already, and reports every failure at once
+func (h *Handlers) checkImport(ctx context.Context, entries []importEntry) error {
+	var fields []problem.FieldError
+	for i := range entries {
+		if entries[i].skipped {
+			continue
+		}
+		check := entries[i].config
+		source := configKey(check.Namespace, check.Name)
+		current, err := h.dbClient.GetApplicationConfigByNameAndNamespace(ctx, check.Name, check.Namespace, check.UserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		check.Bases = current.Bases
+		_, err = h.checkConfig(ctx, &check)
+		var p *problem.Problem
+		if err != nil && !errors.As(err, &p) {
+			return err
+		}
+		if p == nil {
+			continue
+		}
+		if len(p.Errors) == 0 {
+			fields = append(fields, problem.FieldError{Field: source, Message: p.Detail})
+		}
+		for _, fe := range p.Errors {
+			fields = append(fields, problem.FieldError{Field: source + "/" + fe.Field, Message: fe.Message})
+		}
+	}
+	if len(fields) > 0 {
+		sortFieldErrors(fields)
+		return problem.New(problem.CodeValidation, "Imported configs do not match their schemas").WithFields(fields...)
+	}
+	return nil
+}
+
+// importApplicationConfigs handles POST /configs/import. The body is a multi-document YAML of
+// ConfigMaps (?format=configmap, the default), or a single dotenv or Java properties file that
+// becomes the config ?name. Each ConfigMap becomes the config named by metadata.name in
+// metadata.namespace, or in ?namespace when it has none. Values are imported as strings, and
+// ?separator splits keys into nested objects. Configs that do not exist are created, configs whose
+// data differs are updated unless ?overwrite=false, and equal ones are skipped, as are documents
+// that are not ConfigMaps. Everything is checked against the schemas first and then written in one
+// transaction, so nothing is applied unless all of it is. ?dry_run=true reports the same outcomes
+// without keeping any change. Its inserts are rolled back, but sequences are not transactional, so a
+// dry run still uses up the application_configs ids the created configs would have had.
+func (h *Handlers) importApplicationConfigs(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	opts, p := importOptionsFrom(c)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Abort(c, problem.CodePayloadTooLarge, "An import may be at most "+strconv.Itoa(maxImportSize>>20)+" MiB")
+			return
+		}
+		h.logger.Warn("Failed to read import body", zap.Error(err))
+		problem.Abort(c, problem.CodeBadRequest, "Failed to read the request body")
+		return
+	}
+
+	entries, fields := parseImport(body, opts)
+	imports := make([]postgres.ConfigImport, 0, len(entries))
+	for i := range entries {
+		if !entries[i].skipped {
+			entries[i].config.UserID = userID
+			imports = append(imports, postgres.ConfigImport{Config: entries[i].config})
+		}
+	}
+	if len(imports) > maxImportConfigs {
+		fields = append(fields, problem.FieldError{Field: "body", Message: "must hold at most " + strconv.Itoa(maxImportConfigs) + " configs"})
+	}
+	if len(fields) > 0 {
+		problem.Write(c, problem.New(problem.CodeValidation, "The import cannot be read").WithFields(fields...))
+		return
+	}
+
+	if err := h.checkImport(c.Request.Context(), entries); err != nil {
+		var p *problem.Problem
+		if errors.As(err, &p) {
+			h.logger.Info("Rejected config import", zap.String("reason", p.Detail), zap.Int("fields", len(p.Errors)))
+		} else {
+			h.logger.Warn("Failed to check config import", zap.Error(err))
+		}
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+
+	if err := h.dbClient.ImportApplicationConfigs(c.Request.Context(), imports, opts.overwrite, opts.dryRun, opts.message); err != nil {
+		if postgres.IsUniqueConstraintViolation(err) {
+			// Created concurrently after the row lookup
+			h.logger.Info("Config import raced with a create", zap.Error(err))
+			problem.Write(c, problem.New(problem.CodeConflict, "A config was created while the import ran, retry the import"))
+			return
+		}
+		h.logger.Warn("Failed to import application configs", zap.Error(err))
+		problem.Abort(c, problem.CodeInternal, "Failed to import application configs")
+		return
+	}
+
+	counts := map[string]int{postgres.ImportCreated: 0, postgres.ImportUpdated: 0, postgres.ImportSkipped: 0}
+	items := make([]importItemView, 0, len(entries))
+	next := 0
+	for _, entry := range entries {
+		item := importItemView{Document: entry.document, Kind: entry.kind, Name: entry.config.Name, Namespace: entry.config.Namespace}
+		if entry.skipped {
+			item.Action, item.Reason = postgres.ImportSkipped, importUnsupportedKind
+		} else {
+			imported := imports[next]
+			next++
+			item.Action, item.Reason, item.Version = imported.Action, imported.Reason, imported.Config.Version
+		}
+		counts[item.Action]++
+		items = append(items, item)
+	}
+
+	h.logger.Info("Imported application configs",
+		zap.String("format", opts.format),
+		zap.Bool("dry_run", opts.dryRun),
+		zap.Int("created", counts[postgres.ImportCreated]),
+		zap.Int("updated", counts[postgres.ImportUpdated]),
+		zap.Int("skipped", counts[postgres.ImportSkipped]),
+	)
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": opts.dryRun,
+		"created": counts[postgres.ImportCreated],
+		"updated": counts[postgres.ImportUpdated],
+		"skipped": counts[postgres.ImportSkipped],
+		"items":   items,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,47 +13,20 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/audit"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/config"
 	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres" // (+) Import postgres package
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/health"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/lifecycle"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/tlsutil"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
-// Config holds the configuration for the Config Service
-type Config struct {
-	Port    string
-	DBHost  string
-	DBPort  int
-	DBUser  string
-	DBPass  string
-	DBName  string
-	SSLMode string
-	Timeout time.Duration
-}
-
-// loadConfig loads configuration from environment variables
-func loadConfig() Config {
-	dbPort, _ := strconv.Atoi(os.Getenv("DB_PORT"))
-	if dbPort == 0 {
-		dbPort = 5432 // Default PostgreSQL port
-	}
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8082" // Default port for config service
-	}
-
-	return Config{
-		Port:    port,
-		DBHost:  os.Getenv("DB_HOST"),
-		DBPort:  dbPort,
-		DBUser:  os.Getenv("DB_USER"),
-		DBPass:  os.Getenv("DB_PASSWORD"),
-		DBName:  os.Getenv("DB_NAME"),
-		SSLMode: os.Getenv("DB_SSLMODE"),
-		Timeout: 30 * time.Second,
-	}
-}
-
 // setupMetrics initializes Prometheus metrics
 func setupMetrics() (*prometheus.Registry, gin.HandlerFunc) {
 	registry := prometheus.NewRegistry()
@@ -92,16 +66,40 @@ func setupMetrics() (*prometheus.Registry, gin.HandlerFunc) {
 	return registry, metricsMiddleware
 }
 
-// ApplicationConfigCreateRequest represents the data needed to create/update a config
+// ApplicationConfigCreateRequest represents the data needed to create a config
 type ApplicationConfigCreateRequest struct {
-	Name       string          `json:"name" binding:"required"`
-	Namespace  string          `json:"namespace" binding:"required"`
-	ConfigData json.RawMessage `json:"configData" binding:"required"` // keep as RawMessage
+	Name       string               `json:"name" binding:"required"`
+	Namespace  string               `json:"namespace" binding:"required"`
+	ConfigData json.RawMessage      `json:"configData" binding:"required"` // keep as RawMessage
+	Bases      postgres.ConfigBases `json:"bases"`                         // Configs merged beneath this one, in order
+	Message    string               `json:"message" binding:"max=500"`     // Change message recorded with the version
+}
+
+// ApplicationConfigUpdateRequest replaces the data of a config, name and namespace come from the URL.
+// The bases are replaced only when given.
+type ApplicationConfigUpdateRequest struct {
+	ConfigData json.RawMessage      `json:"configData" binding:"required"`
+	Bases      postgres.ConfigBases `json:"bases"`
+	Message    string               `json:"message" binding:"max=500"`
+}
+
+// reservedConfigNames are the actions routed beside /configs/:name. A config with one of these
+// names could be written but never read back, GET /configs/<name> reaches the action instead.
+var reservedConfigNames = map[string]bool{"validate": true, "import": true, "watch": true, "export": true}
+
+// reservedNameError reports name as a field error when it is reserved, nil otherwise
+func reservedNameError(field, name string) *problem.FieldError {
+	if !reservedConfigNames[name] {
+		return nil
+	}
+	return &problem.FieldError{Field: field, Message: strconv.Quote(name) + " is reserved for the /configs/" + name + " endpoint"}
 }
 
 // Handlers struct to hold dependencies like DB client and logger
 type Handlers struct {
 	dbClient *postgres.Client
+	schemas  *schemaCache
+	events   *eventHub
 	logger   *zap.Logger
 }
 
@@ -110,7 +108,11 @@ func (h *Handlers) createApplicationConfig(c *gin.Context) {
 	var req ApplicationConfigCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Warn("Failed to bind JSON for create config", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body" + err.Error()})
+		problem.Write(c, problem.FromBindError(err))
+		return
+	}
+	if fe := reservedNameError("name", req.Name); fe != nil {
+		problem.Write(c, problem.New(problem.CodeValidation, "The config name is reserved").WithFields(*fe))
 		return
 	}
 
@@ -129,20 +131,32 @@ func (h *Handlers) createApplicationConfig(c *gin.Context) {
 		Namespace:  req.Namespace,
 		UserID:     userID,                 // Use the extracted userID
 		ConfigData: string(req.ConfigData), // Store JSON as string
+		Bases:      req.Bases,
 	}
 
-	if err := h.dbClient.CreateApplicationConfig(c.Request.Context(), appConfig); err != nil {
+	if _, err := h.checkConfig(c.Request.Context(), appConfig); err != nil {
+		h.logger.Info("Rejected application config", zap.String("name", req.Name), zap.String("namespace", req.Namespace), zap.Error(err))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+
+	message := req.Message
+	if message == "" {
+		message = "Created"
+	}
+	if err := h.dbClient.CreateApplicationConfig(c.Request.Context(), appConfig, message); err != nil {
 		h.logger.Warn("Failed to create application config", zap.Error(err))
 		// Handle potential unique constraint violation
 		if postgres.IsUniqueConstraintViolation(err) {
-			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Configuration with name %s in namespace '%s' already exists for this user", req.Name, req.Namespace)})
+			problem.Write(c, problem.Newf(problem.CodeConflict, "Configuration with name %s in namespace '%s' already exists for this user", req.Name, req.Namespace))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create configuration"})
+			problem.Abort(c, problem.CodeInternal, "Failed to create configuration")
 		}
 		return
 	}
 
 	h.logger.Info("Successfully created application config", zap.String("name", appConfig.Name), zap.String("namespace", appConfig.Namespace))
+	setConfigETag(c, appConfig)
 	c.JSON(http.StatusCreated, appConfig)
 }
 
@@ -155,19 +169,21 @@ func (h *Handlers) listApplicationConfigs(c *gin.Context) {
 	configs, err := h.dbClient.ListApplicationConfigs(c.Request.Context(), namespace, userID) // Pass userID
 	if err != nil {
 		h.logger.Warn("Failed to list application configs", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list application configs"})
+		problem.Abort(c, problem.CodeInternal, "Failed to list application configs")
 		return
 	}
 
 	// Convert ConfigData back to JSON object for response
 	type ResponseConfig struct {
-		ID         int             `json:"id"`
-		Name       string          `json:"name"`
-		Namespace  string          `json:"namespace"`
-		UserID     int             `json:"user_id"`
-		ConfigData json.RawMessage `json:"config_data"`
-		CreatedAt  time.Time       `json:"created_at"`
-		UpdatedAt  time.Time       `json:"updated_at"`
+		ID         int                  `json:"id"`
+		Name       string               `json:"name"`
+		Namespace  string               `json:"namespace"`
+		UserID     int                  `json:"user_id"`
+		ConfigData json.RawMessage      `json:"config_data"`
+		Bases      postgres.ConfigBases `json:"bases"`
+		Version    int                  `json:"version"`
+		CreatedAt  time.Time            `json:"created_at"`
+		UpdatedAt  time.Time            `json:"updated_at"`
 	}
 
 	responseConfigs := make([]ResponseConfig, len(configs))
@@ -178,6 +194,8 @@ func (h *Handlers) listApplicationConfigs(c *gin.Context) {
 			Namespace:  cfg.Namespace,
 			UserID:     cfg.UserID,
 			ConfigData: json.RawMessage(cfg.ConfigData), // Convert stringback to RawMessage
+			Bases:      cfg.Bases,
+			Version:    cfg.Version,
 			CreatedAt:  cfg.CreatedAt,
 			UpdatedAt:  cfg.UpdatedAt,
 		}
@@ -196,25 +214,27 @@ func (h *Handlers) getApplicationConfig(c *gin.Context) {
 
 	config, err := h.dbClient.GetApplicationConfigByNameAndNamespace(c.Request.Context(), name, namespace, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			h.logger.Warn("Application config not found", zap.String("name", name), zap.String("namespace", namespace))
-			c.JSON(http.StatusNotFound, gin.H{"error": "Application config not found"})
+			problem.AbortError(c, err, "Application config")
 		} else {
 			h.logger.Warn("Failed to get application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get application config"})
+			problem.Abort(c, problem.CodeInternal, "Failed to get application config")
 		}
 		return
 	}
 
 	// Convert ConfigData back to JSON object for response
 	type ResponseConfig struct {
-		ID         int             `json:"id"`
-		Name       string          `json:"name"`
-		Namespace  string          `json:"namespace"`
-		UserID     int             `json:"user_id"`
-		ConfigData json.RawMessage `json:"config_data"`
-		CreatedAt  time.Time       `json:"created_at"`
-		UpdatedAt  time.Time       `json:"updated_at"`
+		ID         int                  `json:"id"`
+		Name       string               `json:"name"`
+		Namespace  string               `json:"namespace"`
+		UserID     int                  `json:"user_id"`
+		ConfigData json.RawMessage      `json:"config_data"`
+		Bases      postgres.ConfigBases `json:"bases"`
+		Version    int                  `json:"version"`
+		CreatedAt  time.Time            `json:"created_at"`
+		UpdatedAt  time.Time            `json:"updated_at"`
 	}
 	response := ResponseConfig{
 		ID:         config.ID,
@@ -222,11 +242,14 @@ func (h *Handlers) getApplicationConfig(c *gin.Context) {
 		Namespace:  config.Namespace,
 		UserID:     config.UserID,
 		ConfigData: json.RawMessage(config.ConfigData),
+		Bases:      config.Bases,
+		Version:    config.Version,
 		CreatedAt:  config.CreatedAt,
 		UpdatedAt:  config.UpdatedAt,
 	}
 
 	h.logger.Info("Successfully retrieved application config", zap.String("name", name), zap.String("namespace", namespace), zap.Int("count", len(response.ConfigData)))
+	setConfigETag(c, config)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -237,72 +260,85 @@ func (h *Handlers) updateApplicationConfig(c *gin.Context) {
 	userIDStr := c.GetHeader("X-User-ID")
 	userID, _ := strconv.Atoi(userIDStr)
 
-	var req ApplicationConfigCreateRequest // Reuse create request struct for update
-	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Warn("Failed to bind JSON for update config", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body" + err.Error()})
+	expected, p := configPrecondition(c, true)
+	if p != nil {
+		problem.Write(c, p)
 		return
 	}
 
-	// Ensure the name/namespace in URL match the body (or ignore body values)
-	if req.Name != name || req.Namespace != namespace {
-		// c.JSON(http.StatusBadRequest, gin.H{"error": "Name/Namespace in URL and body must match"})
-		// return
-		// Or prioritize URL params
-		req.Name = name
-		req.Namespace = namespace
+	// Name and namespace in the body, if any, are ignored in favour of the URL
+	var req ApplicationConfigUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Failed to bind JSON for update config", zap.Error(err))
+		problem.Write(c, problem.FromBindError(err))
+		return
 	}
 
 	appConfig := &postgres.ApplicationConfig{
-		Name:       req.Name,
-		Namespace:  req.Namespace,
+		Name:       name,
+		Namespace:  namespace,
 		UserID:     userID, // Use the extracted userID for check
 		ConfigData: string(req.ConfigData),
+		Bases:      req.Bases, // Nil keeps the stored bases
 	}
 
-	err := h.dbClient.UpdateApplicationConfig(c.Request.Context(), appConfig)
+	message := req.Message
+	if message == "" {
+		message = "Updated"
+	}
+	// The new data is checked against the bases of the locked row, the update keeps them unless it
+	// brings its own
+	err := h.dbClient.UpdateApplicationConfig(c.Request.Context(), appConfig, expected, message,
+		func(candidate *postgres.ApplicationConfig) error {
+			_, err := h.checkConfig(c.Request.Context(), candidate)
+			return err
+		})
 	if err != nil {
-		if err == sql.ErrNoRows {
+		var p *problem.Problem
+		if errors.As(err, &p) {
+			h.logger.Info("Rejected application config", zap.String("name", name), zap.String("namespace", namespace), zap.String("reason", p.Detail))
+			problem.AbortError(c, err, "Config schema")
+		} else if errors.Is(err, sql.ErrNoRows) {
 			h.logger.Warn("Attempted to update non-existent config", zap.String("name", name), zap.String("namespace", namespace))
-			c.JSON(http.StatusNotFound, gin.H{"error": "Application config not found"})
+			problem.AbortError(c, err, "Application config")
+		} else if errors.Is(err, postgres.ErrConfigVersionMismatch) {
+			h.logger.Info("Rejected update of a stale config revision", zap.String("name", name), zap.String("namespace", namespace))
+			problem.AbortError(c, err, "Application config")
 		} else {
 			h.logger.Warn("Failed to update application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update application config"})
+			problem.Abort(c, problem.CodeInternal, "Failed to update application config")
 		}
 		return
 	}
 
-	// Fetch the updated record to return it
-	updatedConfig, err := h.dbClient.GetApplicationConfigByNameAndNamespace(c.Request.Context(), name, namespace, userID)
-	if err != nil {
-		// This shouldn't happen if update succeeded, but handle defensively
-		h.logger.Error("Failed to get application config after update", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated application config"})
-		return
-	}
-
 	// Convert ConfigData back to JSON object for response
 	type ResponseConfig struct {
-		ID         int             `json:"id"`
-		Name       string          `json:"name"`
-		Namespace  string          `json:"namespace"`
-		UserID     int             `json:"userId"`
-		ConfigData json.RawMessage `json:"configData"` // Use RawMessage
-		CreatedAt  time.Time       `json:"createdAt"`
-		UpdatedAt  time.Time       `json:"updatedAt"`
+		ID         int                  `json:"id"`
+		Name       string               `json:"name"`
+		Namespace  string               `json:"namespace"`
+		UserID     int                  `json:"userId"`
+		ConfigData json.RawMessage      `json:"configData"` // Use RawMessage
+		Bases      postgres.ConfigBases `json:"bases"`
+		Version    int                  `json:"version"`
+		CreatedAt  time.Time            `json:"createdAt"`
+		UpdatedAt  time.Time            `json:"updatedAt"`
 	}
 
+	// The update returns the stored row, so no second read is needed
 	response := ResponseConfig{
-		ID:         updatedConfig.ID,
-		Name:       updatedConfig.Name,
-		Namespace:  updatedConfig.Namespace,
-		UserID:     updatedConfig.UserID,
-		ConfigData: json.RawMessage(updatedConfig.ConfigData),
-		CreatedAt:  updatedConfig.CreatedAt,
-		UpdatedAt:  updatedConfig.UpdatedAt,
+		ID:         appConfig.ID,
+		Name:       appConfig.Name,
+		Namespace:  appConfig.Namespace,
+		UserID:     appConfig.UserID,
+		ConfigData: json.RawMessage(appConfig.ConfigData),
+		Bases:      appConfig.Bases,
+		Version:    appConfig.Version,
+		CreatedAt:  appConfig.CreatedAt,
+		UpdatedAt:  appConfig.UpdatedAt,
 	}
 
 	h.logger.Info("Successfully updated application config", zap.String("name", name), zap.String("namespace", namespace))
+	setConfigETag(c, appConfig)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -313,14 +349,23 @@ func (h *Handlers) deleteApplicationConfig(c *gin.Context) {
 	userIDStr := c.GetHeader("X-User-ID")
 	userID, _ := strconv.Atoi(userIDStr)
 
-	err := h.dbClient.DeleteApplicationConfig(c.Request.Context(), name, namespace, userID)
+	expected, p := configPrecondition(c, true)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	err := h.dbClient.DeleteApplicationConfig(c.Request.Context(), name, namespace, userID, expected)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			h.logger.Warn("Application config not found", zap.String("name", name), zap.String("namespace", namespace))
-			c.JSON(http.StatusNotFound, gin.H{"error": "Application config not found"})
+			problem.AbortError(c, err, "Application config")
+		} else if errors.Is(err, postgres.ErrConfigVersionMismatch) {
+			h.logger.Info("Rejected delete of a stale config revision", zap.String("name", name), zap.String("namespace", namespace))
+			problem.AbortError(c, err, "Application config")
 		} else {
 			h.logger.Warn("Failed to delete application config", zap.String("name", name), zap.String("namespace", namespace))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete application config"})
+			problem.Abort(c, problem.CodeInternal, "Failed to delete application config")
 		}
 		return
 	}
@@ -330,34 +375,40 @@ func (h *Handlers) deleteApplicationConfig(c *gin.Context) {
 }
 
 func main() {
+	// Load configuration: config.yaml, then environment variables, then flags
+	cfg, err := config.Load("config-server", os.Args[1:], config.WithPort(8082))
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	// Initialize logger
-	logger, err := zap.NewProduction()
+	logger, err := config.NewLogger(cfg.Logging)
 	if err != nil {
 		log.Fatalf("can't initialize zap logger: %v", err)
 	}
 	defer logger.Sync() // Flushes buffer, if any
 
-	// Load configuration
-	cfg := loadConfig()
-	logger.Info("Configuration loaded successfully", zap.String("port", cfg.Port), zap.String("db_host", cfg.DBHost))
+	logger.Info("Configuration loaded successfully", zap.Int("port", cfg.Server.Port), zap.String("db_host", cfg.Database.Postgres.Host))
 
 	// Connect to Postgres
-	pgConfig := postgres.Config{
-		Host:     cfg.DBHost,
-		Port:     cfg.DBPort,
-		User:     cfg.DBUser,
-		Password: cfg.DBPass,
-		DBName:   cfg.DBName,
-		SSLMode:  cfg.SSLMode,
-	}
-
-	dbClient, err := postgres.NewClient(context.Background(), pgConfig)
+	dbClient, err := postgres.NewClient(context.Background(), cfg.Database.Postgres.ClientConfig())
 	if err != nil {
 		logger.Fatal("Failed to connect to postgres", zap.Error(err))
 	}
-	defer dbClient.Close()
 	logger.Info("Successfully connected to postgres")
 
+	// Server lifecycle: signal handling, readiness and ordered shutdown
+	manager := lifecycle.New(lifecycle.DefaultOptions(logger))
+	manager.OnShutdown("close postgres", func(context.Context) error { return dbClient.Close() })
+
+	// Promotions write audit entries too, so upcoming partitions are created here as well. Archival
+	// stays with the gateway, which owns the archive directory.
+	go audit.RunRetention(manager.Context(), dbClient, audit.RetentionOptions{
+		PartitionsAhead: cfg.Audit.PartitionsAhead,
+		Interval:        cfg.Audit.MaintenanceInterval,
+		Logger:          logger,
+	})
+
 	// Setup Prometheus registry and middleware
 	registry, metricsMiddleware := setupMetrics()
 
@@ -366,8 +417,15 @@ func main() {
 
 	// Create Gin router
 	router := gin.New()
-	router.Use(gin.Recovery())    // Recover from panics
-	router.Use(metricsMiddleware) // Use metrics middleware
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(problem.NoRoute)
+	router.NoMethod(problem.NoMethod)
+	router.Use(requestid.Middleware()) // Assign or propagate X-Request-ID
+	router.Use(problem.Recovery())     // Recover from panics
+	router.Use(metricsMiddleware)      // Use metrics middleware
+
+	// Report validation errors by JSON field name
+	problem.RegisterJSONFieldNames()
 
 	// Simple logging middleware
 	router.Use(func(c *gin.Context) {
@@ -379,11 +437,16 @@ func main() {
 			zap.String("path", c.Request.URL.Path),
 			zap.Int("status", c.Writer.Status()),
 			zap.Duration("latency", latency),
-			zap.String("client_IP", c.ClientIP()))
+			zap.String("client_IP", c.ClientIP()),
+			zap.String("request_id", requestid.Get(c)))
 	})
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
+		if !manager.Ready() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+			return
+		}
 		// Add DB ping check
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 1*time.Second)
 		defer cancel()
@@ -395,12 +458,36 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	// Liveness and readiness probes
+	probes := health.NewRegistry(manager.Ready, 2*time.Second)
+	probes.Add(health.Postgres(dbClient))
+	router.GET("/livez", gin.WrapH(probes.LivenessHandler()))
+	router.GET("/readyz", gin.WrapH(probes.ReadinessHandler()))
+
 	// Metrics endpoint for Prometheus
 	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
 
+	// Config change events, announced by the config_events trigger
+	listener, err := postgres.ListenConfigEvents(cfg.Database.Postgres.ClientConfig(), func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Config event listener connection problem", zap.Error(err))
+		}
+	})
+	if err != nil {
+		logger.Fatal("Failed to listen for config events", zap.Error(err))
+	}
+	manager.OnShutdown("close config event listener", func(context.Context) error { return listener.Close() })
+	events, err := newEventHub(context.Background(), dbClient, listener, logger)
+	if err != nil {
+		logger.Fatal("Failed to read config events", zap.Error(err))
+	}
+	go events.run(manager.Context())
+
 	// Initialize Handlers
 	handlers := &Handlers{
 		dbClient: dbClient,
+		schemas:  newSchemaCache(),
+		events:   events,
 		logger:   logger,
 	}
 
@@ -411,21 +498,49 @@ func main() {
 	{
 		configRoutes.POST("", handlers.createApplicationConfig)
 		configRoutes.GET("", handlers.listApplicationConfigs)
+		// Static actions take precedence over /:name, their names are reserved, see reservedConfigNames
+		configRoutes.POST("/validate", handlers.validateApplicationConfig)
+		configRoutes.POST("/import", handlers.importApplicationConfigs)
+		configRoutes.GET("/watch", handlers.watchConfigs)
+		configRoutes.GET("/export", handlers.exportApplicationConfigs)
 		configRoutes.GET("/:name", handlers.getApplicationConfig)
 		configRoutes.PUT("/:name", handlers.updateApplicationConfig)
+		configRoutes.PATCH("/:name", handlers.patchApplicationConfig)
 		configRoutes.DELETE("/:name", handlers.deleteApplicationConfig)
+		configRoutes.GET("/:name/resolved", handlers.getResolvedConfig)
+		configRoutes.GET("/:name/diff", handlers.diffApplicationConfig)
+		configRoutes.GET("/:name/export", handlers.exportApplicationConfig)
+		configRoutes.GET("/:name/versions", handlers.listConfigVersions)
+		configRoutes.GET("/:name/versions/:version", handlers.getConfigVersion)
+		configRoutes.POST("/:name/rollback", handlers.rollbackApplicationConfig)
 	}
+	handlers.registerSchemaRoutes(router)
+	handlers.registerPromotionRoutes(router)
 
 	// Start server
 	server := &http.Server{
-		Addr:         ":" + cfg.Port,
+		Addr:         cfg.Server.Addr(),
 		Handler:      router,
-		ReadTimeout:  cfg.Timeout,
-		WriteTimeout: cfg.Timeout,
+		ReadTimeout:  cfg.Server.Timeout,
+		WriteTimeout: cfg.Server.Timeout,
+	}
+	// End watches as soon as shutdown starts, open streams would otherwise hold it up
+	server.RegisterOnShutdown(events.drain)
+
+	// Optional TLS for internal traffic
+	if cfg.TLS.Enabled() {
+		tlsConfig, reloader, err := tlsutil.NewServerConfig(cfg.TLS, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", zap.Error(err))
+		}
+		go reloader.Watch(manager.Context())
+		server.TLSConfig = tlsConfig
 	}
+	manager.AddServer("config", server)
 
-	logger.Info("Starting Configuration Service", zap.String("port", cfg.Port))
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Fatal("Failed to start server", zap.Error(err))
+	logger.Info("Starting Configuration Service", zap.String("addr", server.Addr))
+	if err := manager.Run(); err != nil {
+		logger.Fatal("Configuration Service shutdown with errors", zap.Error(err))
 	}
+	logger.Info("Configuration Service stopped")
 }
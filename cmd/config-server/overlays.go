@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+)
+
+// Limits on layering, so that resolving one config stays a handful of queries
+const (
+	maxConfigBases = 10 // Bases one config may declare
+	maxBaseDepth   = 8  // Configs on the longest path from a config down to a root base
+)
+
+// configLayer names the config a layer of the resolved output came from
+type configLayer struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+}
+
+// resolvedConfig is a config merged over its bases
+type resolvedConfig struct {
+	Data       map[string]interface{}
+	Layers     []configLayer          // In merge order, the config itself last
+	Provenance map[string]configLayer // Layer that set each leaf, by JSON Pointer
+}
+
+// configKey identifies a config for cycle detection and error messages
+func configKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// checkBases validates the bases declared by a request before anything is looked up
+func checkBases(bases postgres.ConfigBases) *problem.Problem {
+	if len(bases) > maxConfigBases {
+		return problem.New(problem.CodeValidation, "Invalid request body").WithFields(problem.FieldError{
+			Field:   "bases",
+			Message: "must contain at most " + strconv.Itoa(maxConfigBases) + " items",
+		})
+	}
+	var fields []problem.FieldError
+	for i, base := range bases {
+		if base.Name == "" {
+			fields = append(fields, problem.FieldError{Field: "bases[" + strconv.Itoa(i) + "].name", Message: "is required"})
+		}
+	}
+	if len(fields) > 0 {
+		return problem.New(problem.CodeValidation, "Invalid request body").WithFields(fields...)
+	}
+	return nil
+}
+
+// resolveConfig merges config over its bases. Bases are resolved depth first in the order they are
+// declared, each over its own bases, and config's own data goes on top. Objects merge key by key,
+// any other value replaces what is beneath it and null removes the key, as in a JSON Merge Patch.
+// Bases are looked up among the configs of config's user.
+func (h *Handlers) resolveConfig(ctx context.Context, config *postgres.ApplicationConfig) (*resolvedConfig, error) {
+	out := &resolvedConfig{Data: map[string]interface{}{}, Provenance: map[string]configLayer{}}
+	if err := h.applyLayer(ctx, out, config, nil); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (h *Handlers) applyLayer(ctx context.Context, out *resolvedConfig, config *postgres.ApplicationConfig, path []string) error {
+	key := configKey(config.Namespace, config.Name)
+	for i, visited := range path {
+		if visited == key {
+			cycle := append(append([]string{}, path[i:]...), key)
+			return problem.New(problem.CodeValidation, "Config bases form a cycle: "+strings.Join(cycle, " -> "))
+		}
+	}
+	if len(path) >= maxBaseDepth {
+		return problem.Newf(problem.CodeValidation, "Config bases of %s nest deeper than %d levels", path[0], maxBaseDepth)
+	}
+	path = append(path, key)
+
+	for _, base := range config.Bases {
+		namespace := base.Namespace
+		if namespace == "" {
+			namespace = config.Namespace
+		}
+		baseConfig, err := h.dbClient.GetApplicationConfigByNameAndNamespace(ctx, base.Name, namespace, config.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return problem.Newf(problem.CodeValidation, "Base %s of %s does not exist", configKey(namespace, base.Name), key)
+		}
+		if err != nil {
+			return err
+		}
+		if err := h.applyLayer(ctx, out, baseConfig, path); err != nil {
+			return err
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(config.ConfigData))
+	decoder.UseNumber()
+	var data map[string]interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return problem.Newf(problem.CodeValidation, "configData of %s is not a JSON object", key)
+	}
+	layer := configLayer{Namespace: config.Namespace, Name: config.Name, Version: config.Version}
+	out.Layers = append(out.Layers, layer)
+	mergeLayer(out.Data, data, "", layer, out.Provenance)
+	return nil
+}
+
+// mergeLayer merges src into dst, recording layer as the origin of every leaf it sets. Leaves are
+// scalars, arrays and empty objects, keyed by JSON Pointer relative to prefix.
+func mergeLayer(dst, src map[string]interface{}, prefix string, layer configLayer, provenance map[string]configLayer) {
+	for key, value := range src {
+		pointer := prefix + "/" + escapePointer(key)
+		if value == nil {
+			delete(dst, key)
+			forgetProvenance(provenance, pointer)
+			continue
+		}
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			dst[key] = value
+			forgetProvenance(provenance, pointer)
+			provenance[pointer] = layer
+			continue
+		}
+		target, ok := dst[key].(map[string]interface{})
+		if !ok {
+			target = map[string]interface{}{}
+			dst[key] = target
+			forgetProvenance(provenance, pointer)
+			if len(object) == 0 {
+				provenance[pointer] = layer
+				continue
+			}
+		}
+		if len(object) == 0 {
+			continue // Merging {} into an object changes nothing
+		}
+		delete(provenance, pointer) // No longer a leaf once it has keys
+		mergeLayer(target, object, pointer, layer, provenance)
+		if len(target) == 0 {
+			// Every key was removed, the object that remains came from this layer
+			provenance[pointer] = layer
+		}
+	}
+}
+
+// forgetProvenance drops the origin of a value and of everything beneath it
+func forgetProvenance(provenance map[string]configLayer, pointer string) {
+	delete(provenance, pointer)
+	for key := range provenance {
+		if strings.HasPrefix(key, pointer+"/") {
+			delete(provenance, key)
+		}
+	}
+}
+
+// escapePointer escapes an object key for use as a JSON Pointer reference token (RFC 6901)
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// checkConfig validates config against the schema bound to it. A config with bases is resolved
+// first and the schema applies to the result, since overlays are usually partial.
+func (h *Handlers) checkConfig(ctx context.Context, config *postgres.ApplicationConfig) (*boundSchema, error) {
+	if len(config.Bases) == 0 {
+		return h.validateConfigData(ctx, config.Namespace, config.Name, []byte(config.ConfigData))
+	}
+	if p := checkBases(config.Bases); p != nil {
+		return nil, p
+	}
+	if trimmed := bytes.TrimSpace([]byte(config.ConfigData)); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, problem.New(problem.CodeValidation, "configData must be a JSON object when the config has bases")
+	}
+	resolved, err := h.resolveConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	bound, err := h.schemaFor(ctx, config.Namespace, config.Name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(resolved.Data)
+	if err != nil {
+		return nil, err
+	}
+	if p := bound.validate(data, "resolved"); p != nil {
+		return bound, p
+	}
+	return bound, nil
+}
+
+// getResolvedConfig handles GET /configs/:name/resolved. The response carries the merged data, the
+// layers in merge order and the layer each leaf came from. A base may have changed since the config
+// was written, so the schema check is repeated and reported rather than enforced.
+func (h *Handlers) getResolvedConfig(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	config, err := h.dbClient.GetApplicationConfigByNameAndNamespace(c.Request.Context(), name, namespace, userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to get application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+
+	resolved, err := h.resolveConfig(c.Request.Context(), config)
+	if err != nil {
+		var p *problem.Problem
+		if !errors.As(err, &p) {
+			h.logger.Warn("Failed to resolve application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+
+	bound, err := h.schemaFor(c.Request.Context(), namespace, name)
+	if err != nil {
+		h.logger.Warn("Failed to look up config schema", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+	data, err := json.Marshal(resolved.Data)
+	if err != nil {
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+
+	validation := gin.H{"valid": true, "schema": nil}
+	if bound != nil {
+		validation["schema"] = gin.H{"name": bound.schema.Name, "version": bound.schema.Version}
+	}
+	if p := bound.validate(data, "resolved"); p != nil {
+		validation["valid"] = false
+		validation["detail"] = p.Detail
+		validation["errors"] = p.Errors
+	}
+
+	body, err := json.Marshal(gin.H{
+		"name":        config.Name,
+		"namespace":   config.Namespace,
+		"version":     config.Version,
+		"config_data": json.RawMessage(data),
+		"layers":      resolved.Layers,
+		"provenance":  resolved.Provenance,
+		"validation":  validation,
+	})
+	if err != nil {
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+	// The result changes with any base or the schema, not only with the overlay's own revision
+	c.Header("ETag", bodyETag(body))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
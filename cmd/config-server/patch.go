@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+)
+
+// Patch formats accepted by PATCH /configs/:name
+const (
+	mediaTypeMergePatch = "application/merge-patch+json" // RFC 7386
+	mediaTypeJSONPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+// maxChangeMessage bounds the change message recorded with a version
+const maxChangeMessage = 500
+
+// patchApplicationConfig handles PATCH /configs/:name. The body is a JSON Merge Patch or a JSON
+// Patch, chosen by Content-Type, applied to the stored data inside one transaction. The change
+// message comes from ?message= since the body is the patch itself.
+func (h *Handlers) patchApplicationConfig(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	expected, p := configPrecondition(c, true)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != mediaTypeMergePatch && mediaType != mediaTypeJSONPatch {
+		c.Header("Accept-Patch", mediaTypeMergePatch+", "+mediaTypeJSONPatch)
+		problem.Abort(c, problem.CodeUnsupportedMedia, "Send the patch as "+mediaTypeMergePatch+" or "+mediaTypeJSONPatch)
+		return
+	}
+
+	message := c.Query("message")
+	if len(message) > maxChangeMessage {
+		problem.Write(c, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+			Field:   "message",
+			Message: "must be at most " + strconv.Itoa(maxChangeMessage) + " characters",
+		}))
+		return
+	}
+	if message == "" {
+		message = "Patched"
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		h.logger.Warn("Failed to read patch body", zap.Error(err))
+		problem.Abort(c, problem.CodeBadRequest, "Failed to read the request body")
+		return
+	}
+
+	// Decode up front so a malformed patch is rejected before the row is locked
+	var apply func(current []byte) ([]byte, error)
+	switch mediaType {
+	case mediaTypeMergePatch:
+		if !json.Valid(body) {
+			problem.Abort(c, problem.CodeBadRequest, "The merge patch is not valid JSON")
+			return
+		}
+		apply = func(current []byte) ([]byte, error) { return jsonpatch.MergePatch(current, body) }
+	case mediaTypeJSONPatch:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			problem.Abort(c, problem.CodeBadRequest, "The JSON Patch is malformed: "+err.Error())
+			return
+		}
+		apply = patch.Apply
+	}
+
+	// The patched data is resolved over the stored bases and checked before commit
+	config, err := h.dbClient.PatchApplicationConfig(c.Request.Context(), name, namespace, userID, expected, message,
+		func(current *postgres.ApplicationConfig) (string, error) {
+			patched, err := apply([]byte(current.ConfigData))
+			if err != nil {
+				return "", patchProblem(err)
+			}
+			if trimmed := bytes.TrimSpace(patched); len(trimmed) == 0 || trimmed[0] != '{' {
+				return "", problem.New(problem.CodeValidation, "The patched configData must remain a JSON object")
+			}
+			candidate := *current
+			candidate.ConfigData = string(patched)
+			if _, err := h.checkConfig(c.Request.Context(), &candidate); err != nil {
+				return "", err
+			}
+			return string(patched), nil
+		})
+	if err != nil {
+		var p *problem.Problem
+		switch {
+		case errors.As(err, &p):
+			h.logger.Info("Rejected config patch", zap.String("name", name), zap.String("namespace", namespace), zap.String("reason", p.Detail))
+		case errors.Is(err, sql.ErrNoRows):
+			h.logger.Warn("Attempted to patch non-existent config", zap.String("name", name), zap.String("namespace", namespace))
+		case errors.Is(err, postgres.ErrConfigVersionMismatch):
+			h.logger.Info("Rejected patch of a stale config revision", zap.String("name", name), zap.String("namespace", namespace))
+		default:
+			h.logger.Warn("Failed to patch application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+
+	h.logger.Info("Successfully patched application config",
+		zap.String("name", name),
+		zap.String("namespace", namespace),
+		zap.String("format", mediaType),
+		zap.Int("version", config.Version),
+	)
+	setConfigETag(c, config)
+	c.JSON(http.StatusOK, configBody(config))
+}
+
+// patchProblem explains why a patch could not be applied to the stored document. A failed test
+// operation means the document is not in the state the client expected, so it is a conflict.
+func patchProblem(err error) *problem.Problem {
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return problem.New(problem.CodeConflict, "A JSON Patch test operation failed: "+err.Error())
+	}
+	return problem.New(problem.CodeValidation, "The patch cannot be applied to the stored configData: "+err.Error())
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/authz"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+	"go.uber.org/zap"
+)
+
+// maxPromotionsListed bounds GET /promotions
+const maxPromotionsListed = 100
+
+// PromotionCreateRequest asks for one version of a config to be copied into another namespace
+type PromotionCreateRequest struct {
+	Name            string `json:"name" binding:"required"`
+	SourceNamespace string `json:"sourceNamespace" binding:"required"`
+	Version         int    `json:"version" binding:"required,min=1"`
+	TargetNamespace string `json:"targetNamespace" binding:"required,nefield=SourceNamespace"`
+	Message         string `json:"message" binding:"max=500"`
+}
+
+// PromotionReviewRequest carries the reviewer's comment on an approval or rejection
+type PromotionReviewRequest struct {
+	Comment string `json:"comment" binding:"max=1000"`
+}
+
+// promotionView is the API representation of a promotion
+type promotionView struct {
+	ID              int                  `json:"id"`
+	Name            string               `json:"name"`
+	SourceNamespace string               `json:"source_namespace"`
+	SourceVersion   int                  `json:"source_version"`
+	TargetNamespace string               `json:"target_namespace"`
+	TargetVersion   int                  `json:"target_version"`
+	ConfigData      json.RawMessage      `json:"config_data"`
+	Bases           postgres.ConfigBases `json:"bases"`
+	Status          string               `json:"status"`
+	Message         string               `json:"message,omitempty"`
+	RequestedBy     *int                 `json:"requested_by"`
+	ReviewedBy      *int                 `json:"reviewed_by,omitempty"`
+	ReviewComment   string               `json:"review_comment,omitempty"`
+	AppliedVersion  int                  `json:"applied_version,omitempty"`
+	CreatedAt       time.Time            `json:"created_at"`
+	ReviewedAt      *time.Time           `json:"reviewed_at,omitempty"`
+	Diff            *promotionDiff       `json:"diff,omitempty"`
+}
+
+// promotionDiff shows what approving a pending promotion would change in the target
+type promotionDiff struct {
+	CurrentVersion int          `json:"current_version"` // Zero when the target does not exist
+	Stale          bool         `json:"stale"`           // The target changed since the request, approval would fail
+	BasesChanged   bool         `json:"bases_changed"`
+	Changes        []jsonChange `json:"changes"`
+}
+
+func newPromotionView(p *postgres.ConfigPromotion) promotionView {
+	view := promotionView{
+		ID:              p.ID,
+		Name:            p.Name,
+		SourceNamespace: p.SourceNamespace,
+		SourceVersion:   p.SourceVersion,
+		TargetNamespace: p.TargetNamespace,
+		TargetVersion:   p.TargetVersion,
+		ConfigData:      json.RawMessage(p.ConfigData),
+		Bases:           p.Bases,
+		Status:          p.Status,
+		Message:         p.Message,
+		ReviewComment:   p.ReviewComment,
+		AppliedVersion:  p.AppliedVersion,
+		CreatedAt:       p.CreatedAt,
+		ReviewedAt:      p.ReviewedAt,
+	}
+	if p.RequestedBy != 0 {
+		view.RequestedBy = &p.RequestedBy
+	}
+	if p.ReviewedBy != 0 {
+		view.ReviewedBy = &p.ReviewedBy
+	}
+	return view
+}
+
+// registerPromotionRoutes adds the promotion workflow endpoints
+func (h *Handlers) registerPromotionRoutes(r gin.IRouter) {
+	promotions := r.Group("/promotions")
+	promotions.POST("", h.createConfigPromotion)
+	promotions.GET("", h.listConfigPromotions)
+	promotions.GET("/:id", h.getConfigPromotion)
+	promotions.POST("/:id/approve", h.approveConfigPromotion)
+	promotions.POST("/:id/reject", h.rejectConfigPromotion)
+}
+
+// isPromotionApprover reports whether the caller may approve promotions into namespace
+func isPromotionApprover(c *gin.Context, namespace string) bool {
+	return authz.HasRole(c, authz.NamespaceRole(namespace, authz.RoleConfigApprover))
+}
+
+// promotionAudit builds the audit event for one step of the workflow
+func promotionAudit(c *gin.Context, userID int, step string) func(*postgres.ConfigPromotion) postgres.AuditEvent {
+	return func(p *postgres.ConfigPromotion) postgres.AuditEvent {
+		requestData, _ := json.Marshal(map[string]interface{}{
+			"promotion_id":     p.ID,
+			"source_namespace": p.SourceNamespace,
+			"source_version":   p.SourceVersion,
+			"target_version":   p.TargetVersion,
+			"applied_version":  p.AppliedVersion,
+			"owner_id":         p.UserID,
+			"request_id":       requestid.Get(c),
+		})
+		message := fmt.Sprintf("Promotion %d of %s version %d %s", p.ID, p.SourceNamespace, p.SourceVersion, step)
+		if step != "requested" && p.ReviewComment != "" {
+			message += ": " + p.ReviewComment
+		}
+		return postgres.AuditEvent{
+			UserID:       userID,
+			Action:       "config.promotion." + step,
+			ResourceType: "config_promotion",
+			ResourceName: p.Name,
+			Namespace:    p.TargetNamespace,
+			RequestData:  string(requestData),
+			Status:       "success",
+			Message:      message,
+			ClientIP:     c.ClientIP(),
+		}
+	}
+}
+
+// promotionDiffFor compares a pending promotion with the current target
+func (h *Handlers) promotionDiffFor(c *gin.Context, p *postgres.ConfigPromotion) (*promotionDiff, error) {
+	current, err := h.dbClient.GetApplicationConfigByNameAndNamespace(c.Request.Context(), p.Name, p.TargetNamespace, p.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	var from interface{} = map[string]interface{}{}
+	if err == nil {
+		if from, err = decodeJSON(current.ConfigData); err != nil {
+			return nil, fmt.Errorf("failed to decode target config data: %w", err)
+		}
+	} else {
+		current = &postgres.ApplicationConfig{}
+	}
+	to, err := decodeJSON(p.ConfigData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode promoted config data: %w", err)
+	}
+
+	changes := diffJSON(from, to)
+	if changes == nil {
+		changes = []jsonChange{}
+	}
+	return &promotionDiff{
+		CurrentVersion: current.Version,
+		Stale:          current.ID != p.TargetConfigID || current.Version != p.TargetVersion,
+		BasesChanged:   !sameBases(current.Bases, p.Bases),
+		Changes:        changes,
+	}, nil
+}
+
+func sameBases(a, b postgres.ConfigBases) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// promotionResponse renders a promotion, with the diff against the target while it is pending
+func (h *Handlers) promotionResponse(c *gin.Context, p *postgres.ConfigPromotion) (promotionView, error) {
+	view := newPromotionView(p)
+	if p.Status != postgres.PromotionPending {
+		return view, nil
+	}
+	diff, err := h.promotionDiffFor(c, p)
+	if err != nil {
+		return view, err
+	}
+	view.Diff = diff
+	return view, nil
+}
+
+// promotionFromPath loads the promotion named by the :id parameter if the caller may see it, which
+// is the case for its requester and for approvers of its target namespace. Anyone else gets 404.
+func (h *Handlers) promotionFromPath(c *gin.Context, userID int) (*postgres.ConfigPromotion, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		problem.Write(c, problem.New(problem.CodeValidation, "Invalid path parameters").WithFields(problem.FieldError{
+			Field:   "id",
+			Message: "must be a positive number",
+		}))
+		return nil, false
+	}
+	promotion, err := h.dbClient.GetConfigPromotion(c.Request.Context(), id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to get config promotion", zap.Error(err), zap.Int("id", id))
+		}
+		problem.AbortError(c, err, "Config promotion")
+		return nil, false
+	}
+	if promotion.RequestedBy != userID && !isPromotionApprover(c, promotion.TargetNamespace) {
+		problem.AbortError(c, sql.ErrNoRows, "Config promotion")
+		return nil, false
+	}
+	return promotion, true
+}
+
+// bindReview reads the optional review body
+func bindReview(c *gin.Context) (PromotionReviewRequest, bool) {
+	var req PromotionReviewRequest
+	if c.Request.ContentLength == 0 {
+		return req, true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, problem.FromBindError(err))
+		return req, false
+	}
+	return req, true
+}
+
+// createConfigPromotion handles POST /promotions. The source version is copied into a pending
+// request against the current version of the target. The copy is checked against the schemas of the
+// target namespace up front, so reviewers only see promotions that could be applied.
+func (h *Handlers) createConfigPromotion(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader(authz.UserIDHeader))
+	if userID == 0 {
+		problem.Abort(c, problem.CodeUnauthorized, "The request is not authenticated")
+		return
+	}
+
+	var req PromotionCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Failed to bind JSON for config promotion", zap.Error(err))
+		problem.Write(c, problem.FromBindError(err))
+		return
+	}
+
+	source, err := h.dbClient.GetApplicationConfigVersion(c.Request.Context(), req.Name, req.SourceNamespace, userID, req.Version)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to get config version", zap.Error(err), zap.String("name", req.Name), zap.Int("version", req.Version))
+		}
+		problem.AbortError(c, err, "Application config version")
+		return
+	}
+	if _, err := h.checkConfig(c.Request.Context(), &postgres.ApplicationConfig{
+		Name:       req.Name,
+		Namespace:  req.TargetNamespace,
+		UserID:     userID,
+		ConfigData: source.ConfigData,
+		Bases:      source.Bases,
+	}); err != nil {
+		h.logger.Info("Rejected config promotion", zap.String("name", req.Name), zap.String("target", req.TargetNamespace), zap.Error(err))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+
+	promotion := &postgres.ConfigPromotion{
+		Name:            req.Name,
+		UserID:          userID,
+		SourceNamespace: req.SourceNamespace,
+		SourceVersion:   req.Version,
+		TargetNamespace: req.TargetNamespace,
+		Message:         req.Message,
+		RequestedBy:     userID,
+	}
+	if err := h.dbClient.CreateConfigPromotion(c.Request.Context(), promotion, promotionAudit(c, userID, "requested")); err != nil {
+		if postgres.IsUniqueConstraintViolation(err) {
+			problem.Write(c, problem.Newf(problem.CodeConflict, "A promotion of %s into namespace '%s' is already pending", req.Name, req.TargetNamespace))
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to create config promotion", zap.Error(err), zap.String("name", req.Name))
+		}
+		problem.AbortError(c, err, "Application config version")
+		return
+	}
+
+	h.logger.Info("Requested config promotion",
+		zap.Int("id", promotion.ID),
+		zap.String("name", promotion.Name),
+		zap.String("source", promotion.SourceNamespace),
+		zap.Int("version", promotion.SourceVersion),
+		zap.String("target", promotion.TargetNamespace),
+	)
+	view, err := h.promotionResponse(c, promotion)
+	if err != nil {
+		// The promotion is stored, only the diff is missing
+		h.logger.Warn("Failed to diff config promotion", zap.Error(err), zap.Int("id", promotion.ID))
+	}
+	c.JSON(http.StatusCreated, view)
+}
+
+// listConfigPromotions handles GET /promotions. Approvers of ?namespace see every promotion into it,
+// anyone else sees the promotions they requested. ?status filters by state.
+func (h *Handlers) listConfigPromotions(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader(authz.UserIDHeader))
+	filter := postgres.ConfigPromotionFilter{
+		TargetNamespace: c.Query("namespace"),
+		Status:          c.Query("status"),
+	}
+	switch filter.Status {
+	case "", postgres.PromotionPending, postgres.PromotionApproved, postgres.PromotionRejected:
+	default:
+		problem.Write(c, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+			Field:   "status",
+			Message: "must be one of pending approved rejected",
+		}))
+		return
+	}
+	if filter.TargetNamespace == "" || !isPromotionApprover(c, filter.TargetNamespace) {
+		filter.RequestedBy = userID
+		if userID == 0 {
+			problem.Abort(c, problem.CodeUnauthorized, "The request is not authenticated")
+			return
+		}
+	}
+
+	promotions, err := h.dbClient.ListConfigPromotions(c.Request.Context(), filter, maxPromotionsListed)
+	if err != nil {
+		h.logger.Warn("Failed to list config promotions", zap.Error(err))
+		problem.AbortError(c, err, "Config promotion")
+		return
+	}
+	items := make([]promotionView, len(promotions))
+	for i := range promotions {
+		items[i] = newPromotionView(&promotions[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// getConfigPromotion handles GET /promotions/:id, including the diff against the target while pending
+func (h *Handlers) getConfigPromotion(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader(authz.UserIDHeader))
+	promotion, ok := h.promotionFromPath(c, userID)
+	if !ok {
+		return
+	}
+	view, err := h.promotionResponse(c, promotion)
+	if err != nil {
+		h.logger.Warn("Failed to diff config promotion", zap.Error(err), zap.Int("id", promotion.ID))
+		problem.AbortError(c, err, "Config promotion")
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// approveConfigPromotion handles POST /promotions/:id/approve. Only an approver of the target
+// namespace who did not request the promotion may approve it. The copied data is applied to the
+// target as a new version, provided the target has not changed since the request.
+func (h *Handlers) approveConfigPromotion(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader(authz.UserIDHeader))
+	promotion, ok := h.promotionFromPath(c, userID)
+	if !ok {
+		return
+	}
+	if !isPromotionApprover(c, promotion.TargetNamespace) {
+		problem.Abort(c, problem.CodeForbidden, "Approving promotions into '"+promotion.TargetNamespace+"' requires the "+
+			authz.NamespaceRole(promotion.TargetNamespace, authz.RoleConfigApprover)+" role")
+		return
+	}
+	if promotion.RequestedBy == userID {
+		problem.Abort(c, problem.CodeForbidden, "A promotion must be approved by someone other than its requester")
+		return
+	}
+	req, ok := bindReview(c)
+	if !ok {
+		return
+	}
+
+	// Schemas may have changed since the request, check again before applying
+	if _, err := h.checkConfig(c.Request.Context(), &postgres.ApplicationConfig{
+		Name:       promotion.Name,
+		Namespace:  promotion.TargetNamespace,
+		UserID:     promotion.UserID,
+		ConfigData: promotion.ConfigData,
+		Bases:      promotion.Bases,
+	}); err != nil {
+		h.logger.Info("Rejected approval of config promotion", zap.Int("id", promotion.ID), zap.Error(err))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+
+	approved, config, err := h.dbClient.ApproveConfigPromotion(c.Request.Context(), promotion.ID, userID, req.Comment, promotionAudit(c, userID, "approved"))
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrConfigVersionMismatch), postgres.IsUniqueConstraintViolation(err):
+			h.logger.Info("Config promotion target changed since the request", zap.Int("id", promotion.ID))
+			problem.Abort(c, problem.CodeConflict, "The target config changed since the promotion was requested, reject it and request a new one")
+		default:
+			if !errors.Is(err, postgres.ErrPromotionNotPending) {
+				h.logger.Warn("Failed to approve config promotion", zap.Error(err), zap.Int("id", promotion.ID))
+			}
+			problem.AbortError(c, err, "Config promotion")
+		}
+		return
+	}
+
+	h.logger.Info("Approved config promotion",
+		zap.Int("id", approved.ID),
+		zap.String("name", approved.Name),
+		zap.String("target", approved.TargetNamespace),
+		zap.Int("version", config.Version),
+	)
+	setConfigETag(c, config)
+	c.JSON(http.StatusOK, gin.H{"promotion": newPromotionView(approved), "config": configBody(config)})
+}
+
+// rejectConfigPromotion handles POST /promotions/:id/reject. Approvers of the target namespace may
+// reject a promotion, and its requester may withdraw it.
+func (h *Handlers) rejectConfigPromotion(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader(authz.UserIDHeader))
+	promotion, ok := h.promotionFromPath(c, userID)
+	if !ok {
+		return
+	}
+	req, ok := bindReview(c)
+	if !ok {
+		return
+	}
+
+	rejected, err := h.dbClient.RejectConfigPromotion(c.Request.Context(), promotion.ID, userID, req.Comment, promotionAudit(c, userID, "rejected"))
+	if err != nil {
+		if !errors.Is(err, postgres.ErrPromotionNotPending) && !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to reject config promotion", zap.Error(err), zap.Int("id", promotion.ID))
+		}
+		problem.AbortError(c, err, "Config promotion")
+		return
+	}
+
+	h.logger.Info("Rejected config promotion", zap.Int("id", rejected.ID), zap.String("name", rejected.Name), zap.Int("reviewer", userID))
+	c.JSON(http.StatusOK, newPromotionView(rejected))
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/authz"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.uber.org/zap"
+)
+
+// schemaURL names the document being compiled, it never leaves the process
+const schemaURL = "mem://config-server/schema.json"
+
+// maxSchemaErrors caps the field errors reported for one invalid config
+const maxSchemaErrors = 50
+
+// schemaCache keeps compiled schemas by ID, schema versions never change once stored
+type schemaCache struct {
+	mu       sync.Mutex
+	compiled map[int]*jsonschema.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{compiled: map[int]*jsonschema.Schema{}}
+}
+
+// compile returns the compiled form of a stored schema
+func (sc *schemaCache) compile(schema *postgres.ConfigSchema) (*jsonschema.Schema, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if compiled, ok := sc.compiled[schema.ID]; ok {
+		return compiled, nil
+	}
+	compiled, err := compileSchema(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	sc.compiled[schema.ID] = compiled
+	return compiled, nil
+}
+
+// compileSchema compiles a JSON Schema document, defaulting to draft 2020-12. References are
+// resolved within the document only, so a schema cannot make the service fetch URLs or files.
+func compileSchema(document string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external reference %s is not allowed", url)
+	}
+	if err := compiler.AddResource(schemaURL, strings.NewReader(document)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(schemaURL)
+}
+
+// matchSchema picks the schema bound to a config name: an exact pattern wins over globs, then the
+// longest matching glob, so a specific binding overrides a namespace-wide one
+func matchSchema(schemas []postgres.ConfigSchema, configName string) *postgres.ConfigSchema {
+	var best *postgres.ConfigSchema
+	for i := range schemas {
+		s := &schemas[i]
+		if ok, err := path.Match(s.ConfigPattern, configName); err != nil || !ok {
+			continue
+		}
+		if best == nil || schemaPrecedes(s, best) {
+			best = s
+		}
+	}
+	return best
+}
+
+func schemaPrecedes(a, b *postgres.ConfigSchema) bool {
+	aExact, bExact := !hasGlob(a.ConfigPattern), !hasGlob(b.ConfigPattern)
+	if aExact != bExact {
+		return aExact
+	}
+	if len(a.ConfigPattern) != len(b.ConfigPattern) {
+		return len(a.ConfigPattern) > len(b.ConfigPattern)
+	}
+	return a.Name < b.Name
+}
+
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// boundSchema is the compiled schema in force for one config
+type boundSchema struct {
+	schema   *postgres.ConfigSchema
+	compiled *jsonschema.Schema
+}
+
+// schemaFor returns the schema bound to a config, nil when none is
+func (h *Handlers) schemaFor(ctx context.Context, namespace, configName string) (*boundSchema, error) {
+	schemas, err := h.dbClient.ListConfigSchemas(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	schema := matchSchema(schemas, configName)
+	if schema == nil {
+		return nil, nil
+	}
+	compiled, err := h.schemas.compile(schema)
+	if err != nil {
+		// Schemas are compiled before they are stored, so this only happens after a library change
+		return nil, fmt.Errorf("failed to compile config schema %s v%d: %w", schema.Name, schema.Version, err)
+	}
+	return &boundSchema{schema: schema, compiled: compiled}, nil
+}
+
+// validate checks config data, reporting each failure with the JSON Pointer of the offending value
+// under field. A nil bound schema accepts anything.
+func (b *boundSchema) validate(data []byte, field string) *problem.Problem {
+	if b == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return problem.New(problem.CodeBadRequest, field+" is not valid JSON")
+	}
+
+	err := b.compiled.Validate(value)
+	if err == nil {
+		return nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return problem.New(problem.CodeValidation, fmt.Sprintf("%s cannot be validated against schema %s v%d: %v", field, b.schema.Name, b.schema.Version, err))
+	}
+
+	var fields []problem.FieldError
+	seen := map[problem.FieldError]bool{}
+	var collect func(*jsonschema.ValidationError)
+	collect = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) > 0 {
+			for _, cause := range ve.Causes {
+				collect(cause)
+			}
+			return
+		}
+		fe := problem.FieldError{Field: field + ve.InstanceLocation, Message: ve.Message}
+		if !seen[fe] && len(fields) < maxSchemaErrors {
+			seen[fe] = true
+			fields = append(fields, fe)
+		}
+	}
+	collect(validationErr)
+	sortFieldErrors(fields)
+
+	return problem.Newf(problem.CodeValidation, "%s does not match schema %s v%d", field, b.schema.Name, b.schema.Version).WithFields(fields...)
+}
+
+// validateConfigData looks up the schema bound to a config and validates data against it
+func (h *Handlers) validateConfigData(ctx context.Context, namespace, configName string, data []byte) (*boundSchema, error) {
+	bound, err := h.schemaFor(ctx, namespace, configName)
+	if err != nil {
+		return nil, err
+	}
+	if p := bound.validate(data, "configData"); p != nil {
+		return bound, p
+	}
+	return bound, nil
+}
+
+// ConfigSchemaCreateRequest registers a schema, or a new version of it when the name exists
+type ConfigSchemaCreateRequest struct {
+	Name          string          `json:"name" binding:"required,max=100"`
+	Namespace     string          `json:"namespace" binding:"required,max=100"`
+	ConfigPattern string          `json:"configPattern" binding:"required,max=200"`
+	Schema        json.RawMessage `json:"schema" binding:"required"`
+	Description   string          `json:"description" binding:"max=1000"`
+}
+
+// ConfigValidationRequest is a config checked by the dry-run endpoint
+type ConfigValidationRequest struct {
+	Name       string               `json:"name" binding:"required"`
+	Namespace  string               `json:"namespace"`
+	ConfigData json.RawMessage      `json:"configData" binding:"required"`
+	Bases      postgres.ConfigBases `json:"bases"`
+}
+
+// configSchemaView is the API representation of a schema version
+type configSchemaView struct {
+	Name          string          `json:"name"`
+	Namespace     string          `json:"namespace"`
+	Version       int             `json:"version"`
+	ConfigPattern string          `json:"config_pattern"`
+	Schema        json.RawMessage `json:"schema"`
+	Description   string          `json:"description,omitempty"`
+	AuthorID      *int            `json:"author_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+func newConfigSchemaView(s postgres.ConfigSchema) configSchemaView {
+	view := configSchemaView{
+		Name:          s.Name,
+		Namespace:     s.Namespace,
+		Version:       s.Version,
+		ConfigPattern: s.ConfigPattern,
+		Schema:        json.RawMessage(s.Schema),
+		Description:   s.Description,
+		CreatedAt:     s.CreatedAt,
+	}
+	if s.AuthorID != 0 {
+		view.AuthorID = &s.AuthorID
+	}
+	return view
+}
+
+// registerSchemaRoutes adds the schema registry endpoints
+func (h *Handlers) registerSchemaRoutes(r gin.IRouter) {
+	schemas := r.Group("/schemas")
+	schemas.POST("", h.createConfigSchema)
+	schemas.GET("", h.listConfigSchemas)
+	schemas.GET("/:name", h.getConfigSchema)
+	schemas.GET("/:name/versions", h.listConfigSchemaVersions)
+	schemas.GET("/:name/versions/:version", h.getConfigSchema)
+	schemas.DELETE("/:name", h.deleteConfigSchema)
+}
+
+// requireSchemaAdmin rejects with 403 a caller who may not change the schemas of namespace. A
+// schema constrains, and marks secrets in, every user's configs of the namespace.
+func requireSchemaAdmin(c *gin.Context, namespace string) bool {
+	role := authz.NamespaceRole(namespace, authz.RoleConfigSchemaAdmin)
+	if !authz.HasRole(c, role) {
+		problem.Abort(c, problem.CodeForbidden, "Changing the config schemas of '"+namespace+"' requires the "+role+" role")
+		return false
+	}
+	return true
+}
+
+// createConfigSchema handles POST /schemas. The schema is compiled before it is stored, so a
+// broken schema never blocks config changes.
+func (h *Handlers) createConfigSchema(c *gin.Context) {
+	var req ConfigSchemaCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Failed to bind JSON for create config schema", zap.Error(err))
+		problem.Write(c, problem.FromBindError(err))
+		return
+	}
+	if !requireSchemaAdmin(c, req.Namespace) {
+		return
+	}
+
+	var fields []problem.FieldError
+	if _, err := path.Match(req.ConfigPattern, ""); err != nil {
+		fields = append(fields, problem.FieldError{Field: "configPattern", Message: "is not a valid glob pattern"})
+	}
+	if _, err := compileSchema(string(req.Schema)); err != nil {
+		fields = append(fields, problem.FieldError{Field: "schema", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		problem.Write(c, problem.New(problem.CodeValidation, "The schema cannot be registered").WithFields(fields...))
+		return
+	}
+
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+	schema := &postgres.ConfigSchema{
+		Namespace:     req.Namespace,
+		Name:          req.Name,
+		ConfigPattern: req.ConfigPattern,
+		Schema:        string(req.Schema),
+		Description:   req.Description,
+		AuthorID:      userID,
+	}
+	if err := h.dbClient.CreateConfigSchema(c.Request.Context(), schema); err != nil {
+		if postgres.IsUniqueConstraintViolation(err) {
+			problem.Abort(c, problem.CodeConflict, "Another version of this schema was registered concurrently, retry the request")
+			return
+		}
+		h.logger.Warn("Failed to create config schema", zap.Error(err), zap.String("name", req.Name), zap.String("namespace", req.Namespace))
+		problem.Abort(c, problem.CodeInternal, "Failed to register config schema")
+		return
+	}
+
+	h.logger.Info("Registered config schema",
+		zap.String("name", schema.Name),
+		zap.String("namespace", schema.Namespace),
+		zap.Int("version", schema.Version),
+		zap.String("config_pattern", schema.ConfigPattern),
+	)
+	c.JSON(http.StatusCreated, newConfigSchemaView(*schema))
+}
+
+// listConfigSchemas handles GET /schemas, the latest version of each schema in a namespace
+func (h *Handlers) listConfigSchemas(c *gin.Context) {
+	namespace := c.DefaultQuery("namespace", "default")
+	schemas, err := h.dbClient.ListConfigSchemas(c.Request.Context(), namespace)
+	if err != nil {
+		h.logger.Warn("Failed to list config schemas", zap.Error(err), zap.String("namespace", namespace))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+	items := make([]configSchemaView, 0, len(schemas))
+	for _, s := range schemas {
+		items = append(items, newConfigSchemaView(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// listConfigSchemaVersions handles GET /schemas/:name/versions, newest first
+func (h *Handlers) listConfigSchemaVersions(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	schemas, err := h.dbClient.ListConfigSchemaVersions(c.Request.Context(), namespace, name)
+	if err != nil {
+		h.logger.Warn("Failed to list config schema versions", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+	if len(schemas) == 0 {
+		problem.AbortError(c, sql.ErrNoRows, "Config schema")
+		return
+	}
+	items := make([]configSchemaView, 0, len(schemas))
+	for _, s := range schemas {
+		items = append(items, newConfigSchemaView(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// getConfigSchema handles GET /schemas/:name and GET /schemas/:name/versions/:version
+func (h *Handlers) getConfigSchema(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	version := 0
+	if value := c.Param("version"); value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 {
+			problem.Write(c, problem.New(problem.CodeValidation, "Invalid path parameters").WithFields(problem.FieldError{
+				Field:   "version",
+				Message: "must be a positive number",
+			}))
+			return
+		}
+		version = v
+	}
+
+	schema, err := h.dbClient.GetConfigSchema(c.Request.Context(), namespace, name, version)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to get config schema", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+	c.JSON(http.StatusOK, newConfigSchemaView(*schema))
+}
+
+// deleteConfigSchema handles DELETE /schemas/:name, removing all its versions
+func (h *Handlers) deleteConfigSchema(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	if !requireSchemaAdmin(c, namespace) {
+		return
+	}
+	if err := h.dbClient.DeleteConfigSchema(c.Request.Context(), namespace, name); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to delete config schema", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+	h.logger.Info("Deleted config schema", zap.String("name", name), zap.String("namespace", namespace))
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully deleted config schema"})
+}
+
+// validateApplicationConfig handles POST /configs/validate, a dry run of the schema check done on
+// create, update and patch, including the resolution of any bases. Nothing is stored. An invalid config gets the same 422 a write would.
+func (h *Handlers) validateApplicationConfig(c *gin.Context) {
+	var req ConfigValidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, problem.FromBindError(err))
+		return
+	}
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = c.DefaultQuery("namespace", "default")
+	}
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	bound, err := h.checkConfig(c.Request.Context(), &postgres.ApplicationConfig{
+		Name:       req.Name,
+		Namespace:  namespace,
+		UserID:     userID,
+		ConfigData: string(req.ConfigData),
+		Bases:      req.Bases,
+	})
+	if err != nil {
+		var p *problem.Problem
+		if !errors.As(err, &p) {
+			h.logger.Warn("Failed to validate application config", zap.Error(err), zap.String("name", req.Name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Config schema")
+		return
+	}
+
+	response := gin.H{"valid": true, "schema": nil}
+	if bound != nil {
+		response["schema"] = gin.H{"name": bound.schema.Name, "version": bound.schema.Version}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// sortFieldErrors orders field errors by path so responses are stable
+func sortFieldErrors(fields []problem.FieldError) {
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+}
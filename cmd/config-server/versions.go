@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+)
+
+// configVersionView is the API representation of a config version
+type configVersionView struct {
+	Version        int                  `json:"version"`
+	ConfigData     json.RawMessage      `json:"config_data,omitempty"`
+	Bases          postgres.ConfigBases `json:"bases,omitempty"`
+	AuthorID       *int                 `json:"author_id"`
+	Message        string               `json:"message"`
+	RolledBackFrom int                  `json:"rolled_back_from,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+}
+
+func newConfigVersionView(v postgres.ConfigVersion) configVersionView {
+	view := configVersionView{
+		Version:        v.Version,
+		Message:        v.Message,
+		RolledBackFrom: v.RolledBackFrom,
+		CreatedAt:      v.CreatedAt,
+	}
+	if v.AuthorID != 0 {
+		view.AuthorID = &v.AuthorID
+	}
+	if v.ConfigData != "" {
+		view.ConfigData = json.RawMessage(v.ConfigData)
+		view.Bases = v.Bases
+	}
+	return view
+}
+
+// RollbackRequest selects the version whose data should be restored
+type RollbackRequest struct {
+	Version int    `json:"version" binding:"required,min=1"`
+	Message string `json:"message" binding:"max=500"`
+}
+
+// listConfigVersions handles GET /configs/:name/versions, newest first
+func (h *Handlers) listConfigVersions(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	versions, err := h.dbClient.ListApplicationConfigVersions(c.Request.Context(), name, namespace, userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to list config versions", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config")
+		return
+	}
+
+	items := make([]configVersionView, 0, len(versions))
+	for _, v := range versions {
+		items = append(items, newConfigVersionView(v))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// getConfigVersion handles GET /configs/:name/versions/:version
+func (h *Handlers) getConfigVersion(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		problem.Write(c, problem.New(problem.CodeValidation, "Invalid path parameters").WithFields(problem.FieldError{
+			Field:   "version",
+			Message: "must be a positive number",
+		}))
+		return
+	}
+
+	v, err := h.dbClient.GetApplicationConfigVersion(c.Request.Context(), name, namespace, userID, version)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Failed to get config version", zap.Error(err), zap.String("name", name), zap.Int("version", version))
+		}
+		problem.AbortError(c, err, "Application config version")
+		return
+	}
+	c.JSON(http.StatusOK, newConfigVersionView(*v))
+}
+
+// rollbackApplicationConfig handles POST /configs/:name/rollback, restoring the data of an earlier
+// version as a new version. If-Match is honoured but not required, the target version is explicit.
+// The restored data and bases must pass the same schema and base checks as an update.
+func (h *Handlers) rollbackApplicationConfig(c *gin.Context) {
+	name := c.Param("name")
+	namespace := c.DefaultQuery("namespace", "default")
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+
+	expected, p := configPrecondition(c, false)
+	if p != nil {
+		problem.Write(c, p)
+		return
+	}
+
+	var req RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Warn("Failed to bind JSON for config rollback", zap.Error(err))
+		problem.Write(c, problem.FromBindError(err))
+		return
+	}
+	message := req.Message
+	if message == "" {
+		message = fmt.Sprintf("Rolled back to version %d", req.Version)
+	}
+
+	// Schemas and bases may have changed since the version was written, so it is checked like any change
+	config, err := h.dbClient.RollbackApplicationConfig(c.Request.Context(), name, namespace, userID, req.Version, expected, message,
+		func(restored *postgres.ApplicationConfig) error {
+			_, err := h.checkConfig(c.Request.Context(), restored)
+			return err
+		})
+	if err != nil {
+		var p *problem.Problem
+		if errors.As(err, &p) {
+			h.logger.Info("Rejected config rollback", zap.String("name", name), zap.String("namespace", namespace), zap.Int("version", req.Version), zap.String("reason", p.Detail))
+		} else if errors.Is(err, sql.ErrNoRows) {
+			h.logger.Warn("Rollback target not found", zap.String("name", name), zap.String("namespace", namespace), zap.Int("version", req.Version))
+		} else {
+			h.logger.Warn("Failed to roll back application config", zap.Error(err), zap.String("name", name), zap.String("namespace", namespace))
+		}
+		problem.AbortError(c, err, "Application config version")
+		return
+	}
+
+	h.logger.Info("Rolled back application config",
+		zap.String("name", name),
+		zap.String("namespace", namespace),
+		zap.Int("from_version", req.Version),
+		zap.Int("version", config.Version),
+	)
+	setConfigETag(c, config)
+	c.JSON(http.StatusOK, configBody(config))
+}
+
+// configBody renders a config the way GET /configs/:name does
+func configBody(config *postgres.ApplicationConfig) gin.H {
+	return gin.H{
+		"id":          config.ID,
+		"name":        config.Name,
+		"namespace":   config.Namespace,
+		"user_id":     config.UserID,
+		"config_data": json.RawMessage(config.ConfigData),
+		"bases":       config.Bases,
+		"version":     config.Version,
+		"created_at":  config.CreatedAt,
+		"updated_at":  config.UpdatedAt,
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+	"go.uber.org/zap"
+)
+
+const (
+	watchBufferSize    = 64               // Events queued for a watcher before it is dropped as too slow
+	watchBatchSize     = 500              // Events read per query
+	watchPollInterval  = 30 * time.Second // Fallback read in case a notification was lost
+	watchKeepalive     = 15 * time.Second // SSE comments that stop idle proxies closing the stream
+	maxLongPollWait    = 25 * time.Second // Below the gateway's 30s timeout for non-streaming requests
+	configEventMaxAge  = 7 * 24 * time.Hour
+	configEventPruning = time.Hour
+)
+
+// configEventView is a config event as sent to watchers
+type configEventView struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func viewConfigEvent(event postgres.ConfigEvent) configEventView {
+	return configEventView{
+		ID:        event.ID,
+		Type:      event.Type,
+		Namespace: event.Namespace,
+		Name:      event.Name,
+		Version:   event.Version,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+// watcher receives the events matching its filter until its channel is closed
+type watcher struct {
+	filter postgres.ConfigEventFilter
+	events chan postgres.ConfigEvent
+}
+
+// matches applies the filter the way ListConfigEvents does, zero values match everything
+func (w *watcher) matches(event postgres.ConfigEvent) bool {
+	return (w.filter.UserID == 0 || w.filter.UserID == event.UserID) &&
+		(w.filter.Namespace == "" || w.filter.Namespace == event.Namespace) &&
+		(w.filter.Name == "" || w.filter.Name == event.Name)
+}
+
+// eventHub reads new config events when Postgres notifies it and fans them out to watchers, so a
+// notification costs one query however many clients are watching
+type eventHub struct {
+	dbClient *postgres.Client
+	listener *pq.Listener
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	lastID   int64 // Newest event published, every later event reaches current watchers
+	draining bool
+}
+
+// newEventHub starts publishing from the newest stored event
+func newEventHub(ctx context.Context, dbClient *postgres.Client, listener *pq.Listener, logger *zap.Logger) (*eventHub, error) {
+	lastID, err := dbClient.LatestConfigEventID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &eventHub{
+		dbClient: dbClient,
+		listener: listener,
+		logger:   logger,
+		watchers: map[*watcher]struct{}{},
+		lastID:   lastID,
+	}, nil
+}
+
+// run publishes events until ctx is cancelled. Old events are pruned along the way.
+func (hub *eventHub) run(ctx context.Context) {
+	poll := time.NewTicker(watchPollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(configEventPruning)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-hub.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification follows a reconnect, reading catches up on whatever was missed
+			hub.poll(ctx)
+		case <-poll.C:
+			if err := hub.listener.Ping(); err != nil {
+				hub.logger.Warn("Config event listener is not connected", zap.Error(err))
+			}
+			hub.poll(ctx)
+		case <-prune.C:
+			pruned, err := hub.dbClient.PruneConfigEvents(ctx, time.Now().Add(-configEventMaxAge))
+			if err != nil {
+				hub.logger.Warn("Failed to prune config events", zap.Error(err))
+			} else if pruned > 0 {
+				hub.logger.Info("Pruned config events", zap.Int64("count", pruned))
+			}
+		}
+	}
+}
+
+// poll reads the events after the last published one and publishes them
+func (hub *eventHub) poll(ctx context.Context) {
+	for {
+		hub.mu.Lock()
+		after := hub.lastID
+		hub.mu.Unlock()
+
+		events, err := hub.dbClient.ListConfigEvents(ctx, postgres.ConfigEventFilter{}, after, watchBatchSize)
+		if err != nil {
+			hub.logger.Warn("Failed to read config events", zap.Error(err))
+			return
+		}
+		if len(events) > 0 {
+			hub.publish(events)
+		}
+		if len(events) < watchBatchSize {
+			return
+		}
+	}
+}
+
+// publish hands events to matching watchers. A watcher whose queue is full is dropped rather than
+// holding up the others, its client resumes from the last event it received.
+func (hub *eventHub) publish(events []postgres.ConfigEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, event := range events {
+		for w := range hub.watchers {
+			if !w.matches(event) {
+				continue
+			}
+			select {
+			case w.events <- event:
+			default:
+				hub.logger.Info("Dropping config watcher that fell behind", zap.String("namespace", w.filter.Namespace), zap.String("name", w.filter.Name))
+				delete(hub.watchers, w)
+				close(w.events)
+			}
+		}
+		hub.lastID = event.ID
+	}
+}
+
+// subscribe registers a watcher and returns the ID of the last event published before it, every
+// later event matching filter is delivered to the watcher. While draining the watcher is closed
+// straight away.
+func (hub *eventHub) subscribe(filter postgres.ConfigEventFilter) (*watcher, int64) {
+	w := &watcher{filter: filter, events: make(chan postgres.ConfigEvent, watchBufferSize)}
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.draining {
+		close(w.events)
+	} else {
+		hub.watchers[w] = struct{}{}
+	}
+	return w, hub.lastID
+}
+
+func (hub *eventHub) unsubscribe(w *watcher) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, ok := hub.watchers[w]; ok {
+		delete(hub.watchers, w)
+		close(w.events)
+	}
+}
+
+// drain ends every watch so that open streams do not hold up server shutdown. Clients reconnect to
+// another replica and resume.
+func (hub *eventHub) drain() {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.draining = true
+	for w := range hub.watchers {
+		delete(hub.watchers, w)
+		close(w.events)
+	}
+}
+
+// watchPosition is where a watch starts: after an event ID, or from the current position after a
+// reset when the client's position can no longer be resumed
+type watchPosition struct {
+	after    int64
+	fromNow  bool
+	reset    bool
+	resetWhy string
+}
+
+// watchStart works out where to resume from. The Last-Event-ID header, sent by EventSource on
+// reconnect, takes precedence over ?since. With neither, ?version resumes after the event that
+// wrote that version of the watched config. Without any of them the watch starts from now.
+func (h *Handlers) watchStart(c *gin.Context, filter postgres.ConfigEventFilter) (watchPosition, error) {
+	since, sinceField := c.GetHeader("Last-Event-ID"), "Last-Event-ID"
+	if since == "" {
+		since, sinceField = c.Query("since"), "since"
+	}
+	ctx := c.Request.Context()
+
+	if since != "" {
+		after, err := strconv.ParseInt(since, 10, 64)
+		if err != nil || after < 0 {
+			return watchPosition{}, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+				Field:   sinceField,
+				Message: "must be an event ID",
+			})
+		}
+		// Zero is the position of an empty event log, everything stored comes after it
+		if after == 0 {
+			return watchPosition{after: 0}, nil
+		}
+		retained, err := h.dbClient.ConfigEventRetained(ctx, after)
+		if err != nil {
+			return watchPosition{}, err
+		}
+		if !retained {
+			return watchPosition{fromNow: true, reset: true, resetWhy: fmt.Sprintf("Event %d is no longer retained", after)}, nil
+		}
+		return watchPosition{after: after}, nil
+	}
+
+	raw := c.Query("version")
+	if raw == "" {
+		return watchPosition{fromNow: true}, nil
+	}
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 || filter.Name == "" {
+		message := "must be a positive number"
+		if filter.Name == "" {
+			message = "requires name"
+		}
+		return watchPosition{}, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+			Field:   "version",
+			Message: message,
+		})
+	}
+	after, err := h.dbClient.ConfigEventForVersion(ctx, filter, version)
+	if err == nil {
+		return watchPosition{after: after}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return watchPosition{}, err
+	}
+	// The event was pruned, which only matters if the config has moved on since
+	current, err := h.dbClient.GetApplicationConfigByNameAndNamespace(ctx, filter.Name, filter.Namespace, filter.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return watchPosition{}, err
+	}
+	if err == nil && current.Version == version {
+		return watchPosition{fromNow: true}, nil
+	}
+	return watchPosition{fromNow: true, reset: true, resetWhy: fmt.Sprintf("Version %d of %s is no longer current or retained", version, configKey(filter.Namespace, filter.Name))}, nil
+}
+
+// watchConfigs handles GET /configs/watch. Changes to the caller's configs in ?namespace, or to the
+// single config ?name, are sent as Server-Sent Events when the client accepts text/event-stream, and
+// otherwise as a long poll that answers once there is at least one event or ?timeout seconds pass.
+// Each event carries its ID, to resume from with Last-Event-ID or ?since. When the position cannot
+// be resumed because its events were pruned, a reset is sent and the client should read the
+// configs again.
+func (h *Handlers) watchConfigs(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.GetHeader("X-User-ID"))
+	filter := postgres.ConfigEventFilter{
+		UserID:    userID,
+		Namespace: c.DefaultQuery("namespace", "default"),
+		Name:      c.Query("name"),
+	}
+	stream := strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+
+	wait := maxLongPollWait
+	if raw := c.Query("timeout"); raw != "" && !stream {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxLongPollWait {
+			problem.Write(c, problem.New(problem.CodeValidation, "Invalid query parameters").WithFields(problem.FieldError{
+				Field:   "timeout",
+				Message: fmt.Sprintf("must be between 0 and %d seconds", int(maxLongPollWait/time.Second)),
+			}))
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	position, err := h.watchStart(c, filter)
+	if err != nil {
+		var p *problem.Problem
+		if !errors.As(err, &p) {
+			h.logger.Warn("Failed to resume config watch", zap.Error(err), zap.String("namespace", filter.Namespace), zap.String("name", filter.Name))
+		}
+		problem.AbortError(c, err, "Config event")
+		return
+	}
+
+	// Subscribe before reading the backlog, so nothing written in between is missed
+	w, subscribedAt := h.events.subscribe(filter)
+	defer h.events.unsubscribe(w)
+	if position.fromNow {
+		position.after = subscribedAt
+	}
+
+	var backlog []postgres.ConfigEvent
+	for cursor := position.after; cursor < subscribedAt; {
+		events, err := h.dbClient.ListConfigEvents(c.Request.Context(), filter, cursor, watchBatchSize)
+		if err != nil {
+			h.logger.Warn("Failed to read config events", zap.Error(err), zap.String("namespace", filter.Namespace), zap.String("name", filter.Name))
+			problem.AbortError(c, err, "Config event")
+			return
+		}
+		backlog = append(backlog, events...)
+		if len(events) < watchBatchSize {
+			break
+		}
+		cursor = events[len(events)-1].ID
+	}
+
+	// Watches outlive the server's write timeout
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	if stream {
+		h.streamConfigEvents(c, w, position, backlog)
+	} else {
+		h.pollConfigEvents(c, w, position, backlog, wait)
+	}
+}
+
+// streamConfigEvents writes events as Server-Sent Events until the client goes away, the watcher
+// is dropped or the server drains
+func (h *Handlers) streamConfigEvents(c *gin.Context, w *watcher, position watchPosition, backlog []postgres.ConfigEvent) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	last := position.after
+	send := func(id int64, event string, data interface{}) bool {
+		payload, _ := json.Marshal(data)
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", id, event, payload); err != nil {
+			return false
+		}
+		last = id
+		return true
+	}
+
+	if position.reset && !send(position.after, "reset", gin.H{"reason": position.resetWhy}) {
+		return
+	}
+	for _, event := range backlog {
+		if !send(event.ID, event.Type, viewConfigEvent(event)) {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(watchKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-w.events:
+			if !ok {
+				return
+			}
+			if event.ID <= last {
+				continue // Already sent with the backlog
+			}
+			if !send(event.ID, event.Type, viewConfigEvent(event)) {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// pollConfigEvents answers a long poll with the backlog, or waits up to wait for the next events
+func (h *Handlers) pollConfigEvents(c *gin.Context, w *watcher, position watchPosition, backlog []postgres.ConfigEvent, wait time.Duration) {
+	events := make([]configEventView, 0, len(backlog))
+	last := position.after
+	add := func(event postgres.ConfigEvent) {
+		if event.ID > last {
+			events = append(events, viewConfigEvent(event))
+			last = event.ID
+		}
+	}
+	for _, event := range backlog {
+		add(event)
+	}
+
+	if len(events) == 0 && !position.reset {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+	waiting:
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-timer.C:
+				break waiting
+			case event, ok := <-w.events:
+				if !ok {
+					break waiting
+				}
+				add(event)
+				if len(events) > 0 {
+					break waiting
+				}
+			}
+		}
+		// Take whatever else arrived with the same notification
+	drain:
+		for {
+			select {
+			case event, ok := <-w.events:
+				if !ok {
+					break drain
+				}
+				add(event)
+			default:
+				break drain
+			}
+		}
+	}
+
+	response := gin.H{"events": events, "last_event_id": last, "reset": position.reset}
+	if position.reset {
+		response["reason"] = position.resetWhy
+	}
+	// Each poll answers from its own position, a cached copy would replay or skip events
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
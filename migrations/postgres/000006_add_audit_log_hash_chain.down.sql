@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+
+ALTER TABLE audit_logs
+    DROP COLUMN IF EXISTS entry_hash,
+    DROP COLUMN IF EXISTS prev_hash;
@@ -0,0 +1,16 @@
+-- Each entry stores the SHA-256 of its contents chained to the previous entry's hash.
+-- Entries written before this migration keep NULL hashes and are reported as unchained.
+ALTER TABLE audit_logs
+    ADD COLUMN prev_hash CHAR(64),
+    ADD COLUMN entry_hash CHAR(64);
+
+-- HMAC-signed snapshots of the chain head, so a rewritten chain cannot be re-signed without the key
+CREATE TABLE audit_checkpoints (
+    id SERIAL PRIMARY KEY,
+    last_log_id INTEGER NOT NULL,
+    entry_hash CHAR(64) NOT NULL,
+    signature CHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_checkpoints_last_log_id ON audit_checkpoints(last_log_id);
@@ -0,0 +1,41 @@
+DROP TABLE IF EXISTS audit_chain_anchors;
+
+-- Archived partitions are not restored, only rows still in audit_logs are kept
+ALTER TABLE audit_logs RENAME TO audit_logs_partitioned;
+ALTER SEQUENCE audit_logs_id_seq OWNED BY NONE;
+DROP INDEX idx_audit_logs_user_id;
+DROP INDEX idx_audit_logs_resource_type;
+DROP INDEX idx_audit_logs_created_at;
+ALTER TABLE audit_logs_partitioned RENAME CONSTRAINT audit_logs_pkey TO audit_logs_partitioned_pkey;
+
+CREATE TABLE audit_logs (
+    id INTEGER PRIMARY KEY DEFAULT nextval('audit_logs_id_seq'),
+    user_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_name VARCHAR(100) NOT NULL,
+    namespace VARCHAR(100) NOT NULL DEFAULT 'default',
+    request_data JSONB,
+    status VARCHAR(20) NOT NULL,
+    message TEXT,
+    client_ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    prev_hash CHAR(64),
+    entry_hash CHAR(64)
+);
+
+ALTER SEQUENCE audit_logs_id_seq OWNED BY audit_logs.id;
+
+INSERT INTO audit_logs
+SELECT id, user_id, action, resource_type, resource_name, namespace, request_data, status, message, client_ip, created_at, prev_hash, entry_hash
+FROM audit_logs_partitioned;
+
+DROP TABLE audit_logs_partitioned;
+
+-- Restore the foreign key, entries of deleted users lose their user as before
+UPDATE audit_logs SET user_id = NULL WHERE user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users);
+ALTER TABLE audit_logs ADD CONSTRAINT audit_logs_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX idx_audit_logs_resource_type ON audit_logs(resource_type);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
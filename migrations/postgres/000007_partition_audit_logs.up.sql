@@ -0,0 +1,65 @@
+-- Convert audit_logs to a table range-partitioned by month on created_at. Existing rows are copied
+-- into monthly partitions named audit_logs_YYYY_MM; the gateway creates future partitions ahead of time.
+ALTER TABLE audit_logs RENAME TO audit_logs_unpartitioned;
+ALTER TABLE audit_logs_unpartitioned RENAME CONSTRAINT audit_logs_pkey TO audit_logs_unpartitioned_pkey;
+DROP INDEX idx_audit_logs_user_id;
+DROP INDEX idx_audit_logs_resource_type;
+DROP INDEX idx_audit_logs_created_at;
+ALTER SEQUENCE audit_logs_id_seq OWNED BY NONE;
+
+-- user_id is no longer a foreign key: ON DELETE SET NULL would rewrite hash-chained entries
+CREATE TABLE audit_logs (
+    id INTEGER NOT NULL DEFAULT nextval('audit_logs_id_seq'),
+    user_id INTEGER,
+    action VARCHAR(50) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_name VARCHAR(100) NOT NULL,
+    namespace VARCHAR(100) NOT NULL DEFAULT 'default',
+    request_data JSONB,
+    status VARCHAR(20) NOT NULL,
+    message TEXT,
+    client_ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    prev_hash CHAR(64),
+    entry_hash CHAR(64),
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+ALTER SEQUENCE audit_logs_id_seq OWNED BY audit_logs.id;
+
+-- Indexes for better performance, created on every partition
+CREATE INDEX idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX idx_audit_logs_resource_type ON audit_logs(resource_type);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
+
+-- One partition per UTC month, from the oldest entry to three months ahead
+DO $$
+DECLARE
+    month_start TIMESTAMP WITH TIME ZONE;
+BEGIN
+    PERFORM set_config('timezone', 'UTC', true);
+    SELECT date_trunc('month', COALESCE(MIN(created_at), now())) INTO month_start FROM audit_logs_unpartitioned;
+    WHILE month_start <= date_trunc('month', now()) + INTERVAL '3 months' LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF audit_logs FOR VALUES FROM (%L) TO (%L)',
+            'audit_logs_' || to_char(month_start, 'YYYY_MM'), month_start, month_start + INTERVAL '1 month'
+        );
+        month_start := month_start + INTERVAL '1 month';
+    END LOOP;
+END $$;
+
+INSERT INTO audit_logs (id, user_id, action, resource_type, resource_name, namespace, request_data, status, message, client_ip, created_at, prev_hash, entry_hash)
+SELECT id, user_id, action, resource_type, resource_name, namespace, request_data, status, message, client_ip, COALESCE(created_at, CURRENT_TIMESTAMP), prev_hash, entry_hash
+FROM audit_logs_unpartitioned;
+
+DROP TABLE audit_logs_unpartitioned;
+
+-- Hashes of archived entries that remaining entries still link to, so verification can cross
+-- the gap left by dropped partitions. Signed with the checkpoint key when one is configured.
+CREATE TABLE audit_chain_anchors (
+    entry_hash CHAR(64) PRIMARY KEY,
+    log_id INTEGER NOT NULL,
+    partition_name VARCHAR(63) NOT NULL,
+    signature CHAR(64),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
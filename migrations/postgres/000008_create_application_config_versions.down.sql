@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS application_config_versions_immutable ON application_config_versions;
+DROP FUNCTION IF EXISTS prevent_config_version_update();
+DROP TABLE IF EXISTS application_config_versions;
+
+ALTER TABLE application_configs
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,30 @@
+-- Every change to an application config is kept as an immutable version row
+ALTER TABLE application_configs
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE application_config_versions (
+    id BIGSERIAL PRIMARY KEY,
+    config_id INTEGER NOT NULL REFERENCES application_configs(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    config_data JSONB NOT NULL,
+    author_id INTEGER, -- No foreign key, the author stays recorded after the user is removed
+    message TEXT NOT NULL DEFAULT '',
+    rolled_back_from INTEGER, -- Version restored by a rollback, NULL for ordinary changes
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(config_id, version)
+);
+
+-- Existing configs start their history with their current contents
+INSERT INTO application_config_versions (config_id, version, config_data, author_id, message, created_at)
+SELECT id, 1, config_data, user_id, 'Initial version', COALESCE(updated_at, CURRENT_TIMESTAMP)
+FROM application_configs;
+
+-- Versions are never changed once written
+CREATE FUNCTION prevent_config_version_update() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'application config versions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER application_config_versions_immutable BEFORE UPDATE ON application_config_versions
+FOR EACH ROW EXECUTE FUNCTION prevent_config_version_update();
@@ -0,0 +1,16 @@
+-- JSON Schemas that application configs are validated against. Registering a schema again adds a
+-- version, the latest version of each schema is the one in force.
+CREATE TABLE config_schemas (
+    id SERIAL PRIMARY KEY,
+    namespace VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    version INTEGER NOT NULL,
+    config_pattern VARCHAR(200) NOT NULL, -- Config names the schema applies to, a glob such as payments-*
+    schema JSONB NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    author_id INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(namespace, name, version)
+);
+
+CREATE INDEX idx_config_schemas_namespace ON config_schemas(namespace, name, version DESC);
@@ -0,0 +1,5 @@
+ALTER TABLE application_config_versions
+    DROP COLUMN IF EXISTS bases;
+
+ALTER TABLE application_configs
+    DROP COLUMN IF EXISTS bases;
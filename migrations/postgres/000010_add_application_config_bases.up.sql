@@ -0,0 +1,7 @@
+-- Configs a config is layered on, [{"namespace": "...", "name": "..."}] applied in order before its own data.
+-- Bases are part of each version, so a rollback restores them too.
+ALTER TABLE application_configs
+    ADD COLUMN bases JSONB NOT NULL DEFAULT '[]';
+
+ALTER TABLE application_config_versions
+    ADD COLUMN bases JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,27 @@
+-- Requests to copy a version of a config into another namespace, applied once approved. The data
+-- is copied when the request is made, so later changes to the source do not alter what is reviewed.
+CREATE TABLE config_promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    user_id INTEGER NOT NULL, -- Owner of the source and target configs
+    source_namespace VARCHAR(100) NOT NULL,
+    source_version INTEGER NOT NULL,
+    target_namespace VARCHAR(100) NOT NULL,
+    target_config_id INTEGER,           -- NULL when the target did not exist, approval creates it
+    target_version INTEGER NOT NULL DEFAULT 0, -- Version of the target the request was made against
+    config_data JSONB NOT NULL,
+    bases JSONB NOT NULL DEFAULT '[]',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    message TEXT NOT NULL DEFAULT '',
+    requested_by INTEGER,
+    reviewed_by INTEGER,
+    review_comment TEXT NOT NULL DEFAULT '',
+    applied_version INTEGER, -- Version of the target written on approval
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    CHECK (source_namespace <> target_namespace)
+);
+
+-- One pending promotion per target config
+CREATE UNIQUE INDEX idx_config_promotions_pending ON config_promotions(user_id, target_namespace, name) WHERE status = 'pending';
+CREATE INDEX idx_config_promotions_target ON config_promotions(target_namespace, status, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS application_configs_events ON application_configs;
+DROP FUNCTION IF EXISTS record_config_event();
+DROP TABLE IF EXISTS config_events;
@@ -0,0 +1,52 @@
+-- Every write to an application config is recorded as an event and announced with NOTIFY, so
+-- watchers can follow changes live and resume after the last event they saw
+CREATE TABLE config_events (
+    id BIGSERIAL PRIMARY KEY,
+    config_id INTEGER NOT NULL, -- No foreign key, deletions are events too
+    user_id INTEGER,
+    name VARCHAR(100) NOT NULL,
+    namespace VARCHAR(100) NOT NULL,
+    version INTEGER NOT NULL, -- Version written, or the last version for a deletion
+    type VARCHAR(10) NOT NULL CHECK (type IN ('created', 'updated', 'deleted')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_config_events_config ON config_events(user_id, namespace, name, id);
+CREATE INDEX idx_config_events_created_at ON config_events(created_at);
+
+CREATE FUNCTION record_config_event() RETURNS TRIGGER AS $$
+DECLARE
+    config application_configs%ROWTYPE;
+    event_type VARCHAR(10);
+    event_id BIGINT;
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW IS NOT DISTINCT FROM OLD THEN
+        RETURN NULL;
+    END IF;
+    -- Held until commit, so events commit in ID order and a watcher resuming after an ID can never
+    -- miss an event that was assigned a lower ID but committed later
+    PERFORM pg_advisory_xact_lock(109291472516724); -- "cfgevt"
+
+    IF TG_OP = 'INSERT' THEN
+        config := NEW;
+        event_type := 'created';
+    ELSIF TG_OP = 'UPDATE' THEN
+        config := NEW;
+        event_type := 'updated';
+    ELSE
+        config := OLD;
+        event_type := 'deleted';
+    END IF;
+
+    INSERT INTO config_events (config_id, user_id, name, namespace, version, type)
+    VALUES (config.id, config.user_id, config.name, config.namespace, config.version, event_type)
+    RETURNING id INTO event_id;
+
+    -- Delivered on commit, listeners read the events themselves
+    PERFORM pg_notify('config_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER application_configs_events AFTER INSERT OR UPDATE OR DELETE ON application_configs
+FOR EACH ROW EXECUTE FUNCTION record_config_event();
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS application_config_versions_immutable ON application_config_versions;
+CREATE TRIGGER application_config_versions_immutable BEFORE UPDATE ON application_config_versions
+FOR EACH ROW EXECUTE FUNCTION prevent_config_version_update();
+
+-- The foreign key cannot be restored while versions of deleted configs remain
+DELETE FROM application_config_versions v
+WHERE NOT EXISTS (SELECT 1 FROM application_configs c WHERE c.id = v.config_id);
+
+ALTER TABLE application_config_versions
+    ADD CONSTRAINT application_config_versions_config_id_fkey
+    FOREIGN KEY (config_id) REFERENCES application_configs(id) ON DELETE CASCADE;
@@ -0,0 +1,8 @@
+-- History outlives the config: deleting a config no longer removes its versions, and versions can
+-- be neither changed nor deleted
+ALTER TABLE application_config_versions
+    DROP CONSTRAINT IF EXISTS application_config_versions_config_id_fkey;
+
+DROP TRIGGER IF EXISTS application_config_versions_immutable ON application_config_versions;
+CREATE TRIGGER application_config_versions_immutable BEFORE UPDATE OR DELETE ON application_config_versions
+FOR EACH ROW EXECUTE FUNCTION prevent_config_version_update();
@@ -0,0 +1,9 @@
+-- Refuse to drop entries that no monthly partition holds
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM audit_logs_default) THEN
+        RAISE EXCEPTION 'audit_logs_default still holds entries, create their monthly partitions first';
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS audit_logs_default;
@@ -0,0 +1,3 @@
+-- Entries outside every monthly partition land here instead of failing the insert, the partition
+-- maintenance moves them into their month once it is created
+CREATE TABLE IF NOT EXISTS audit_logs_default PARTITION OF audit_logs DEFAULT;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_application_config_versions_name;
+
+ALTER TABLE application_config_versions
+    DROP COLUMN IF EXISTS user_id,
+    DROP COLUMN IF EXISTS namespace,
+    DROP COLUMN IF EXISTS name;
@@ -0,0 +1,28 @@
+-- Versions carry the name, namespace and owner of their config, so the history of a deleted config
+-- can still be looked up by name
+ALTER TABLE application_config_versions
+    ADD COLUMN name VARCHAR(100),
+    ADD COLUMN namespace VARCHAR(100),
+    ADD COLUMN user_id INTEGER;
+
+-- Versions are immutable, the trigger is lifted for the backfill only
+ALTER TABLE application_config_versions DISABLE TRIGGER application_config_versions_immutable;
+
+UPDATE application_config_versions v
+SET name = c.name, namespace = c.namespace, user_id = c.user_id
+FROM application_configs c
+WHERE c.id = v.config_id;
+
+-- Configs deleted before this migration are named by their last event, while it is kept
+UPDATE application_config_versions v
+SET name = e.name, namespace = e.namespace, user_id = e.user_id
+FROM (
+    SELECT DISTINCT ON (config_id) config_id, name, namespace, user_id
+    FROM config_events
+    ORDER BY config_id, id DESC
+) e
+WHERE v.name IS NULL AND e.config_id = v.config_id;
+
+ALTER TABLE application_config_versions ENABLE TRIGGER application_config_versions_immutable;
+
+CREATE INDEX idx_application_config_versions_name ON application_config_versions(user_id, namespace, name, id);
@@ -0,0 +1,181 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"go.uber.org/zap"
+)
+
+// ChainStore reads and checkpoints the audit hash chain, implemented by *postgres.Client
+type ChainStore interface {
+	StreamAuditChain(ctx context.Context, fn func(postgres.AuditLog) error) error
+	CreateAuditCheckpoint(ctx context.Context, sign func(lastLogID int64, entryHash string) string) (*postgres.AuditCheckpoint, error)
+	ListAuditCheckpoints(ctx context.Context) ([]postgres.AuditCheckpoint, error)
+	ListAuditChainAnchors(ctx context.Context) ([]postgres.AuditChainAnchor, error)
+}
+
+// Signer signs and checks checkpoints with an HMAC-SHA256 key kept outside the database
+type Signer struct {
+	key []byte
+}
+
+// NewSigner creates a signer, the key must not be empty
+func NewSigner(key string) *Signer {
+	return &Signer{key: []byte(key)}
+}
+
+// Sign returns the hex signature of a chain head
+func (s *Signer) Sign(lastLogID int64, entryHash string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strconv.FormatInt(lastLogID, 10) + ":" + entryHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Valid reports whether signature matches the chain head
+func (s *Signer) Valid(lastLogID int64, entryHash, signature string) bool {
+	expected, err := hex.DecodeString(s.Sign(lastLogID, entryHash))
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
+
+// RunCheckpoints signs the chain head every interval until ctx is cancelled
+func RunCheckpoints(ctx context.Context, store ChainStore, signer *Signer, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkpoint, err := store.CreateAuditCheckpoint(ctx, signer.Sign)
+			if err != nil {
+				logger.Error("Failed to create audit checkpoint", zap.Error(err))
+				continue
+			}
+			if checkpoint != nil {
+				logger.Info("Created audit checkpoint", zap.Int64("last_log_id", checkpoint.LastLogID))
+			}
+		}
+	}
+}
+
+// BrokenLink locates the first point where the chain no longer matches its contents
+type BrokenLink struct {
+	LogID        int64  `json:"log_id"`
+	CheckpointID int    `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// Report is the outcome of walking the audit chain
+type Report struct {
+	Valid               bool        `json:"valid"`
+	EntriesChecked      int64       `json:"entries_checked"`
+	UnchainedEntries    int64       `json:"unchained_entries"` // Written before hashing was enabled
+	CheckpointsChecked  int         `json:"checkpoints_checked"`
+	ArchivedLinks       int         `json:"archived_links"`      // Links to entries in archived partitions
+	SignaturesVerified  bool        `json:"signatures_verified"` // False when no checkpoint key is configured
+	FirstBroken         *BrokenLink `json:"first_broken,omitempty"`
+	LastCheckpointLogID int64       `json:"last_checkpoint_log_id,omitempty"`
+}
+
+// errBroken stops the walk once a broken link has been found
+var errBroken = errors.New("audit chain is broken")
+
+// Verify walks the chain from the oldest entry, recomputing every hash, checking every link to the
+// previous entry and every checkpoint, and stops at the first broken link. A link may skip to an
+// entry in an archived partition when that entry was recorded as an anchor at archival.
+// Checkpoint and anchor signatures are only checked when signer is not nil.
+func Verify(ctx context.Context, store ChainStore, signer *Signer) (*Report, error) {
+	checkpoints, err := store.ListAuditCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byLogID := map[int64][]postgres.AuditCheckpoint{}
+	for _, cp := range checkpoints {
+		byLogID[cp.LastLogID] = append(byLogID[cp.LastLogID], cp)
+	}
+
+	anchorList, err := store.ListAuditChainAnchors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	anchors := make(map[string]postgres.AuditChainAnchor, len(anchorList))
+	for _, anchor := range anchorList {
+		anchors[anchor.EntryHash] = anchor
+	}
+
+	report := &Report{SignaturesVerified: signer != nil}
+	broken := func(link BrokenLink) error {
+		report.FirstBroken = &link
+		return errBroken
+	}
+
+	prev, chained := "", false
+	err = store.StreamAuditChain(ctx, func(log postgres.AuditLog) error {
+		if log.EntryHash == "" {
+			if !chained {
+				report.UnchainedEntries++
+				return nil
+			}
+			return broken(BrokenLink{LogID: log.ID, Reason: "entry has no hash"})
+		}
+		chained = true
+		report.EntriesChecked++
+
+		if log.PrevHash != prev {
+			anchor, archived := anchors[log.PrevHash]
+			if !archived {
+				return broken(BrokenLink{LogID: log.ID, Reason: "previous hash does not match the preceding entry, an entry was removed or reordered"})
+			}
+			if signer != nil && !signer.Valid(anchor.LogID, anchor.EntryHash, anchor.Signature) {
+				return broken(BrokenLink{LogID: log.ID, Reason: "archived entry " + strconv.FormatInt(anchor.LogID, 10) + " has no valid anchor signature"})
+			}
+			report.ArchivedLinks++
+		}
+		if postgres.AuditEntryHash(log) != log.EntryHash {
+			return broken(BrokenLink{LogID: log.ID, Reason: "entry contents do not match its hash"})
+		}
+		prev = log.EntryHash
+
+		for _, cp := range byLogID[log.ID] {
+			if signer != nil && !signer.Valid(cp.LastLogID, cp.EntryHash, cp.Signature) {
+				return broken(BrokenLink{LogID: log.ID, CheckpointID: cp.ID, Reason: "checkpoint signature is invalid"})
+			}
+			if cp.EntryHash != log.EntryHash {
+				return broken(BrokenLink{LogID: log.ID, CheckpointID: cp.ID, Reason: "entry hash differs from the signed checkpoint"})
+			}
+			report.CheckpointsChecked++
+			report.LastCheckpointLogID = log.ID
+		}
+		delete(byLogID, log.ID)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return nil, err
+	}
+
+	// Checkpoints whose entry was never reached mean entries were deleted from the end of the chain
+	if report.FirstBroken == nil {
+		for _, cp := range checkpoints {
+			if _, missing := byLogID[cp.LastLogID]; missing {
+				report.FirstBroken = &BrokenLink{LogID: cp.LastLogID, CheckpointID: cp.ID, Reason: "entry covered by the checkpoint is missing"}
+				break
+			}
+		}
+	}
+	report.Valid = report.FirstBroken == nil
+	return report, nil
+}
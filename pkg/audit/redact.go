@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive fields
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively as substrings of object keys, after removing
+// separators, so "DB_PASSWORD", "clientSecret" and "api-key" are all caught
+var sensitiveKeys = []string{
+	"password", "passwd", "secret", "token", "apikey", "accesskey", "privatekey",
+	"credential", "authorization", "cookie", "signature",
+}
+
+// isSensitive reports whether an object key names a value that must not be stored
+func isSensitive(key string) bool {
+	normalized := strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(key))
+	for _, s := range sensitiveKeys {
+		if strings.Contains(normalized, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactJSON returns body with the values of sensitive keys replaced at any depth, including the
+// value of JSON Patch operations on a sensitive path. size is the
+// full length of the body; when only a prefix was captured, or the body is not JSON, a summary
+// is returned instead of the content.
+func RedactJSON(body []byte, size int64) json.RawMessage {
+	if size == 0 {
+		return nil
+	}
+	if size > int64(len(body)) {
+		return summary("too_large", size)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return summary("not_json", size)
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return summary("not_json", size)
+	}
+	return redacted
+}
+
+// sensitivePointer reports whether any reference token of a JSON Pointer names a sensitive key
+func sensitivePointer(pointer string) bool {
+	for _, token := range strings.Split(pointer, "/") {
+		if isSensitive(strings.NewReplacer("~1", "/", "~0", "~").Replace(token)) {
+			return true
+		}
+	}
+	return false
+}
+
+// patchTargetsSensitive reports whether an object is a JSON Patch operation whose path or from
+// names a sensitive key. Its value is then written under that key and must not be stored.
+func patchTargetsSensitive(op map[string]interface{}) bool {
+	if _, ok := op["op"].(string); !ok {
+		return false
+	}
+	for _, field := range []string{"path", "from"} {
+		if pointer, ok := op[field].(string); ok && sensitivePointer(pointer) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := v["value"]; ok && patchTargetsSensitive(v) {
+			v["value"] = Redacted
+		}
+		for key, child := range v {
+			if isSensitive(key) {
+				v[key] = Redacted
+				continue
+			}
+			v[key] = redactValue(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// summary describes a body whose content is not stored
+func summary(reason string, size int64) json.RawMessage {
+	data, _ := json.Marshal(map[string]interface{}{
+		"_omitted": reason,
+		"_bytes":   size,
+	})
+	return data
+}
@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "object keys at any depth",
+			body: `{"name":"app","configData":{"db":{"DB_PASSWORD":"hunter2","host":"db"}}}`,
+			want: `{"configData":{"db":{"DB_PASSWORD":"[REDACTED]","host":"db"}},"name":"app"}`,
+		},
+		{
+			name: "json patch value on a sensitive path",
+			body: `[{"op":"replace","path":"/db_password","value":"hunter2"},{"op":"add","path":"/db/apiKey","value":{"v":"k"}}]`,
+			want: `[{"op":"replace","path":"/db_password","value":"[REDACTED]"},{"op":"add","path":"/db/apiKey","value":"[REDACTED]"}]`,
+		},
+		{
+			name: "json patch with an escaped token",
+			body: `[{"op":"test","path":"/client~1secret","value":"s3"}]`,
+			want: `[{"op":"test","path":"/client~1secret","value":"[REDACTED]"}]`,
+		},
+		{
+			name: "json patch value holding a sensitive key",
+			body: `[{"op":"add","path":"/db","value":{"password":"hunter2","host":"db"}}]`,
+			want: `[{"op":"add","path":"/db","value":{"host":"db","password":"[REDACTED]"}}]`,
+		},
+		{
+			name: "json patch on other paths is kept",
+			body: `[{"op":"replace","path":"/retries","value":3},{"op":"remove","path":"/token"}]`,
+			want: `[{"op":"replace","path":"/retries","value":3},{"op":"remove","path":"/token"}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RedactJSON([]byte(tt.body), int64(len(tt.body)))
+			if string(got) != tt.want {
+				t.Fatalf("RedactJSON() = %s, want %s", got, tt.want)
+			}
+			if strings.Contains(string(got), "hunter2") || strings.Contains(string(got), `"s3"`) {
+				t.Fatalf("secret left in %s", got)
+			}
+		})
+	}
+}
+
+func TestRedactJSONSummarizesUnreadableBodies(t *testing.T) {
+	for _, tt := range []struct {
+		body   string
+		size   int64
+		reason string
+	}{
+		{body: `{"password":`, size: 100, reason: "too_large"},
+		{body: `password=hunter2`, size: 16, reason: "not_json"},
+	} {
+		var got map[string]interface{}
+		if err := json.Unmarshal(RedactJSON([]byte(tt.body), tt.size), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["_omitted"] != tt.reason {
+			t.Fatalf("RedactJSON(%q) = %v, want %s", tt.body, got, tt.reason)
+		}
+	}
+}
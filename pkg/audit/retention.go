@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"go.uber.org/zap"
+)
+
+// PartitionStore manages the monthly audit_logs partitions, implemented by *postgres.Client
+type PartitionStore interface {
+	WithAuditMaintenanceLock(ctx context.Context, fn func() error) (bool, error)
+	EnsureAuditPartitions(ctx context.Context, from time.Time, months int) error
+	ListAuditPartitions(ctx context.Context) ([]postgres.AuditPartition, error)
+	DetachAuditPartition(ctx context.Context, name string) error
+	AnchorAuditPartition(ctx context.Context, name string, sign func(logID int64, entryHash string) string) error
+	StreamAuditPartition(ctx context.Context, name string, fn func(postgres.AuditLog) error) error
+	DropAuditPartition(ctx context.Context, name string) error
+}
+
+// RetentionOptions controls partition maintenance
+type RetentionOptions struct {
+	Retention       time.Duration // Partitions whose whole month is older are archived and dropped, zero keeps everything
+	ArchiveDir      string        // Directory for the gzip-compressed NDJSON archives
+	PartitionsAhead int           // Future months created in advance
+	Interval        time.Duration // How often maintenance runs
+	Signer          *Signer       // Signs chain anchors, may be nil
+	Logger          *zap.Logger
+}
+
+// archivedEntry is the NDJSON representation of an archived entry, hashes included so the
+// archive can be verified on its own
+type archivedEntry struct {
+	ID           int64           `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UserID       int             `json:"user_id,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceName string          `json:"resource_name"`
+	Namespace    string          `json:"namespace"`
+	RequestData  json.RawMessage `json:"request_data,omitempty"`
+	Status       string          `json:"status"`
+	Message      string          `json:"message,omitempty"`
+	ClientIP     string          `json:"client_ip,omitempty"`
+	PrevHash     string          `json:"prev_hash,omitempty"`
+	EntryHash    string          `json:"entry_hash,omitempty"`
+}
+
+// RunRetention maintains partitions immediately and then every interval until ctx is cancelled
+func RunRetention(ctx context.Context, store PartitionStore, opts RetentionOptions) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := MaintainPartitions(ctx, store, opts, time.Now()); err != nil {
+			opts.Logger.Error("Audit partition maintenance failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MaintainPartitions creates upcoming partitions, then archives and drops expired ones. A
+// partition is detached first, exported, and only dropped once its archive is safely on disk; a
+// run that fails part way resumes from the detached table next time.
+func MaintainPartitions(ctx context.Context, store PartitionStore, opts RetentionOptions, now time.Time) error {
+	ran, err := store.WithAuditMaintenanceLock(ctx, func() error {
+		if err := store.EnsureAuditPartitions(ctx, now, opts.PartitionsAhead); err != nil {
+			return err
+		}
+		if opts.Retention <= 0 {
+			return nil
+		}
+
+		partitions, err := store.ListAuditPartitions(ctx)
+		if err != nil {
+			return err
+		}
+		cutoff := now.Add(-opts.Retention)
+		for _, partition := range partitions {
+			if partition.To.After(cutoff) {
+				continue
+			}
+			if err := archivePartition(ctx, store, opts, partition); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil && !ran {
+		opts.Logger.Debug("Audit partition maintenance is running on another replica")
+	}
+	return err
+}
+
+// archivePartition detaches, exports and drops one expired partition
+func archivePartition(ctx context.Context, store PartitionStore, opts RetentionOptions, partition postgres.AuditPartition) error {
+	logger := opts.Logger.With(zap.String("partition", partition.Name))
+	if partition.Attached {
+		if err := store.DetachAuditPartition(ctx, partition.Name); err != nil {
+			return err
+		}
+		logger.Info("Detached expired audit partition")
+	}
+
+	var sign func(int64, string) string
+	if opts.Signer != nil {
+		sign = opts.Signer.Sign
+	}
+	if err := store.AnchorAuditPartition(ctx, partition.Name, sign); err != nil {
+		return err
+	}
+
+	path, rows, err := exportPartition(ctx, store, opts.ArchiveDir, partition.Name)
+	if err != nil {
+		return err
+	}
+	logger.Info("Archived audit partition", zap.String("file", path), zap.Int("rows", rows))
+
+	if err := store.DropAuditPartition(ctx, partition.Name); err != nil {
+		return err
+	}
+	logger.Info("Dropped archived audit partition")
+	return nil
+}
+
+// exportPartition writes a partition to <dir>/<name>.ndjson.gz. The file is written under a
+// temporary name, synced and renamed, so a crash never leaves a truncated archive behind.
+func exportPartition(ctx context.Context, store PartitionStore, dir, name string) (string, int, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, fmt.Errorf("error creating archive directory: %w", err)
+	}
+	path := filepath.Join(dir, name+".ndjson.gz")
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating archive file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after the rename
+	defer tmp.Close()
+
+	gz := gzip.NewWriter(tmp)
+	gz.Name = name + ".ndjson"
+	encoder := json.NewEncoder(gz)
+	rows := 0
+	err = store.StreamAuditPartition(ctx, name, func(log postgres.AuditLog) error {
+		rows++
+		entry := archivedEntry{
+			ID:           log.ID,
+			CreatedAt:    log.CreatedAt.UTC(),
+			UserID:       log.UserID,
+			Action:       log.Action,
+			ResourceType: log.ResourceType,
+			ResourceName: log.ResourceName,
+			Namespace:    log.Namespace,
+			Status:       log.Status,
+			Message:      log.Message,
+			ClientIP:     log.ClientIP,
+			PrevHash:     log.PrevHash,
+			EntryHash:    log.EntryHash,
+		}
+		if log.RequestData != "" {
+			entry.RequestData = json.RawMessage(log.RequestData)
+		}
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("error exporting %s: %w", name, err)
+	}
+	if err := gz.Close(); err != nil {
+		return "", 0, fmt.Errorf("error compressing %s: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return "", 0, fmt.Errorf("error syncing archive %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("error closing archive %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("error renaming archive %s: %w", path, err)
+	}
+	return path, rows, nil
+}
@@ -0,0 +1,259 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Event is a single audited action
+type Event = postgres.AuditEvent
+
+// Store persists batches of events, implemented by *postgres.Client
+type Store interface {
+	InsertAuditEvents(ctx context.Context, events []Event) error
+}
+
+// Options controls buffering and batching
+type Options struct {
+	BufferSize    int           // Events queued before Record starts dropping
+	BatchSize     int           // Events written per insert
+	FlushInterval time.Duration // Longest an event waits in a partial batch
+	WriteTimeout  time.Duration // Bound on a single insert
+	Retries       int           // Extra attempts for a failed batch before it is logged and dropped
+	Logger        *zap.Logger
+	Registerer    prometheus.Registerer // Metrics are not registered when nil
+}
+
+// DefaultOptions returns options suited to a single gateway replica
+func DefaultOptions(logger *zap.Logger) Options {
+	return Options{
+		BufferSize:    10000,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		WriteTimeout:  5 * time.Second,
+		Retries:       2,
+		Logger:        logger,
+	}
+}
+
+// ErrClosed is returned by Record after Close
+var ErrClosed = errors.New("audit writer is closed")
+
+// ErrBufferFull is returned by Record when the queue is full and the event was dropped
+var ErrBufferFull = errors.New("audit buffer is full")
+
+// column limits of audit_logs, longer values would fail the whole batch
+const (
+	maxActionLen       = 50
+	maxResourceTypeLen = 50
+	maxResourceNameLen = 100
+	maxNamespaceLen    = 100
+	maxStatusLen       = 20
+	maxClientIPLen     = 45
+)
+
+// Writer queues audit events in memory and writes them to the store in batches from a single
+// goroutine, so recording an event never waits on the database. Close drains the queue.
+type Writer struct {
+	store Store
+	opts  Options
+
+	mu     sync.RWMutex // guards closed against concurrent sends on events
+	closed bool
+	events chan Event
+	done   chan struct{}
+
+	recorded *prometheus.CounterVec
+	queued   prometheus.GaugeFunc
+}
+
+// NewWriter creates a writer and starts its background goroutine
+func NewWriter(store Store, opts Options) *Writer {
+	defaults := DefaultOptions(opts.Logger)
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaults.BufferSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaults.FlushInterval
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = defaults.WriteTimeout
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	w := &Writer{
+		store:  store,
+		opts:   opts,
+		events: make(chan Event, opts.BufferSize),
+		done:   make(chan struct{}),
+		recorded: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "audit_events_total",
+				Help: "Audit events by outcome: written, dropped (buffer full) or failed (store error)",
+			},
+			[]string{"result"},
+		),
+	}
+	w.queued = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "audit_events_queued",
+			Help: "Audit events waiting to be written",
+		},
+		func() float64 { return float64(len(w.events)) },
+	)
+	if opts.Registerer != nil {
+		opts.Registerer.MustRegister(w.recorded, w.queued)
+	}
+
+	go w.run()
+	return w
+}
+
+// Record queues an event without blocking. Events are dropped, and counted, when the queue is full.
+func (w *Writer) Record(event Event) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+	normalize(&event)
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrClosed
+	}
+	select {
+	case w.events <- event:
+		return nil
+	default:
+		w.recorded.WithLabelValues("dropped").Inc()
+		w.opts.Logger.Warn("Audit buffer full, dropping event",
+			zap.String("action", event.Action),
+			zap.String("resource_type", event.ResourceType),
+			zap.String("resource_name", event.ResourceName),
+		)
+		return ErrBufferFull
+	}
+}
+
+// Close stops accepting events and waits until everything queued has been written or ctx expires
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.events)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("audit writer did not drain %d events: %w", len(w.events), ctx.Err())
+	}
+}
+
+// run collects events into batches, writing when a batch is full or the flush interval passes
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, w.opts.BatchSize)
+	for {
+		select {
+		case event, ok := <-w.events:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.opts.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes a batch, retrying with a short backoff. A batch that still fails is written to the
+// log so the events survive in the log pipeline.
+func (w *Writer) flush(batch []Event) {
+	if len(batch) == 0 {
+		return
+	}
+
+	var err error
+	for attempt := 0; attempt <= w.opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), w.opts.WriteTimeout)
+		err = w.store.InsertAuditEvents(ctx, batch)
+		cancel()
+		if err == nil {
+			w.recorded.WithLabelValues("written").Add(float64(len(batch)))
+			return
+		}
+	}
+
+	w.recorded.WithLabelValues("failed").Add(float64(len(batch)))
+	w.opts.Logger.Error("Failed to write audit events", zap.Int("count", len(batch)), zap.Error(err))
+	for _, e := range batch {
+		w.opts.Logger.Warn("Unwritten audit event",
+			zap.Time("created_at", e.CreatedAt),
+			zap.Int("user_id", e.UserID),
+			zap.String("action", e.Action),
+			zap.String("resource_type", e.ResourceType),
+			zap.String("resource_name", e.ResourceName),
+			zap.String("namespace", e.Namespace),
+			zap.String("status", e.Status),
+			zap.String("message", e.Message),
+			zap.String("client_ip", e.ClientIP),
+			zap.String("request_data", e.RequestData),
+		)
+	}
+}
+
+// normalize fits the event into the audit_logs columns
+func normalize(e *Event) {
+	if e.Namespace == "" {
+		e.Namespace = "default"
+	}
+	e.Action = truncate(e.Action, maxActionLen)
+	e.ResourceType = truncate(e.ResourceType, maxResourceTypeLen)
+	e.ResourceName = truncate(e.ResourceName, maxResourceNameLen)
+	e.Namespace = truncate(e.Namespace, maxNamespaceLen)
+	e.Status = truncate(e.Status, maxStatusLen)
+	e.ClientIP = truncate(e.ClientIP, maxClientIPLen)
+}
+
+// truncate cuts s to at most n characters without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n])
+}
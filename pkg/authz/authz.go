@@ -0,0 +1,86 @@
+package authz
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/problem"
+)
+
+// Headers set by the API gateway from the authenticated token. The gateway drops any client-supplied
+// values, so services behind it can trust them.
+const (
+	UserIDHeader = "X-User-ID"
+	RolesHeader  = "X-User-Roles" // Comma-separated
+)
+
+// RoleAuditor may read and export the audit log
+const RoleAuditor = "auditor"
+
+// RoleConfigApprover, held for a namespace, may approve config promotions into that namespace
+const RoleConfigApprover = "config-approver"
+
+// RoleConfigSchemaAdmin, held for a namespace, may register and delete the config schemas of that
+// namespace. Schemas apply to every user's configs there, so they are not left to config owners.
+const RoleConfigSchemaAdmin = "config-schema-admin"
+
+// NamespaceRole scopes a role to one namespace, e.g. "prod:config-approver"
+func NamespaceRole(namespace, role string) string {
+	return namespace + ":" + role
+}
+
+// RolesFromClaims reads the roles claim, accepting a list or a space or comma separated string
+func RolesFromClaims(claims map[string]interface{}) []string {
+	var roles []string
+	switch value := claims["roles"].(type) {
+	case []interface{}:
+		for _, role := range value {
+			if s, ok := role.(string); ok && s != "" {
+				roles = append(roles, s)
+			}
+		}
+	case []string:
+		roles = append(roles, value...)
+	case string:
+		roles = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	return roles
+}
+
+// Roles returns the roles forwarded by the gateway
+func Roles(c *gin.Context) []string {
+	var roles []string
+	for _, role := range strings.Split(c.GetHeader(RolesHeader), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// HasRole reports whether the caller holds role
+func HasRole(c *gin.Context, role string) bool {
+	for _, r := range Roles(c) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole rejects callers without a user ID with 401 and callers holding none of roles with 403
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(UserIDHeader) == "" {
+			problem.Abort(c, problem.CodeUnauthorized, "The request is not authenticated")
+			return
+		}
+		for _, role := range roles {
+			if HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+		problem.Abort(c, problem.CodeForbidden, "This operation requires the "+strings.Join(roles, " or ")+" role")
+	}
+}
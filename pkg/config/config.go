@@ -0,0 +1,588 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/mongodb"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/db/postgres"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/tlsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when neither -config nor CONFIG_FILE is given. It is optional, a missing
+// default file leaves the built-in defaults in place.
+const DefaultFile = "config.yaml"
+
+// Config is the configuration shared by all service binaries
+type Config struct {
+	Server         ServerConfig         `yaml:"server"`
+	Database       DatabaseConfig       `yaml:"database"`
+	Kubernetes     KubernetesConfig     `yaml:"kubernetes"`
+	Auth           AuthConfig           `yaml:"auth"`
+	Logging        LoggingConfig        `yaml:"logging"`
+	CloudProviders CloudProvidersConfig `yaml:"cloud_providers"`
+	Services       ServicesConfig       `yaml:"services"`
+	Gateway        GatewayConfig        `yaml:"gateway"`
+	Audit          AuditConfig          `yaml:"audit"`
+	TLS            tlsutil.Config       `yaml:"tls"`
+}
+
+// ServerConfig contains the HTTP listener settings
+type ServerConfig struct {
+	Host    string        `yaml:"host"`
+	Port    int           `yaml:"port"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Addr returns the listen address
+func (s ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// DatabaseConfig contains the database connections
+type DatabaseConfig struct {
+	Postgres PostgresConfig `yaml:"postgres"`
+	MongoDB  MongoDBConfig  `yaml:"mongodb"`
+}
+
+// PostgresConfig contains the PostgreSQL connection and pool settings
+type PostgresConfig struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	DBName          string        `yaml:"dbname"`
+	SSLMode         string        `yaml:"sslmode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// Enabled reports whether a PostgreSQL host has been configured
+func (p PostgresConfig) Enabled() bool {
+	return p.Host != ""
+}
+
+// ClientConfig converts the section to the postgres client configuration
+func (p PostgresConfig) ClientConfig() postgres.Config {
+	return postgres.Config{
+		Host:            p.Host,
+		Port:            p.Port,
+		User:            p.User,
+		Password:        p.Password,
+		DBName:          p.DBName,
+		SSLMode:         p.SSLMode,
+		MaxOpenConns:    p.MaxOpenConns,
+		MaxIdleConns:    p.MaxIdleConns,
+		ConnMaxLifetime: p.ConnMaxLifetime,
+	}
+}
+
+// MongoDBConfig contains the MongoDB connection and pool settings
+type MongoDBConfig struct {
+	URI             string        `yaml:"uri"`
+	Database        string        `yaml:"database"`
+	Timeout         time.Duration `yaml:"timeout"`
+	MaxPoolSize     uint64        `yaml:"max_pool_size"`
+	MinPoolSize     uint64        `yaml:"min_pool_size"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+}
+
+// Enabled reports whether a MongoDB URI has been configured
+func (m MongoDBConfig) Enabled() bool {
+	return m.URI != ""
+}
+
+// ClientConfig converts the section to the mongodb client configuration
+func (m MongoDBConfig) ClientConfig() mongodb.Config {
+	return mongodb.Config{
+		URI:             m.URI,
+		Database:        m.Database,
+		Timeout:         m.Timeout,
+		MaxPoolSize:     m.MaxPoolSize,
+		MinPoolSize:     m.MinPoolSize,
+		MaxConnIdleTime: m.MaxConnIdleTime,
+	}
+}
+
+// KubernetesConfig contains cluster access settings
+type KubernetesConfig struct {
+	ConfigPath   string `yaml:"config_path"` // Empty for in-cluster config
+	Namespace    string `yaml:"namespace"`
+	OperatorName string `yaml:"operator_name"`
+}
+
+// AuthConfig contains token settings
+type AuthConfig struct {
+	JWTSecret    string        `yaml:"jwt_secret"`
+	TokenExpiry  time.Duration `yaml:"token_expiry"`
+	APIKeyExpiry time.Duration `yaml:"api_key_expiry"`
+}
+
+// LoggingConfig controls the zap logger built by NewLogger
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // json or text
+}
+
+// CloudProvidersConfig contains per-provider defaults
+type CloudProvidersConfig struct {
+	AWS struct {
+		Region string `yaml:"region"`
+	} `yaml:"aws"`
+	GCP struct {
+		ProjectID string `yaml:"project_id"`
+	} `yaml:"gcp"`
+	Azure struct {
+		SubscriptionID string `yaml:"subscription_id"`
+	} `yaml:"azure"`
+}
+
+// ServicesConfig contains the base URLs of the internal services
+type ServicesConfig struct {
+	AuthURL       string `yaml:"auth_url"`
+	APIURL        string `yaml:"api_url"`
+	DeploymentURL string `yaml:"deployment_url"`
+	MonitoringURL string `yaml:"monitoring_url"`
+	ConfigURL     string `yaml:"config_url"`
+}
+
+// GatewayConfig contains settings only used by the API gateway
+type GatewayConfig struct {
+	RateLimit           int               `yaml:"rate_limit"`
+	RateLimitInterval   time.Duration     `yaml:"rate_limit_interval"`
+	CacheMaxEntries     int               `yaml:"cache_max_entries"`
+	AdminPort           int               `yaml:"admin_port"`
+	AdminToken          string            `yaml:"admin_token"` // Admin API is disabled when empty
+	HealthCheckInterval time.Duration     `yaml:"health_check_interval"`
+	ClientCertAccounts  map[string]string `yaml:"client_cert_accounts"` // Client certificate common name to service account
+
+	CompressionMinSize   int `yaml:"compression_min_size"`   // Smallest response body that is compressed, in bytes
+	MaxDecompressedBytes int `yaml:"max_decompressed_bytes"` // Largest accepted request body after decompression
+
+	MaxBodyBytes      int64         `yaml:"max_body_bytes"`      // Default request body limit for routes without their own
+	MaxHeaderCount    int           `yaml:"max_header_count"`    // Most request header values accepted
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`    // Largest total size of request header names and values
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // Time allowed for a client to send the request headers
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // How long keep-alive connections may stay idle
+	MaxInFlight       int           `yaml:"max_in_flight"`       // Concurrent proxied requests before load shedding, 0 disables
+	MaxStreams        int           `yaml:"max_streams"`         // Concurrent event streams, limited apart from max_in_flight, 0 disables
+
+	MonitoringCacheTTL time.Duration `yaml:"monitoring_cache_ttl"`  // How long monitoring responses are cached, 0 disables caching
+	ConfigCacheTTL     time.Duration `yaml:"config_cache_ttl"`      // How long config responses are cached, 0 disables caching
+	ConfigMaxBodyBytes int64         `yaml:"config_max_body_bytes"` // Request body limit of the config, schema and promotion routes, imports excepted
+	ConfigCanaryURL    string        `yaml:"config_canary_url"`     // Canary deployment of the config service, canary routing is off when empty
+	ConfigCanaryWeight int           `yaml:"config_canary_weight"`  // Percentage of config traffic sent to the canary
+}
+
+// AuditConfig controls the batched audit log writer
+type AuditConfig struct {
+	BufferSize    int           `yaml:"buffer_size"`    // Events queued in memory before new ones are dropped
+	BatchSize     int           `yaml:"batch_size"`     // Events written per insert
+	FlushInterval time.Duration `yaml:"flush_interval"` // Longest an event waits in a partial batch
+	MaxBodyBytes  int           `yaml:"max_body_bytes"` // Largest request body stored, larger bodies are summarized
+
+	CheckpointKey      string        `yaml:"checkpoint_key"`      // HMAC key for signed chain checkpoints, checkpoints are disabled when empty
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval"` // How often the chain head is signed
+
+	Retention           time.Duration `yaml:"retention"`            // Monthly partitions older than this are archived and dropped, 0 keeps everything
+	ArchiveDir          string        `yaml:"archive_dir"`          // Where expired partitions are written as gzip-compressed NDJSON
+	PartitionsAhead     int           `yaml:"partitions_ahead"`     // Future monthly partitions created in advance
+	MaintenanceInterval time.Duration `yaml:"maintenance_interval"` // How often partitions are created and expired
+}
+
+// Default returns the built-in configuration used before the file, environment and flags are applied
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:    8080,
+			Timeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Postgres: PostgresConfig{
+				Port:            5432,
+				SSLMode:         "disable",
+				MaxOpenConns:    25,
+				MaxIdleConns:    5,
+				ConnMaxLifetime: 5 * time.Minute,
+			},
+			MongoDB: MongoDBConfig{
+				Database:        "k8s_platform",
+				Timeout:         10 * time.Second,
+				MaxPoolSize:     100,
+				MinPoolSize:     10,
+				MaxConnIdleTime: 30 * time.Second,
+			},
+		},
+		Kubernetes: KubernetesConfig{
+			Namespace: "default",
+		},
+		Auth: AuthConfig{
+			TokenExpiry:  24 * time.Hour,
+			APIKeyExpiry: 30 * 24 * time.Hour,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Services: ServicesConfig{
+			AuthURL:       "http://auth-service:8080",
+			APIURL:        "http://api-service:8080",
+			DeploymentURL: "http://deployment-service:8080",
+			MonitoringURL: "http://monitoring-service:8080",
+			ConfigURL:     "http://config-service:8082",
+		},
+		Gateway: GatewayConfig{
+			RateLimit:           100,
+			RateLimitInterval:   time.Second,
+			CacheMaxEntries:     10000,
+			AdminPort:           9090,
+			HealthCheckInterval: 15 * time.Second,
+
+			CompressionMinSize:   1024,
+			MaxDecompressedBytes: 10 << 20,
+
+			MaxBodyBytes:      1 << 20,
+			MaxHeaderCount:    100,
+			MaxHeaderBytes:    32 << 10,
+			ReadHeaderTimeout: 5 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxInFlight:       1000,
+			MaxStreams:        1000,
+
+			ConfigCacheTTL:     5 * time.Second,
+			ConfigMaxBodyBytes: 256 << 10,
+			ConfigCanaryWeight: 5,
+		},
+		Audit: AuditConfig{
+			BufferSize:    10000,
+			BatchSize:     100,
+			FlushInterval: time.Second,
+			MaxBodyBytes:  16 << 10,
+
+			CheckpointInterval: 5 * time.Minute,
+
+			ArchiveDir:          "audit-archive",
+			PartitionsAhead:     3,
+			MaintenanceInterval: time.Hour,
+		},
+		TLS: tlsutil.Config{
+			ReloadInterval: 30 * time.Second,
+		},
+	}
+}
+
+// Option adjusts the defaults of a single binary before the file is read
+type Option func(*Config)
+
+// WithPort sets the default listen port
+func WithPort(port int) Option {
+	return func(c *Config) {
+		c.Server.Port = port
+	}
+}
+
+// Load builds the configuration of the named binary. Later sources override earlier ones:
+// built-in defaults, the YAML file, environment variables and finally command-line flags.
+// The file is taken from -config, then CONFIG_FILE, then DefaultFile.
+func Load(name string, args []string, opts ...Option) (*Config, error) {
+	config := Default()
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to the YAML configuration file")
+	port := fs.Int("port", 0, "listen port, overrides server.port")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error")
+	logFormat := fs.String("log-format", "", "log format: json or text")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path, required := *configFile, true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, required = DefaultFile, false
+	}
+	if err := config.loadFile(path, required); err != nil {
+		return nil, err
+	}
+
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if *port != 0 {
+		config.Server.Port = *port
+	}
+	if *logLevel != "" {
+		config.Logging.Level = *logLevel
+	}
+	if *logFormat != "" {
+		config.Logging.Format = *logFormat
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// loadFile decodes the YAML file over the current values, rejecting unknown keys
+func (c *Config) loadFile(path string, required bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overlays environment variables, keeping the variable names the services used before
+// the file existed
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if value, ok := lookup(key); ok && value != "" {
+			*dst = value
+		}
+	}
+	num := func(key string, dst *int) {
+		if value, ok := lookup(key); ok && value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	int64Value := func(key string, dst *int64) {
+		if value, ok := lookup(key); ok && value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	unsigned := func(key string, dst *uint64) {
+		if value, ok := lookup(key); ok && value != "" {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		if value, ok := lookup(key); ok && value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	str("SERVER_HOST", &c.Server.Host)
+	num("PORT", &c.Server.Port)
+	duration("SERVER_TIMEOUT", &c.Server.Timeout)
+
+	pg := &c.Database.Postgres
+	str("DB_HOST", &pg.Host)
+	num("DB_PORT", &pg.Port)
+	str("DB_USER", &pg.User)
+	str("DB_PASSWORD", &pg.Password)
+	str("DB_NAME", &pg.DBName)
+	str("DB_SSLMODE", &pg.SSLMode)
+	num("DB_MAX_OPEN_CONNS", &pg.MaxOpenConns)
+	num("DB_MAX_IDLE_CONNS", &pg.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &pg.ConnMaxLifetime)
+
+	mongo := &c.Database.MongoDB
+	str("MONGODB_URI", &mongo.URI)
+	str("MONGODB_DATABASE", &mongo.Database)
+	duration("MONGODB_TIMEOUT", &mongo.Timeout)
+	unsigned("MONGODB_MAX_POOL_SIZE", &mongo.MaxPoolSize)
+	unsigned("MONGODB_MIN_POOL_SIZE", &mongo.MinPoolSize)
+	duration("MONGODB_MAX_CONN_IDLE_TIME", &mongo.MaxConnIdleTime)
+
+	str("KUBECONFIG", &c.Kubernetes.ConfigPath)
+	str("K8S_NAMESPACE", &c.Kubernetes.Namespace)
+	str("K8S_OPERATOR_NAME", &c.Kubernetes.OperatorName)
+
+	str("JWT_SECRET", &c.Auth.JWTSecret)
+	duration("TOKEN_EXPIRY", &c.Auth.TokenExpiry)
+	duration("API_KEY_EXPIRY", &c.Auth.APIKeyExpiry)
+
+	str("LOG_LEVEL", &c.Logging.Level)
+	str("LOG_FORMAT", &c.Logging.Format)
+
+	str("AWS_REGION", &c.CloudProviders.AWS.Region)
+	str("GCP_PROJECT_ID", &c.CloudProviders.GCP.ProjectID)
+	str("AZURE_SUBSCRIPTION_ID", &c.CloudProviders.Azure.SubscriptionID)
+
+	str("AUTH_SERVICE_URL", &c.Services.AuthURL)
+	str("API_SERVICE_URL", &c.Services.APIURL)
+	str("DEPLOYMENT_SERVICE_URL", &c.Services.DeploymentURL)
+	str("MONITORING_SERVICE_URL", &c.Services.MonitoringURL)
+	str("CONFIG_SERVICE_URL", &c.Services.ConfigURL)
+
+	gw := &c.Gateway
+	num("RATE_LIMIT", &gw.RateLimit)
+	duration("RATE_LIMIT_INTERVAL", &gw.RateLimitInterval)
+	num("CACHE_MAX_ENTRIES", &gw.CacheMaxEntries)
+	num("ADMIN_PORT", &gw.AdminPort)
+	str("ADMIN_TOKEN", &gw.AdminToken)
+	duration("HEALTH_CHECK_INTERVAL", &gw.HealthCheckInterval)
+	if value, ok := lookup("CLIENT_CERT_ACCOUNTS"); ok && value != "" {
+		gw.ClientCertAccounts = tlsutil.ParseSubjectMap(value)
+	}
+	num("COMPRESSION_MIN_SIZE", &gw.CompressionMinSize)
+	num("MAX_DECOMPRESSED_BYTES", &gw.MaxDecompressedBytes)
+	int64Value("MAX_BODY_BYTES", &gw.MaxBodyBytes)
+	num("MAX_HEADER_COUNT", &gw.MaxHeaderCount)
+	num("MAX_HEADER_BYTES", &gw.MaxHeaderBytes)
+	duration("READ_HEADER_TIMEOUT", &gw.ReadHeaderTimeout)
+	duration("IDLE_TIMEOUT", &gw.IdleTimeout)
+	num("MAX_IN_FLIGHT", &gw.MaxInFlight)
+	num("MAX_STREAMS", &gw.MaxStreams)
+	duration("MONITORING_CACHE_TTL", &gw.MonitoringCacheTTL)
+	duration("CONFIG_CACHE_TTL", &gw.ConfigCacheTTL)
+	int64Value("CONFIG_MAX_BODY_BYTES", &gw.ConfigMaxBodyBytes)
+	str("CONFIG_SERVICE_CANARY_URL", &gw.ConfigCanaryURL)
+	num("CONFIG_SERVICE_CANARY_WEIGHT", &gw.ConfigCanaryWeight)
+
+	num("AUDIT_BUFFER_SIZE", &c.Audit.BufferSize)
+	num("AUDIT_BATCH_SIZE", &c.Audit.BatchSize)
+	duration("AUDIT_FLUSH_INTERVAL", &c.Audit.FlushInterval)
+	num("AUDIT_MAX_BODY_BYTES", &c.Audit.MaxBodyBytes)
+	str("AUDIT_CHECKPOINT_KEY", &c.Audit.CheckpointKey)
+	duration("AUDIT_CHECKPOINT_INTERVAL", &c.Audit.CheckpointInterval)
+	duration("AUDIT_RETENTION", &c.Audit.Retention)
+	str("AUDIT_ARCHIVE_DIR", &c.Audit.ArchiveDir)
+	num("AUDIT_PARTITIONS_AHEAD", &c.Audit.PartitionsAhead)
+	duration("AUDIT_MAINTENANCE_INTERVAL", &c.Audit.MaintenanceInterval)
+
+	str("TLS_CERT_FILE", &c.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.TLS.KeyFile)
+	str("TLS_CLIENT_CA_FILE", &c.TLS.ClientCAFile)
+	str("TLS_CLIENT_AUTH", &c.TLS.ClientAuth)
+	str("TLS_MIN_VERSION", &c.TLS.MinVersion)
+	str("TLS_CIPHER_POLICY", &c.TLS.CipherPolicy)
+	duration("TLS_RELOAD_INTERVAL", &c.TLS.ReloadInterval)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate checks the values that would otherwise only fail once a connection is attempted
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port %d is out of range", c.Server.Port)
+	check(c.Server.Timeout > 0, "server.timeout must be positive")
+
+	pg := c.Database.Postgres
+	if pg.Enabled() {
+		check(pg.Port > 0 && pg.Port <= 65535, "database.postgres.port %d is out of range", pg.Port)
+		check(pg.DBName != "", "database.postgres.dbname is required")
+		switch pg.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			check(false, "database.postgres.sslmode %q is not supported", pg.SSLMode)
+		}
+	}
+	check(pg.MaxOpenConns >= 0, "database.postgres.max_open_conns must not be negative")
+	check(pg.MaxIdleConns >= 0, "database.postgres.max_idle_conns must not be negative")
+	check(pg.MaxOpenConns == 0 || pg.MaxIdleConns <= pg.MaxOpenConns, "database.postgres.max_idle_conns must not exceed max_open_conns")
+	check(pg.ConnMaxLifetime >= 0, "database.postgres.conn_max_lifetime must not be negative")
+
+	mongo := c.Database.MongoDB
+	if mongo.Enabled() {
+		check(mongo.Database != "", "database.mongodb.database is required")
+	}
+	check(mongo.Timeout >= 0, "database.mongodb.timeout must not be negative")
+	check(mongo.MaxPoolSize == 0 || mongo.MinPoolSize <= mongo.MaxPoolSize, "database.mongodb.min_pool_size must not exceed max_pool_size")
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "logging.level %q must be debug, info, warn or error", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "json", "text":
+	default:
+		check(false, "logging.format %q must be json or text", c.Logging.Format)
+	}
+
+	check(c.Auth.TokenExpiry >= 0, "auth.token_expiry must not be negative")
+	check(c.Auth.APIKeyExpiry >= 0, "auth.api_key_expiry must not be negative")
+
+	gw := c.Gateway
+	check(gw.RateLimit > 0, "gateway.rate_limit must be positive")
+	check(gw.RateLimitInterval > 0, "gateway.rate_limit_interval must be positive")
+	check(gw.CacheMaxEntries > 0, "gateway.cache_max_entries must be positive")
+	check(gw.AdminPort > 0 && gw.AdminPort <= 65535, "gateway.admin_port %d is out of range", gw.AdminPort)
+	check(gw.HealthCheckInterval > 0, "gateway.health_check_interval must be positive")
+	check(gw.CompressionMinSize >= 0, "gateway.compression_min_size must not be negative")
+	check(gw.MaxDecompressedBytes > 0, "gateway.max_decompressed_bytes must be positive")
+	check(gw.MaxBodyBytes > 0, "gateway.max_body_bytes must be positive")
+	check(gw.MaxHeaderCount > 0, "gateway.max_header_count must be positive")
+	check(gw.MaxHeaderBytes > 0, "gateway.max_header_bytes must be positive")
+	check(gw.ReadHeaderTimeout > 0, "gateway.read_header_timeout must be positive")
+	check(gw.IdleTimeout >= 0, "gateway.idle_timeout must not be negative")
+	check(gw.MaxInFlight >= 0, "gateway.max_in_flight must not be negative")
+	check(gw.MaxStreams >= 0, "gateway.max_streams must not be negative")
+	check(gw.MonitoringCacheTTL >= 0, "gateway.monitoring_cache_ttl must not be negative")
+	check(gw.ConfigCacheTTL >= 0, "gateway.config_cache_ttl must not be negative")
+	check(gw.ConfigMaxBodyBytes > 0, "gateway.config_max_body_bytes must be positive")
+	check(gw.ConfigCanaryWeight >= 0 && gw.ConfigCanaryWeight <= 100, "gateway.config_canary_weight %d must be between 0 and 100", gw.ConfigCanaryWeight)
+
+	check(c.Audit.BufferSize > 0, "audit.buffer_size must be positive")
+	check(c.Audit.BatchSize > 0, "audit.batch_size must be positive")
+	check(c.Audit.FlushInterval > 0, "audit.flush_interval must be positive")
+	check(c.Audit.MaxBodyBytes >= 0, "audit.max_body_bytes must not be negative")
+	check(c.Audit.CheckpointInterval > 0, "audit.checkpoint_interval must be positive")
+	check(c.Audit.Retention >= 0, "audit.retention must not be negative")
+	check(c.Audit.Retention == 0 || c.Audit.ArchiveDir != "", "audit.archive_dir is required when audit.retention is set")
+	check(c.Audit.PartitionsAhead >= 1, "audit.partitions_ahead must be at least 1")
+	check(c.Audit.MaintenanceInterval > 0, "audit.maintenance_interval must be positive")
+
+	check(c.TLS.Enabled() || (c.TLS.CertFile == "" && c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger builds a zap logger from the logging section. The json format uses the production
+// encoder, text uses the human-readable console encoder.
+func NewLogger(config LoggingConfig) (*zap.Logger, error) {
+	level, err := zapcore.ParseLevel(config.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	switch config.Format {
+	case "", "json":
+	case "text":
+		zapConfig.Encoding = "console"
+		zapConfig.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", config.Format)
+	}
+	return zapConfig.Build()
+}
@@ -0,0 +1,391 @@
+// Package configclient reads application configs from config-server through the API gateway,
+// resolved over their bases as the application sees them. It keeps the last good copy of every config it has read, in memory and optionally on disk, and
+// serves that copy when config-server cannot be reached. Watch follows changes and calls the
+// handlers registered with OnChange.
+package configclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// configsPath is where the gateway exposes config-server
+const configsPath = "/api/v1/configs"
+
+// ErrNotFound is returned when the config does not exist, or no longer does
+var ErrNotFound = errors.New("configclient: config not found")
+
+// Error is an error response from the gateway or config-server, decoded from its problem details
+type Error struct {
+	StatusCode int
+	Code       string
+	Title      string
+	Detail     string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("configclient: %d %s: %s", e.StatusCode, e.Title, e.Detail)
+	}
+	return fmt.Sprintf("configclient: %d %s", e.StatusCode, e.Title)
+}
+
+// Options configures a Client
+type Options struct {
+	BaseURL   string // Gateway URL, e.g. https://gateway.example.com
+	Token     string // Bearer token, may be empty when the transport presents a client certificate
+	Namespace string // Namespace of the configs, "default" when empty
+
+	// HTTPClient sends the requests, a client with a 10s timeout when nil. Watch uses the
+	// same transport without the overall timeout, since its stream stays open.
+	HTTPClient *http.Client
+
+	// CacheDir, if set, keeps the last good copy of each config on disk, so that a process starting
+	// while config-server is down still gets its configs
+	CacheDir string
+
+	RetryInterval time.Duration // Wait before Watch reconnects, 5s when zero
+	Logger        *zap.Logger   // Nop when nil
+}
+
+// Config is a config as read from config-server, its data merged over its bases
+type Config struct {
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace"`
+	Version   int             `json:"version"` // Version of the config itself, not of its bases
+	Data      json.RawMessage `json:"config_data"`
+	Layers    []Layer         `json:"layers,omitempty"` // Configs merged into Data, the config itself last
+	ETag      string          `json:"etag,omitempty"`
+	FetchedAt time.Time       `json:"fetched_at"`
+
+	// Stale is set on a cached copy returned because config-server could not be reached
+	Stale bool `json:"-"`
+	// Deleted is set on the value passed to OnChange handlers when the config was deleted
+	Deleted bool `json:"-"`
+}
+
+// Layer names a config merged into a resolved config, at the version that was merged
+type Layer struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+}
+
+// layerVersion returns the version of a config merged into cfg, false if it is not one of its layers
+func (cfg *Config) layerVersion(namespace, name string) (int, bool) {
+	for _, layer := range cfg.Layers {
+		if layer.Namespace == namespace && layer.Name == name {
+			return layer.Version, true
+		}
+	}
+	if cfg.Namespace == namespace && cfg.Name == name {
+		return cfg.Version, true // Cached before layers were recorded
+	}
+	return 0, false
+}
+
+// Decode unmarshals the config data into v
+func (cfg *Config) Decode(v interface{}) error {
+	if err := json.Unmarshal(cfg.Data, v); err != nil {
+		return fmt.Errorf("configclient: decoding %s: %w", cfg.Name, err)
+	}
+	return nil
+}
+
+// Client reads configs of one namespace
+type Client struct {
+	baseURL      string
+	token        string
+	namespace    string
+	httpClient   *http.Client
+	streamClient *http.Client
+	cacheDir     string
+	retry        time.Duration
+	logger       *zap.Logger
+
+	mu       sync.Mutex
+	cache    map[string]*Config
+	handlers map[string]map[int]func(Config)
+	nextID   int
+}
+
+// New creates a client. Nothing is requested until the first Get.
+func New(opts Options) (*Client, error) {
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("configclient: base URL %q is not absolute", opts.BaseURL)
+	}
+	c := &Client{
+		baseURL:    strings.TrimSuffix(opts.BaseURL, "/"),
+		token:      opts.Token,
+		namespace:  opts.Namespace,
+		httpClient: opts.HTTPClient,
+		cacheDir:   opts.CacheDir,
+		retry:      opts.RetryInterval,
+		logger:     opts.Logger,
+		cache:      map[string]*Config{},
+		handlers:   map[string]map[int]func(Config){},
+	}
+	if c.namespace == "" {
+		c.namespace = "default"
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	streamClient := *c.httpClient
+	streamClient.Timeout = 0
+	c.streamClient = &streamClient
+	if c.retry <= 0 {
+		c.retry = 5 * time.Second
+	}
+	if c.logger == nil {
+		c.logger = zap.NewNop()
+	}
+	if c.cacheDir != "" {
+		if err := os.MkdirAll(c.cacheDir, 0o700); err != nil {
+			return nil, fmt.Errorf("configclient: creating cache directory: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Namespace returns the namespace the client reads from
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// Get returns the current version of a config. When config-server cannot be reached, or answers
+// with a server error, the last good copy is returned with Stale set. ErrNotFound is returned when
+// the config does not exist, and the cached copy is dropped.
+func (c *Client) Get(ctx context.Context, name string) (*Config, error) {
+	cfg, err := c.fetch(ctx, name)
+	if err == nil {
+		return cfg, nil
+	}
+	var apiErr *Error
+	if errors.Is(err, ErrNotFound) || (errors.As(err, &apiErr) && !retryable(apiErr.StatusCode)) || ctx.Err() != nil {
+		return nil, err
+	}
+	if cached := c.cached(name); cached != nil {
+		c.logger.Warn("Serving cached config, config-server is unavailable",
+			zap.String("name", name), zap.String("namespace", c.namespace), zap.Int("version", cached.Version), zap.Error(err))
+		cached.Stale = true
+		return cached, nil
+	}
+	return nil, err
+}
+
+// Decode reads a config with Get and unmarshals its data into v
+func (c *Client) Decode(ctx context.Context, name string, v interface{}) error {
+	cfg, err := c.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return cfg.Decode(v)
+}
+
+// retryable reports whether a status means config-server is unavailable rather than the request wrong
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// fetch reads a config from config-server and caches it
+func (c *Client) fetch(ctx context.Context, name string) (*Config, error) {
+	return c.fetchFresh(ctx, name, func(*Config) bool { return true })
+}
+
+// fetchFresh reads a config that fresh accepts, e.g. one that includes a change that was just
+// announced. The gateway may answer from its response cache with an older copy, so a copy fresh
+// rejects is read again past the cache. One that is still rejected is neither cached nor returned.
+func (c *Client) fetchFresh(ctx context.Context, name string, fresh func(*Config) bool) (*Config, error) {
+	cfg, err := c.read(ctx, name, false)
+	if err == nil && !fresh(cfg) {
+		cfg, err = c.read(ctx, name, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !fresh(cfg) {
+		return nil, fmt.Errorf("configclient: read version %d of %s, which predates the announced change", cfg.Version, name)
+	}
+	c.store(cfg)
+	return cfg, nil
+}
+
+// read requests a resolved config, revalidating the cached copy with If-None-Match. With noCache
+// the gateway forwards the request to config-server instead of answering from its cache.
+func (c *Client) read(ctx context.Context, name string, noCache bool) (*Config, error) {
+	cached := c.cached(name)
+	req, err := c.newRequest(ctx, "/"+url.PathEscape(name)+"/resolved")
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if noCache {
+		req.Header.Set("Cache-Control", "no-cache")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("configclient: reading %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		cached.FetchedAt = time.Now()
+		return cached, nil
+	case resp.StatusCode == http.StatusNotFound:
+		c.forget(name)
+		return nil, fmt.Errorf("%w: %s in namespace %s", ErrNotFound, name, c.namespace)
+	case resp.StatusCode != http.StatusOK:
+		return nil, decodeError(resp)
+	}
+
+	cfg := &Config{}
+	if err := json.NewDecoder(resp.Body).Decode(cfg); err != nil {
+		return nil, fmt.Errorf("configclient: decoding response for %s: %w", name, err)
+	}
+	cfg.ETag = resp.Header.Get("ETag")
+	cfg.FetchedAt = time.Now()
+	return cfg, nil
+}
+
+// newRequest builds a GET to configsPath+path in the client's namespace
+func (c *Client) newRequest(ctx context.Context, path string) (*http.Request, error) {
+	query := url.Values{"namespace": {c.namespace}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+configsPath+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("configclient: creating request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// decodeError reads the problem details of an error response
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}
+	var body struct {
+		Title     string `json:"title"`
+		Detail    string `json:"detail"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err == nil {
+		if body.Title != "" {
+			apiErr.Title = body.Title
+		}
+		apiErr.Detail, apiErr.Code, apiErr.RequestID = body.Detail, body.Code, body.RequestID
+	}
+	return apiErr
+}
+
+// cached returns a copy of the last good version of a config, loading it from CacheDir if needed
+func (c *Client) cached(name string) *Config {
+	c.mu.Lock()
+	cfg, ok := c.cache[name]
+	c.mu.Unlock()
+	if ok {
+		clone := *cfg
+		return &clone
+	}
+	if c.cacheDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.cachePath(name))
+	if err != nil {
+		return nil
+	}
+	cfg = &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		c.logger.Warn("Ignoring unreadable cached config", zap.String("name", name), zap.Error(err))
+		return nil
+	}
+	c.mu.Lock()
+	if _, ok := c.cache[name]; !ok {
+		c.cache[name] = cfg
+	}
+	c.mu.Unlock()
+	clone := *cfg
+	return &clone
+}
+
+// store keeps cfg as the last good version, on disk too when CacheDir is set
+func (c *Client) store(cfg *Config) {
+	clone := *cfg
+	clone.Stale, clone.Deleted = false, false
+	c.mu.Lock()
+	c.cache[cfg.Name] = &clone
+	c.mu.Unlock()
+	if c.cacheDir == "" {
+		return
+	}
+	if err := c.writeCacheFile(&clone); err != nil {
+		c.logger.Warn("Failed to write config cache", zap.String("name", cfg.Name), zap.Error(err))
+	}
+}
+
+// forget drops the cached copy of a config that no longer exists
+func (c *Client) forget(name string) {
+	c.mu.Lock()
+	delete(c.cache, name)
+	c.mu.Unlock()
+	if c.cacheDir != "" {
+		os.Remove(c.cachePath(name))
+	}
+}
+
+// cachedNames lists the configs read so far
+func (c *Client) cachedNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.cache))
+	for name := range c.cache {
+		names = append(names, name)
+	}
+	return names
+}
+
+// cachePath names the cache file of a config, escaped so that any config name is a single file name
+func (c *Client) cachePath(name string) string {
+	return filepath.Join(c.cacheDir, url.PathEscape(c.namespace)+"."+url.PathEscape(name)+".json")
+}
+
+// writeCacheFile replaces the cache file through a rename, so a crash never leaves half a file
+func (c *Client) writeCacheFile(cfg *Config) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.cacheDir, ".config-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.cachePath(cfg.Name))
+}
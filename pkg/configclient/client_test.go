@@ -0,0 +1,520 @@
+package configclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGateway stands in for the gateway in front of config-server
+type fakeGateway struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	configs map[string]Config
+	bases   map[string][]string
+	cached  map[string]Config // Older copies served unless the request asks for no-cache
+	down    bool
+	events  chan string // Raw SSE events written to the open watch stream
+	resumes []string    // Last-Event-ID of each watch request
+}
+
+func newFakeGateway(t *testing.T) (*fakeGateway, *httptest.Server) {
+	g := &fakeGateway{t: t, configs: map[string]Config{}, bases: map[string][]string{}, cached: map[string]Config{}, events: make(chan string, 16)}
+	server := httptest.NewServer(g)
+	t.Cleanup(server.Close)
+	return g, server
+}
+
+func (g *fakeGateway) put(name string, version int, data string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.configs[name] = Config{Name: name, Namespace: "dev", Version: version, Data: json.RawMessage(data)}
+}
+
+// putOverlay stores a config whose data is merged over the top-level keys of its bases
+func (g *fakeGateway) putOverlay(name string, version int, data string, bases ...string) {
+	g.put(name, version, data)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.bases[name] = bases
+}
+
+// resolve merges cfg over its bases the way config-server does, one level deep. Callers hold g.mu.
+func (g *fakeGateway) resolve(cfg Config) (Config, bool) {
+	merged := map[string]json.RawMessage{}
+	var layers []Layer
+	for _, name := range g.bases[cfg.Name] {
+		base, ok := g.configs[name]
+		if !ok {
+			return Config{}, false
+		}
+		json.Unmarshal(base.Data, &merged)
+		layers = append(layers, Layer{Namespace: "dev", Name: name, Version: base.Version})
+	}
+	json.Unmarshal(cfg.Data, &merged)
+	cfg.Data, _ = json.Marshal(merged)
+	cfg.Layers = append(layers, Layer{Namespace: "dev", Name: cfg.Name, Version: cfg.Version})
+	return cfg, true
+}
+
+// cache makes the gateway answer with the current copy of name until a request asks for no-cache
+func (g *fakeGateway) cache(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cached[name] = g.configs[name]
+}
+
+func (g *fakeGateway) setDown(down bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.down = down
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"title":"Unauthorized","status":401,"code":"UNAUTHORIZED","detail":"Missing bearer token"}`)
+		return
+	}
+	if r.URL.Query().Get("namespace") != "dev" {
+		g.t.Errorf("namespace = %q, want dev", r.URL.Query().Get("namespace"))
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/configs/")
+	if name == "watch" {
+		g.watch(w, r)
+		return
+	}
+	name, resolved := strings.CutSuffix(name, "/resolved")
+	if !resolved {
+		g.t.Errorf("read %s, want the resolved config", r.URL.Path)
+	}
+
+	g.mu.Lock()
+	down := g.down
+	cfg, ok := g.configs[name]
+	if stale, cached := g.cached[name]; cached && r.Header.Get("Cache-Control") != "no-cache" {
+		cfg, ok = stale, true
+	}
+	resolvable := true
+	if ok {
+		cfg, resolvable = g.resolve(cfg)
+	}
+	g.mu.Unlock()
+
+	switch {
+	case down:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"title":"Service Unavailable","status":503,"detail":"Configuration Service is unavailable"}`)
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"title":"Not Found","status":404}`)
+	case !resolvable:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"title":"Unprocessable Entity","status":422,"detail":"Base does not exist"}`)
+	default:
+		etag := fmt.Sprintf(`"%v"`, cfg.Layers)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":        cfg.Name,
+			"namespace":   cfg.Namespace,
+			"version":     cfg.Version,
+			"config_data": cfg.Data,
+			"layers":      cfg.Layers,
+		})
+	}
+}
+
+func (g *fakeGateway) watch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Accept") != "text/event-stream" {
+		g.t.Errorf("watch Accept = %q", r.Header.Get("Accept"))
+	}
+	g.mu.Lock()
+	g.resumes = append(g.resumes, r.Header.Get("Last-Event-ID"))
+	events := g.events
+	g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return // Drop the connection
+			}
+			fmt.Fprint(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+type appConfig struct {
+	Retries int    `json:"retries"`
+	URL     string `json:"url"`
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, cacheDir string) *Client {
+	client, err := New(Options{
+		BaseURL:       server.URL,
+		Token:         "secret",
+		Namespace:     "dev",
+		CacheDir:      cacheDir,
+		RetryInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestDecodeAndLastKnownGood(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 3, `{"retries": 5, "url": "http://example.com"}`)
+	client := newTestClient(t, server, "")
+	ctx := context.Background()
+
+	var cfg appConfig
+	if err := client.Decode(ctx, "app", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Retries != 5 || cfg.URL != "http://example.com" {
+		t.Fatalf("decoded %+v", cfg)
+	}
+
+	// A second read revalidates the cached copy with If-None-Match
+	got, err := client.Get(ctx, "app")
+	if err != nil || got.Version != 3 || got.Stale {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+
+	gateway.setDown(true)
+	got, err = client.Get(ctx, "app")
+	if err != nil {
+		t.Fatalf("Get while down: %v", err)
+	}
+	if !got.Stale || got.Version != 3 {
+		t.Fatalf("Get while down = %+v, want the stale cached version 3", got)
+	}
+
+	// Nothing cached, nothing to fall back on
+	var apiErr *Error
+	if _, err := client.Get(ctx, "other"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Get of uncached config while down = %v, want a 503 error", err)
+	}
+}
+
+func TestNotFoundAndClientErrorsAreNotMasked(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 1, `{}`)
+	client := newTestClient(t, server, "")
+	ctx := context.Background()
+
+	if _, err := client.Get(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	gateway.mu.Lock()
+	delete(gateway.configs, "app")
+	gateway.mu.Unlock()
+	if _, err := client.Get(ctx, "app"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of deleted config = %v, want ErrNotFound", err)
+	}
+
+	unauthorized, err := New(Options{BaseURL: server.URL, Namespace: "dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *Error
+	if _, err := unauthorized.Get(ctx, "app"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "UNAUTHORIZED" {
+		t.Fatalf("Get without token = %v, want a 401 problem", err)
+	}
+}
+
+func TestCacheDirSurvivesRestart(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 2, `{"retries": 2}`)
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	if _, err := newTestClient(t, server, dir).Get(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new process starting while config-server is down
+	gateway.setDown(true)
+	var cfg appConfig
+	restarted := newTestClient(t, server, dir)
+	if err := restarted.Decode(ctx, "app", &cfg); err != nil {
+		t.Fatalf("Decode from disk cache: %v", err)
+	}
+	if cfg.Retries != 2 {
+		t.Fatalf("decoded %+v from disk cache", cfg)
+	}
+}
+
+func TestWatchCallsHandlersAndResumes(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 1, `{"retries": 1}`)
+	client := newTestClient(t, server, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := client.Get(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan Config, 4)
+	client.OnChange("app", func(cfg Config) { updates <- cfg })
+
+	done := make(chan error, 1)
+	go func() { done <- client.Watch(ctx) }()
+
+	receive := func() Config {
+		t.Helper()
+		select {
+		case cfg := <-updates:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update received")
+			return Config{}
+		}
+	}
+
+	gateway.put("app", 2, `{"retries": 2}`)
+	gateway.events <- ": keepalive\n\n"
+	gateway.events <- "id: 7\nevent: updated\ndata: {\"id\":7,\"type\":\"updated\",\"namespace\":\"dev\",\"name\":\"other\",\"version\":4}\n\n"
+	gateway.events <- "id: 8\nevent: updated\ndata: {\"id\":8,\"type\":\"updated\",\"namespace\":\"dev\",\"name\":\"app\",\"version\":2}\n\n"
+	var cfg appConfig
+	if got := receive(); got.Version != 2 || got.Decode(&cfg) != nil || cfg.Retries != 2 {
+		t.Fatalf("update = %+v", got)
+	}
+
+	// Drop the stream, the client reconnects after the last event it handled
+	close(gateway.events)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		gateway.mu.Lock()
+		resumes := append([]string(nil), gateway.resumes...)
+		if len(resumes) >= 2 {
+			gateway.events = make(chan string, 16)
+		}
+		gateway.mu.Unlock()
+		if len(resumes) >= 2 {
+			if resumes[0] != "" || resumes[1] != "8" {
+				t.Fatalf("watch requests resumed from %q, want [\"\" \"8\"]", resumes)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("watch did not reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Watch returned %v", err)
+	}
+}
+
+func TestWatchReadsChangesPastTheGatewayCache(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 1, `{"retries": 1}`)
+	client := newTestClient(t, server, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := client.Get(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	gateway.cache("app")
+	updates := make(chan Config, 4)
+	client.OnChange("app", func(cfg Config) { updates <- cfg })
+	go client.Watch(ctx)
+
+	gateway.put("app", 2, `{"retries": 2}`)
+	gateway.events <- "id: 5\nevent: updated\ndata: {\"name\":\"app\",\"version\":2}\n\n"
+	select {
+	case cfg := <-updates:
+		if cfg.Version != 2 {
+			t.Fatalf("update = %+v, want version 2", cfg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update received")
+	}
+	if cached := client.cached("app"); cached == nil || cached.Version != 2 {
+		t.Fatalf("cached = %+v, want version 2", cached)
+	}
+}
+
+func TestWatchRetriesChangesNotYetReadable(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 1, `{"retries": 1}`)
+	client := newTestClient(t, server, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := client.Get(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan Config, 4)
+	client.OnChange("app", func(cfg Config) { updates <- cfg })
+	go client.Watch(ctx)
+
+	// The change is announced before config-server serves it, the stale copy must not be used
+	gateway.events <- "id: 5\nevent: updated\ndata: {\"name\":\"app\",\"version\":2}\n\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		gateway.mu.Lock()
+		resumes := append([]string(nil), gateway.resumes...)
+		gateway.mu.Unlock()
+		if len(resumes) >= 2 {
+			if resumes[1] != "" {
+				t.Fatalf("watch resumed from %q after an unhandled event, want it delivered again", resumes[1])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("watch did not reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case cfg := <-updates:
+		t.Fatalf("handler called with stale %+v", cfg)
+	default:
+	}
+	if cached := client.cached("app"); cached == nil || cached.Version != 1 {
+		t.Fatalf("cached = %+v, want version 1", cached)
+	}
+}
+
+func TestWatchReportsDeletes(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("app", 1, `{}`)
+	client := newTestClient(t, server, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan Config, 4)
+	client.OnChange("app", func(cfg Config) { updates <- cfg })
+	go client.Watch(ctx)
+
+	// The first connection reads the watched config, which counts as a change
+	select {
+	case cfg := <-updates:
+		if cfg.Version != 1 || cfg.Deleted {
+			t.Fatalf("initial update = %+v", cfg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no initial update")
+	}
+
+	gateway.events <- "id: 3\nevent: deleted\ndata: {\"name\":\"app\",\"version\":1}\n\n"
+	select {
+	case cfg := <-updates:
+		if !cfg.Deleted {
+			t.Fatalf("delete update = %+v", cfg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delete update")
+	}
+	if client.cached("app") != nil {
+		t.Fatal("deleted config is still cached")
+	}
+}
+
+func TestWatchReadsConfigsBuiltOnAChangedBase(t *testing.T) {
+	gateway, server := newFakeGateway(t)
+	gateway.put("base", 1, `{"retries": 1, "url": "http://base"}`)
+	gateway.putOverlay("app", 1, `{"url": "http://app"}`, "base")
+	gateway.put("other", 1, `{}`)
+	client := newTestClient(t, server, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cfg appConfig
+	if err := client.Decode(ctx, "app", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Retries != 1 || cfg.URL != "http://app" {
+		t.Fatalf("decoded %+v, want the overlay merged over its base", cfg)
+	}
+	updates := make(chan Config, 4)
+	client.OnChange("app", func(cfg Config) { updates <- cfg })
+	others := make(chan Config, 4)
+	client.OnChange("other", func(cfg Config) { others <- cfg })
+	done := make(chan error, 1)
+	go func() { done <- client.Watch(ctx) }()
+
+	receive := func(ch chan Config) Config {
+		t.Helper()
+		select {
+		case cfg := <-ch:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update received")
+			return Config{}
+		}
+	}
+	receive(others) // Read when the stream opens
+
+	// Only the base changes, the overlay keeps its version but resolves differently
+	gateway.put("base", 2, `{"retries": 2, "url": "http://base"}`)
+	gateway.events <- "id: 4\nevent: updated\ndata: {\"namespace\":\"dev\",\"name\":\"base\",\"version\":2}\n\n"
+	if got := receive(updates); got.Version != 1 || got.Decode(&cfg) != nil || cfg.Retries != 2 || cfg.URL != "http://app" {
+		t.Fatalf("update = %+v, decoded %+v", got, cfg)
+	}
+
+	// Without its base the overlay no longer resolves, the last good copy is kept and Watch goes on
+	gateway.mu.Lock()
+	delete(gateway.configs, "base")
+	gateway.mu.Unlock()
+	gateway.events <- "id: 5\nevent: deleted\ndata: {\"namespace\":\"dev\",\"name\":\"base\",\"version\":2}\n\n"
+	gateway.put("other", 2, `{}`)
+	gateway.events <- "id: 6\nevent: updated\ndata: {\"namespace\":\"dev\",\"name\":\"other\",\"version\":2}\n\n"
+	if got := receive(others); got.Version != 2 {
+		t.Fatalf("update = %+v, want version 2 of other", got)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Watch returned %v after a base was deleted", err)
+	case got := <-updates:
+		t.Fatalf("handler called with %+v after the base was deleted", got)
+	default:
+	}
+	gateway.mu.Lock()
+	resumes := len(gateway.resumes)
+	gateway.mu.Unlock()
+	if resumes != 1 {
+		t.Fatalf("watch connected %d times, want the first stream kept", resumes)
+	}
+	if cached := client.cached("app"); cached == nil || cached.Decode(&cfg) != nil || cfg.Retries != 2 {
+		t.Fatalf("cached = %+v, want the last good copy", cached)
+	}
+}
+
+func TestWatchStopsWhenRejected(t *testing.T) {
+	_, server := newFakeGateway(t)
+	client, err := New(Options{BaseURL: server.URL, Namespace: "dev", RetryInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *Error
+	if err := client.Watch(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Watch without token = %v, want a 401 error", err)
+	}
+}
@@ -0,0 +1,336 @@
+package configclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// streamIdleTimeout drops a watch stream that has gone quiet. The server sends a keepalive every
+// 15 seconds, so silence for longer means the connection is dead.
+const streamIdleTimeout = 45 * time.Second
+
+// OnChange registers fn to be called by Watch with the new version of a config after each change
+// to it or to one of its bases, and with Deleted set when the config is deleted. Handlers run one at a time on the goroutine
+// running Watch. The returned function removes the handler.
+func (c *Client) OnChange(name string, fn func(Config)) (remove func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+	if c.handlers[name] == nil {
+		c.handlers[name] = map[int]func(Config){}
+	}
+	c.handlers[name][id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.handlers[name], id)
+		if len(c.handlers[name]) == 0 {
+			delete(c.handlers, name)
+		}
+	}
+}
+
+// Watch follows changes to the namespace until ctx is cancelled, and should run on its own
+// goroutine. Each changed config that has handlers, or was read before, is fetched again, cached
+// and passed to its handlers, and so is every config read before that has the changed config among
+// its bases. Only changes in the client's namespace are followed: a config whose bases live in
+// another namespace picks up their changes when it is next read or the watch reconnects. After a dropped connection Watch reconnects and resumes after the
+// last change it handled, so no change is missed. It returns when ctx is done, or when the gateway
+// rejects the watch, e.g. because the token is no longer valid.
+func (c *Client) Watch(ctx context.Context) error {
+	var lastID string
+	for {
+		err := c.watchOnce(ctx, &lastID)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var apiErr *Error
+		if errors.As(err, &apiErr) && !retryable(apiErr.StatusCode) {
+			return err
+		}
+		c.logger.Warn("Config watch interrupted, reconnecting",
+			zap.String("namespace", c.namespace), zap.Duration("retry_in", c.retry), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.retry):
+		}
+	}
+}
+
+// watchEvent is the data of a change event
+type watchEvent struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Version   int    `json:"version"`
+}
+
+// watchOnce follows one stream until it fails. lastID is advanced only once an event has been
+// handled, so an event whose config could not be read is delivered again after reconnecting.
+func (c *Client) watchOnce(ctx context.Context, lastID *string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, "/watch")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("configclient: opening watch: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	// A new stream starts from now, anything read before it may have changed in the meantime
+	if *lastID == "" {
+		if err := c.resync(ctx); err != nil {
+			return err
+		}
+	}
+
+	idle := time.AfterFunc(streamIdleTimeout, cancel)
+	defer idle.Stop()
+	events := bufio.NewReader(&idleReader{Reader: resp.Body, timer: idle})
+	for {
+		event, err := readEvent(events)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("configclient: watch stream closed")
+			}
+			return fmt.Errorf("configclient: reading watch stream: %w", err)
+		}
+		if err := c.handleEvent(ctx, event); err != nil {
+			return err
+		}
+		if event.id != "" {
+			*lastID = event.id
+		}
+	}
+}
+
+// handleEvent brings the cache up to date with one change and notifies handlers
+func (c *Client) handleEvent(ctx context.Context, event sseEvent) error {
+	if event.event == "reset" {
+		// The position could not be resumed, the changes in between are unknown
+		return c.resync(ctx)
+	}
+	var change watchEvent
+	if err := json.Unmarshal([]byte(event.data), &change); err != nil || change.Name == "" {
+		c.logger.Warn("Ignoring malformed config event", zap.String("id", event.id), zap.String("event", event.event))
+		return nil
+	}
+	if change.Namespace == "" {
+		change.Namespace = c.namespace
+	}
+	changed := Layer{Namespace: change.Namespace, Name: change.Name, Version: change.Version}
+	deleted := event.event == "deleted"
+
+	if change.Namespace == c.namespace && c.interested(change.Name) {
+		if deleted {
+			c.forget(change.Name)
+			c.notify(Config{Name: change.Name, Namespace: c.namespace, Version: change.Version, Deleted: true})
+		} else if err := c.refresh(ctx, change.Name, changed, false); err != nil {
+			return err
+		}
+	}
+	// Configs built on the changed one resolve differently now
+	for _, name := range c.dependents(changed) {
+		if err := c.refresh(ctx, name, changed, deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refresh reads a config again once it includes a change to changed, one of its layers, and
+// notifies its handlers. A config that no longer resolves, e.g. because a base was deleted, keeps
+// its last good copy.
+func (c *Client) refresh(ctx context.Context, name string, changed Layer, deleted bool) error {
+	fresh := func(cfg *Config) bool {
+		version, ok := cfg.layerVersion(changed.Namespace, changed.Name)
+		if deleted {
+			return !ok
+		}
+		return !ok || version >= changed.Version
+	}
+	if cached := c.cached(name); cached != nil && fresh(cached) {
+		return nil // Already read
+	}
+	// An error leaves the event unhandled, so it is delivered again after reconnecting
+	cfg, err := c.fetchFresh(ctx, name, fresh)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil // Deleted since, its own event follows
+	case unresolvable(err):
+		c.logger.Warn("Keeping the last good copy of a config that no longer resolves",
+			zap.String("name", name), zap.String("namespace", c.namespace), zap.Error(err))
+		return nil
+	case err != nil:
+		return err
+	}
+	c.notify(*cfg)
+	return nil
+}
+
+// unresolvable reports whether config-server rejected a config it cannot merge over its bases
+func unresolvable(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity
+}
+
+// dependents lists the configs read so far that have changed among their bases
+func (c *Client) dependents(changed Layer) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for name, cfg := range c.cache {
+		if cfg.Namespace == changed.Namespace && name == changed.Name {
+			continue
+		}
+		for _, layer := range cfg.Layers {
+			if layer.Namespace == changed.Namespace && layer.Name == changed.Name {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resync reads every config of interest again and notifies handlers of those that changed
+func (c *Client) resync(ctx context.Context) error {
+	for _, name := range c.watchedNames() {
+		before := c.cached(name)
+		cfg, err := c.fetch(ctx, name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			if before != nil {
+				c.notify(Config{Name: name, Namespace: c.namespace, Version: before.Version, Deleted: true})
+			}
+		case unresolvable(err):
+			c.logger.Warn("Keeping the last good copy of a config that no longer resolves",
+				zap.String("name", name), zap.String("namespace", c.namespace), zap.Error(err))
+		case err != nil:
+			return err
+		case before == nil || before.Version != cfg.Version || before.ETag != cfg.ETag:
+			c.notify(*cfg)
+		}
+	}
+	return nil
+}
+
+// interested reports whether a config has handlers or has been read
+func (c *Client) interested(name string) bool {
+	c.mu.Lock()
+	_, cached := c.cache[name]
+	_, handled := c.handlers[name]
+	c.mu.Unlock()
+	return cached || handled || c.cached(name) != nil
+}
+
+// watchedNames lists the configs that have been read or have handlers
+func (c *Client) watchedNames() []string {
+	names := c.cachedNames()
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.handlers {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// notify calls the handlers of cfg outside the lock, so a handler may call back into the client
+func (c *Client) notify(cfg Config) {
+	c.mu.Lock()
+	handlers := make([]func(Config), 0, len(c.handlers[cfg.Name]))
+	for _, fn := range c.handlers[cfg.Name] {
+		handlers = append(handlers, fn)
+	}
+	c.mu.Unlock()
+	for _, fn := range handlers {
+		fn(cfg)
+	}
+}
+
+// sseEvent is one Server-Sent Event
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event of a text/event-stream, skipping comments
+func readEvent(r *bufio.Reader) (sseEvent, error) {
+	var event sseEvent
+	var data []string
+	seen := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return event, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if !seen {
+				continue // Blank line after a comment
+			}
+			event.data = strings.Join(data, "\n")
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			data = append(data, value)
+		default:
+			continue
+		}
+		seen = true
+	}
+}
+
+// idleReader pushes back its timer on every read
+type idleReader struct {
+	io.Reader
+	timer *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(streamIdleTimeout)
+	}
+	return n, err
+}
@@ -20,15 +20,35 @@ type Client struct {
 type Config struct {
 	URI      string
 	Database string
+
+	// Connection pool settings, zero values use the defaults below
+	Timeout         time.Duration // Bounds the initial connection check
+	MaxPoolSize     uint64
+	MinPoolSize     uint64
+	MaxConnIdleTime time.Duration
 }
 
 // NewClient initializes a MongoDB client with connection pooling and monitoring
 func NewClient(ctx context.Context, config Config) (*Client, error) {
+	maxPoolSize, minPoolSize, maxConnIdleTime, timeout := uint64(100), uint64(10), 30*time.Second, 5*time.Second
+	if config.MaxPoolSize > 0 {
+		maxPoolSize = config.MaxPoolSize
+	}
+	if config.MinPoolSize > 0 {
+		minPoolSize = config.MinPoolSize
+	}
+	if config.MaxConnIdleTime > 0 {
+		maxConnIdleTime = config.MaxConnIdleTime
+	}
+	if config.Timeout > 0 {
+		timeout = config.Timeout
+	}
+
 	opts := options.Client().
 		ApplyURI(config.URI).
-		SetMaxPoolSize(100).
-		SetMinPoolSize(10).
-		SetMaxConnIdleTime(30 * time.Second).
+		SetMaxPoolSize(maxPoolSize).
+		SetMinPoolSize(minPoolSize).
+		SetMaxConnIdleTime(maxConnIdleTime).
 		SetServerMonitor(&event.ServerMonitor{
 			ServerHeartbeatSucceeded: func(event *event.ServerHeartbeatSucceededEvent) {
 				// Add monitoring logic here
@@ -54,7 +74,7 @@ func NewClient(ctx context.Context, config Config) (*Client, error) {
 	}
 
 	// Add timeout for connection check
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	if err := client.Ping(ctx, readpref.Primary()); err != nil {
 		return nil, fmt.Errorf("error pinging MongoDB: %w", err)
@@ -70,3 +90,8 @@ func NewClient(ctx context.Context, config Config) (*Client, error) {
 func (c *Client) Close(ctx context.Context) error {
 	return c.client.Disconnect(ctx)
 }
+
+// Ping verifies the connection to the primary (for health checks)
+func (c *Client) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,404 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AuditEvent is one row of audit_logs
+type AuditEvent struct {
+	UserID       int // Zero is stored as NULL
+	Action       string
+	ResourceType string
+	ResourceName string
+	Namespace    string
+	RequestData  string // JSON document, empty is stored as NULL
+	Status       string
+	Message      string
+	ClientIP     string
+	CreatedAt    time.Time // Zero uses the database clock
+}
+
+// auditColumns is the column list shared by the audit inserts
+const auditColumns = "user_id, action, resource_type, resource_name, namespace, request_data, status, message, client_ip, created_at"
+
+// auditChainLockID is the advisory lock that serializes appends to the audit hash chain across replicas
+const auditChainLockID = 0x617564697463 // "auditc"
+
+// InsertAuditEvents appends a batch of audit events to the hash chain in one transaction
+func (c *Client) InsertAuditEvents(ctx context.Context, events []AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting audit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := appendAuditEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing %d audit events: %w", len(events), err)
+	}
+	return nil
+}
+
+// appendAuditEvents appends events to the hash chain within tx, so they are stored only if the
+// change they describe is. Rows are inserted first and hashed from the values Postgres returns, so
+// the hash covers exactly what a later read sees (jsonb normalizes request_data, timestamps are
+// stored in microseconds). The chain stays locked until tx ends.
+func appendAuditEvents(ctx context.Context, tx *sql.Tx, events []AuditEvent) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLockID); err != nil {
+		return fmt.Errorf("error locking audit chain: %w", err)
+	}
+	var prevHash sql.NullString
+	err := tx.QueryRowContext(ctx, "SELECT entry_hash FROM audit_logs WHERE entry_hash IS NOT NULL ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading audit chain head: %w", err)
+	}
+
+	inserted, err := insertAuditRows(ctx, tx, events)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, len(inserted))
+	prevHashes := make([]string, len(inserted))
+	entryHashes := make([]string, len(inserted))
+	prev := prevHash.String
+	for i := range inserted {
+		inserted[i].PrevHash = prev
+		inserted[i].EntryHash = AuditEntryHash(inserted[i])
+		ids[i], prevHashes[i], entryHashes[i] = inserted[i].ID, inserted[i].PrevHash, inserted[i].EntryHash
+		prev = inserted[i].EntryHash
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE audit_logs a SET prev_hash = NULLIF(v.prev_hash, ''), entry_hash = v.entry_hash
+		FROM unnest($1::bigint[], $2::text[], $3::text[]) AS v(id, prev_hash, entry_hash)
+		WHERE a.id = v.id`,
+		pq.Array(ids), pq.Array(prevHashes), pq.Array(entryHashes),
+	)
+	if err != nil {
+		return fmt.Errorf("error chaining %d audit events: %w", len(events), err)
+	}
+	return nil
+}
+
+// insertAuditRows inserts the events in a single statement and returns the stored rows in id order
+func insertAuditRows(ctx context.Context, tx *sql.Tx, events []AuditEvent) ([]AuditLog, error) {
+	const columns = 10
+	var query strings.Builder
+	query.WriteString("INSERT INTO audit_logs (" + auditColumns + ") VALUES ")
+	args := make([]interface{}, 0, len(events)*columns)
+	for i, e := range events {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		base := i * columns
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, COALESCE($%d, CURRENT_TIMESTAMP))",
+			base+1, base+2, base+3, base+4, base+5, base+6, base+7, base+8, base+9, base+10)
+
+		var createdAt *time.Time
+		if !e.CreatedAt.IsZero() {
+			createdAt = &e.CreatedAt
+		}
+		args = append(args,
+			nullableUserID(e.UserID), e.Action, e.ResourceType, e.ResourceName, e.Namespace,
+			nullableString(e.RequestData), e.Status, e.Message, e.ClientIP, createdAt,
+		)
+	}
+	query.WriteString(" RETURNING id, " + auditColumns)
+
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting %d audit events: %w", len(events), err)
+	}
+	defer rows.Close()
+
+	inserted := make([]AuditLog, 0, len(events))
+	for rows.Next() {
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error inserting %d audit events: %w", len(events), err)
+	}
+	// RETURNING order is not guaranteed, the chain follows id order
+	sort.Slice(inserted, func(i, j int) bool { return inserted[i].ID < inserted[j].ID })
+	return inserted, nil
+}
+
+// AuditEntryHash returns the hex SHA-256 of an entry's stored values and the previous entry's
+// hash. Every field is length-prefixed so no two distinct entries serialize the same way.
+func AuditEntryHash(log AuditLog) string {
+	h := sha256.New()
+	for _, field := range []string{
+		strconv.FormatInt(log.ID, 10),
+		strconv.FormatInt(log.CreatedAt.UnixMicro(), 10),
+		strconv.Itoa(log.UserID),
+		log.Action,
+		log.ResourceType,
+		log.ResourceName,
+		log.Namespace,
+		log.RequestData,
+		log.Status,
+		log.Message,
+		log.ClientIP,
+		log.PrevHash,
+	} {
+		fmt.Fprintf(h, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// scanAuditLog reads a row selected as "id, " + auditColumns
+func scanAuditLog(rows *sql.Rows, extra ...interface{}) (AuditLog, error) {
+	var log AuditLog
+	var userID sql.NullInt64
+	var requestData, message, clientIP sql.NullString
+	dest := []interface{}{
+		&log.ID, &userID, &log.Action, &log.ResourceType, &log.ResourceName, &log.Namespace,
+		&requestData, &log.Status, &message, &clientIP, &log.CreatedAt,
+	}
+	if err := rows.Scan(append(dest, extra...)...); err != nil {
+		return log, fmt.Errorf("error scanning audit log: %w", err)
+	}
+	log.UserID = int(userID.Int64)
+	log.RequestData = requestData.String
+	log.Message = message.String
+	log.ClientIP = clientIP.String
+	return log, nil
+}
+
+// AuditLog is a stored audit event
+type AuditLog struct {
+	ID           int64
+	UserID       int // Zero when the event has no user
+	Action       string
+	ResourceType string
+	ResourceName string
+	Namespace    string
+	RequestData  string // JSON document, empty when none was stored
+	Status       string
+	Message      string
+	ClientIP     string
+	CreatedAt    time.Time
+	PrevHash     string // Empty for the first chained entry and for entries written before chaining
+	EntryHash    string // Empty for entries written before chaining
+}
+
+// AuditCursor is the position of the last row of a page, newer rows come first
+type AuditCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// AuditFilter selects audit logs, zero fields match everything
+type AuditFilter struct {
+	UserID       int
+	Action       string
+	ResourceType string
+	Namespace    string
+	Status       string
+	Since        time.Time // Inclusive
+	Until        time.Time // Exclusive
+	After        *AuditCursor
+	Limit        int // Zero returns every matching row
+}
+
+// where builds the WHERE clause and arguments for the filter. Every condition is a plain equality
+// or a range on created_at, so the planner can use idx_audit_logs_user_id, _resource_type or
+// _created_at depending on selectivity.
+func (f AuditFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.UserID != 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.ResourceType != "" {
+		add("resource_type = $%d", f.ResourceType)
+	}
+	if f.Namespace != "" {
+		add("namespace = $%d", f.Namespace)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if !f.Since.IsZero() {
+		add("created_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("created_at < $%d", f.Until)
+	}
+	if f.After != nil {
+		// Equivalent to (created_at, id) < (cursor), written so the created_at bound is an index range
+		args = append(args, f.After.CreatedAt, f.After.ID)
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d AND (created_at < $%d OR id < $%d)", len(args)-1, len(args)-1, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListAuditLogs returns the matching audit logs, newest first
+func (c *Client) ListAuditLogs(ctx context.Context, filter AuditFilter) ([]AuditLog, error) {
+	var logs []AuditLog
+	err := c.StreamAuditLogs(ctx, filter, func(log AuditLog) error {
+		logs = append(logs, log)
+		return nil
+	})
+	return logs, err
+}
+
+// StreamAuditLogs calls fn for each matching audit log, newest first, without holding the result
+// set in memory. Iteration stops at the first error returned by fn.
+func (c *Client) StreamAuditLogs(ctx context.Context, filter AuditFilter, fn func(AuditLog) error) error {
+	where, args := filter.where()
+	query := "SELECT id, " + auditColumns + ", prev_hash, entry_hash FROM audit_logs" + where + " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prevHash, entryHash sql.NullString
+		log, err := scanAuditLog(rows, &prevHash, &entryHash)
+		if err != nil {
+			return err
+		}
+		log.PrevHash, log.EntryHash = prevHash.String, entryHash.String
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StreamAuditChain calls fn for every audit log in chain order, oldest first
+func (c *Client) StreamAuditChain(ctx context.Context, fn func(AuditLog) error) error {
+	rows, err := c.db.QueryContext(ctx, "SELECT id, "+auditColumns+", prev_hash, entry_hash FROM audit_logs ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("error querying audit chain: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prevHash, entryHash sql.NullString
+		log, err := scanAuditLog(rows, &prevHash, &entryHash)
+		if err != nil {
+			return err
+		}
+		log.PrevHash, log.EntryHash = prevHash.String, entryHash.String
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// AuditCheckpoint is a signed record of the chain head at a point in time
+type AuditCheckpoint struct {
+	ID        int
+	LastLogID int64
+	EntryHash string
+	Signature string
+	CreatedAt time.Time
+}
+
+// CreateAuditCheckpoint records the current chain head, signed by sign. It returns nil without
+// writing when the chain is empty or the head has not moved since the last checkpoint.
+func (c *Client) CreateAuditCheckpoint(ctx context.Context, sign func(lastLogID int64, entryHash string) string) (*AuditCheckpoint, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting checkpoint transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Hold the append lock so the head cannot move while it is read and signed
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLockID); err != nil {
+		return nil, fmt.Errorf("error locking audit chain: %w", err)
+	}
+
+	checkpoint := &AuditCheckpoint{}
+	err = tx.QueryRowContext(ctx, "SELECT id, entry_hash FROM audit_logs WHERE entry_hash IS NOT NULL ORDER BY id DESC LIMIT 1").
+		Scan(&checkpoint.LastLogID, &checkpoint.EntryHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit chain head: %w", err)
+	}
+
+	var latest sql.NullInt64
+	if err := tx.QueryRowContext(ctx, "SELECT MAX(last_log_id) FROM audit_checkpoints").Scan(&latest); err != nil {
+		return nil, fmt.Errorf("error reading latest checkpoint: %w", err)
+	}
+	if latest.Valid && latest.Int64 >= checkpoint.LastLogID {
+		return nil, nil
+	}
+
+	checkpoint.Signature = sign(checkpoint.LastLogID, checkpoint.EntryHash)
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO audit_checkpoints (last_log_id, entry_hash, signature) VALUES ($1, $2, $3) RETURNING id, created_at",
+		checkpoint.LastLogID, checkpoint.EntryHash, checkpoint.Signature,
+	).Scan(&checkpoint.ID, &checkpoint.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting audit checkpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing audit checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// ListAuditCheckpoints returns all checkpoints ordered by the entry they cover
+func (c *Client) ListAuditCheckpoints(ctx context.Context) ([]AuditCheckpoint, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT id, last_log_id, entry_hash, signature, created_at FROM audit_checkpoints ORDER BY last_log_id, id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []AuditCheckpoint
+	for rows.Next() {
+		var cp AuditCheckpoint
+		if err := rows.Scan(&cp.ID, &cp.LastLogID, &cp.EntryHash, &cp.Signature, &cp.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning audit checkpoint: %w", err)
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
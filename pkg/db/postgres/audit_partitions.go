@@ -0,0 +1,272 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// auditMaintenanceLockID keeps partition maintenance to one replica at a time
+const auditMaintenanceLockID = 0x617564697470 // "auditp"
+
+// auditPartitionName matches the monthly partitions of audit_logs, audit_logs_YYYY_MM
+var auditPartitionName = regexp.MustCompile(`^audit_logs_(\d{4})_(\d{2})$`)
+
+// AuditPartition is a monthly audit_logs partition covering [From, To) in UTC
+type AuditPartition struct {
+	Name     string
+	From     time.Time
+	To       time.Time
+	Attached bool // False once detached for archival
+}
+
+// AuditPartitionName returns the partition name for the month containing t
+func AuditPartitionName(t time.Time) string {
+	return fmt.Sprintf("audit_logs_%04d_%02d", t.UTC().Year(), t.UTC().Month())
+}
+
+// monthStart truncates t to the first instant of its UTC month
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// WithAuditMaintenanceLock runs fn while holding a session advisory lock, reporting false without
+// running fn when another replica holds it
+func (c *Client) WithAuditMaintenanceLock(ctx context.Context, fn func() error) (bool, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", auditMaintenanceLockID).Scan(&locked); err != nil {
+		return false, fmt.Errorf("error acquiring maintenance lock: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", auditMaintenanceLockID)
+
+	return true, fn()
+}
+
+// EnsureAuditPartitions creates the partitions for the month containing from and the following
+// months, skipping those that already exist. Months with entries in the default partition, written
+// while their partition was missing, are created as well and the entries moved into them.
+func (c *Client) EnsureAuditPartitions(ctx context.Context, from time.Time, months int) error {
+	start := monthStart(from)
+	end := start.AddDate(0, months, 0)
+
+	var oldest sql.NullTime
+	if err := c.db.QueryRowContext(ctx, "SELECT min(created_at) FROM audit_logs_default").Scan(&oldest); err != nil {
+		return fmt.Errorf("error querying the default audit partition: %w", err)
+	}
+	if oldest.Valid && oldest.Time.Before(start) {
+		start = monthStart(oldest.Time)
+	}
+
+	for lower := start; !lower.After(end); lower = lower.AddDate(0, 1, 0) {
+		if err := c.createAuditPartition(ctx, lower, lower.AddDate(0, 1, 0)); err != nil {
+			return fmt.Errorf("error creating audit partition %s: %w", AuditPartitionName(lower), err)
+		}
+	}
+	return nil
+}
+
+// createAuditPartition creates the partition for [lower, upper) unless a table of that name exists,
+// attaching it only once the default partition's entries in that range are moved into it
+func (c *Client) createAuditPartition(ctx context.Context, lower, upper time.Time) error {
+	name := AuditPartitionName(lower)
+	var exists bool
+	if err := c.db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", pq.QuoteIdentifier(name)).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	table := pq.QuoteIdentifier(name)
+	bounds := fmt.Sprintf("FROM (%s) TO (%s)",
+		pq.QuoteLiteral(lower.Format(time.RFC3339)),
+		pq.QuoteLiteral(upper.Format(time.RFC3339)),
+	)
+	return c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		// Attaching scans the default partition, holding its lock keeps new entries out meanwhile
+		if _, err := tx.ExecContext(ctx, "LOCK TABLE audit_logs_default IN ACCESS EXCLUSIVE MODE"); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "CREATE TABLE "+table+" (LIKE audit_logs INCLUDING DEFAULTS INCLUDING CONSTRAINTS)"); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `
+			WITH moved AS (
+				DELETE FROM audit_logs_default WHERE created_at >= $1 AND created_at < $2 RETURNING *
+			)
+			INSERT INTO `+table+` SELECT * FROM moved`, lower, upper)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "ALTER TABLE audit_logs ATTACH PARTITION "+table+" FOR VALUES "+bounds)
+		return err
+	})
+}
+
+// ListAuditPartitions returns the attached and detached monthly partitions, oldest first
+func (c *Client) ListAuditPartitions(ctx context.Context) ([]AuditPartition, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT c.relname, c.relispartition
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r' AND n.nspname = current_schema() AND c.relname LIKE 'audit\_logs\_%'
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []AuditPartition
+	for rows.Next() {
+		var p AuditPartition
+		if err := rows.Scan(&p.Name, &p.Attached); err != nil {
+			return nil, fmt.Errorf("error scanning audit partition: %w", err)
+		}
+		match := auditPartitionName.FindStringSubmatch(p.Name)
+		if match == nil {
+			continue
+		}
+		from, err := time.Parse("2006-01", match[1]+"-"+match[2])
+		if err != nil {
+			continue
+		}
+		p.From, p.To = from, from.AddDate(0, 1, 0)
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// DetachAuditPartition removes a partition from audit_logs, its rows stay in the standalone table
+func (c *Client) DetachAuditPartition(ctx context.Context, name string) error {
+	if _, err := c.db.ExecContext(ctx, "ALTER TABLE audit_logs DETACH PARTITION "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("error detaching audit partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// AnchorAuditPartition records the hashes of entries in a detached partition that entries still in
+// audit_logs link to, and removes the checkpoints that covered its entries, so the remaining chain
+// still verifies once the partition is dropped. sign may be nil.
+func (c *Client) AnchorAuditPartition(ctx context.Context, name string, sign func(logID int64, entryHash string) string) error {
+	table := pq.QuoteIdentifier(name)
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting anchor transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT p.id, p.entry_hash FROM `+table+` p
+		WHERE p.entry_hash IN (SELECT prev_hash FROM audit_logs WHERE prev_hash IS NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("error finding chain anchors in %s: %w", name, err)
+	}
+	var anchors []AuditChainAnchor
+	for rows.Next() {
+		anchor := AuditChainAnchor{PartitionName: name}
+		if err := rows.Scan(&anchor.LogID, &anchor.EntryHash); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning chain anchor: %w", err)
+		}
+		anchors = append(anchors, anchor)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error finding chain anchors in %s: %w", name, err)
+	}
+
+	for _, anchor := range anchors {
+		var signature sql.NullString
+		if sign != nil {
+			signature = sql.NullString{String: sign(anchor.LogID, anchor.EntryHash), Valid: true}
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO audit_chain_anchors (entry_hash, log_id, partition_name, signature) VALUES ($1, $2, $3, $4) ON CONFLICT (entry_hash) DO NOTHING",
+			anchor.EntryHash, anchor.LogID, name, signature,
+		)
+		if err != nil {
+			return fmt.Errorf("error inserting chain anchor: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM audit_checkpoints WHERE last_log_id IN (SELECT id FROM "+table+")"); err != nil {
+		return fmt.Errorf("error removing checkpoints covered by %s: %w", name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing anchors for %s: %w", name, err)
+	}
+	return nil
+}
+
+// StreamAuditPartition calls fn for every entry of a partition in chain order
+func (c *Client) StreamAuditPartition(ctx context.Context, name string, fn func(AuditLog) error) error {
+	rows, err := c.db.QueryContext(ctx, "SELECT id, "+auditColumns+", prev_hash, entry_hash FROM "+pq.QuoteIdentifier(name)+" ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("error querying audit partition %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prevHash, entryHash sql.NullString
+		log, err := scanAuditLog(rows, &prevHash, &entryHash)
+		if err != nil {
+			return err
+		}
+		log.PrevHash, log.EntryHash = prevHash.String, entryHash.String
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// DropAuditPartition drops a detached partition
+func (c *Client) DropAuditPartition(ctx context.Context, name string) error {
+	if _, err := c.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+pq.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("error dropping audit partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// AuditChainAnchor is the hash of an archived entry that the remaining chain links to
+type AuditChainAnchor struct {
+	EntryHash     string
+	LogID         int64
+	PartitionName string
+	Signature     string // Empty when no checkpoint key was configured at archival
+}
+
+// ListAuditChainAnchors returns all anchors left by archived partitions
+func (c *Client) ListAuditChainAnchors(ctx context.Context) ([]AuditChainAnchor, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT entry_hash, log_id, partition_name, signature FROM audit_chain_anchors ORDER BY log_id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying chain anchors: %w", err)
+	}
+	defer rows.Close()
+
+	var anchors []AuditChainAnchor
+	for rows.Next() {
+		var anchor AuditChainAnchor
+		var signature sql.NullString
+		if err := rows.Scan(&anchor.EntryHash, &anchor.LogID, &anchor.PartitionName, &signature); err != nil {
+			return nil, fmt.Errorf("error scanning chain anchor: %w", err)
+		}
+		anchor.Signature = signature.String
+		anchors = append(anchors, anchor)
+	}
+	return anchors, rows.Err()
+}
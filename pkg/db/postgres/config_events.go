@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ConfigEventsChannel is the NOTIFY channel of the config_events trigger, the payload is the event ID
+const ConfigEventsChannel = "config_events"
+
+// Types of config event
+const (
+	ConfigCreated = "created"
+	ConfigUpdated = "updated"
+	ConfigDeleted = "deleted"
+)
+
+// ConfigEvent records one write to an application config. IDs increase in commit order.
+type ConfigEvent struct {
+	ID        int64
+	ConfigID  int
+	UserID    int
+	Name      string
+	Namespace string
+	Version   int // Version written, or the last version of a deleted config
+	Type      string
+	CreatedAt time.Time
+}
+
+// ConfigEventFilter narrows the events read, zero values match everything
+type ConfigEventFilter struct {
+	UserID    int
+	Namespace string
+	Name      string
+}
+
+func (f ConfigEventFilter) where(args []interface{}) (string, []interface{}) {
+	var conditions []string
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.UserID != 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Namespace != "" {
+		add("namespace = $%d", f.Namespace)
+	}
+	if f.Name != "" {
+		add("name = $%d", f.Name)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// ListConfigEvents returns up to limit events matching filter with an ID above afterID, oldest first
+func (c *Client) ListConfigEvents(ctx context.Context, filter ConfigEventFilter, afterID int64, limit int) ([]ConfigEvent, error) {
+	where, args := filter.where([]interface{}{afterID})
+	args = append(args, limit)
+	rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, config_id, user_id, name, namespace, version, type, created_at
+		FROM config_events
+		WHERE id > $1%s
+		ORDER BY id
+		LIMIT $%d`, where, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []ConfigEvent
+	for rows.Next() {
+		var event ConfigEvent
+		var userID sql.NullInt64
+		if err := rows.Scan(&event.ID, &event.ConfigID, &userID, &event.Name, &event.Namespace, &event.Version, &event.Type, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan config event row: %w", err)
+		}
+		event.UserID = int(userID.Int64)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// LatestConfigEventID returns the ID of the newest event, zero when there is none
+func (c *Client) LatestConfigEventID(ctx context.Context) (int64, error) {
+	var id int64
+	if err := c.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM config_events").Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to read latest config event: %w", err)
+	}
+	return id, nil
+}
+
+// ConfigEventRetained reports whether the event with the given ID is still stored. Events are pruned
+// oldest first, so when it is, so is every event after it.
+func (c *Client) ConfigEventRetained(ctx context.Context, id int64) (bool, error) {
+	var retained bool
+	if err := c.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM config_events WHERE id = $1)", id).Scan(&retained); err != nil {
+		return false, fmt.Errorf("failed to check config event: %w", err)
+	}
+	return retained, nil
+}
+
+// ConfigEventForVersion returns the ID of the event that wrote the given version of a config, the
+// newest one if the config was deleted and created again. sql.ErrNoRows is returned when no such
+// event is stored.
+func (c *Client) ConfigEventForVersion(ctx context.Context, filter ConfigEventFilter, version int) (int64, error) {
+	where, args := filter.where([]interface{}{version, ConfigDeleted})
+	var id sql.NullInt64
+	err := c.db.QueryRowContext(ctx,
+		"SELECT MAX(id) FROM config_events WHERE version = $1 AND type <> $2"+where, args...,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find config event: %w", err)
+	}
+	if !id.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return id.Int64, nil
+}
+
+// PruneConfigEvents deletes events recorded before the cutoff. Deletion stops at the newest such
+// event, so what remains is always every event after some ID.
+func (c *Client) PruneConfigEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := c.db.ExecContext(ctx, `
+		DELETE FROM config_events
+		WHERE id <= (SELECT MAX(id) FROM config_events WHERE created_at < $1)`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune config events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ListenConfigEvents opens a dedicated connection listening on ConfigEventsChannel. The listener
+// reconnects by itself and sends a nil notification after reconnecting, since notifications may
+// have been lost while it was down. eventCallback, if not nil, reports connection state changes.
+func ListenConfigEvents(config Config, eventCallback pq.EventCallbackType) (*pq.Listener, error) {
+	listener := pq.NewListener(config.connString(), 10*time.Second, time.Minute, eventCallback)
+	if err := listener.Listen(ConfigEventsChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error listening for config events: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Outcomes of importing one config
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportSkipped = "skipped"
+)
+
+// Reasons an import skips a config
+const (
+	ImportUnchanged = "unchanged" // The stored data is already equal
+	ImportExists    = "exists"    // The config exists and overwriting was not requested
+)
+
+// ConfigImport is one config written by ImportApplicationConfigs. Config carries the name,
+// namespace, user and data to write, and receives the stored row. Action and Reason report what
+// was done with it.
+type ConfigImport struct {
+	Config ApplicationConfig
+	Action string
+	Reason string // Why the config was skipped
+}
+
+// errDryRun rolls back a dry-run import once every config has been written
+var errDryRun = errors.New("dry run")
+
+// ImportApplicationConfigs writes the imports in order in one transaction, so either all of them
+// are applied or none is. A config that does not exist is created. One whose stored data differs is
+// updated, keeping its bases, unless overwrite is false. One whose data is equal is skipped. Each
+// change is recorded as a version with message. With dryRun the transaction is rolled back after
+// the last write, so the outcomes and versions are exactly those a real import would produce.
+func (c *Client) ImportApplicationConfigs(ctx context.Context, imports []ConfigImport, overwrite, dryRun bool, message string) error {
+	err := c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		for i := range imports {
+			if err := importApplicationConfig(ctx, tx, &imports[i], overwrite, message); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// importApplicationConfig creates, updates or skips one config, locking the stored row first
+func importApplicationConfig(ctx context.Context, tx *sql.Tx, item *ConfigImport, overwrite bool, message string) error {
+	config := &item.Config
+	var current ConfigRevision
+	var unchanged bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, version, config_data = $4::jsonb, bases, created_at, updated_at FROM application_configs
+		WHERE name = $1 AND namespace = $2 AND user_id = $3
+		FOR UPDATE`, config.Name, config.Namespace, config.UserID, config.ConfigData,
+	).Scan(&current.ID, &current.Version, &unchanged, &config.Bases, &config.CreatedAt, &config.UpdatedAt)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		config.Bases = ConfigBases{}
+		if err := insertApplicationConfig(ctx, tx, config); err != nil {
+			return err
+		}
+		item.Action = ImportCreated
+	case err != nil:
+		return fmt.Errorf("failed to read application config %s/%s: %w", config.Namespace, config.Name, err)
+	case unchanged || !overwrite:
+		config.ID, config.Version = current.ID, current.Version
+		item.Action, item.Reason = ImportSkipped, ImportExists
+		if unchanged {
+			item.Reason = ImportUnchanged
+		}
+		return nil
+	default:
+		if err := updateConfigData(ctx, tx, config, current); err != nil {
+			return err
+		}
+		item.Action = ImportUpdated
+	}
+	return insertConfigVersion(ctx, tx, config, message, 0)
+}
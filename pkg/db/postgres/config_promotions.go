@@ -0,0 +1,270 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// States of a config promotion
+const (
+	PromotionPending  = "pending"
+	PromotionApproved = "approved"
+	PromotionRejected = "rejected"
+)
+
+// ErrPromotionNotPending is returned when a promotion was already approved or rejected
+var ErrPromotionNotPending error = &reportedError{
+	message: "config promotion is no longer pending",
+	code:    "conflict",
+	detail:  " was already reviewed",
+}
+
+// ConfigPromotion is a request to copy one version of a config into another namespace
+type ConfigPromotion struct {
+	ID              int
+	Name            string
+	UserID          int // Owner of the source and target configs
+	SourceNamespace string
+	SourceVersion   int
+	TargetNamespace string
+	TargetConfigID  int // Zero when the target did not exist
+	TargetVersion   int // Version of the target when requested, zero when it did not exist
+	ConfigData      string
+	Bases           ConfigBases
+	Status          string
+	Message         string
+	RequestedBy     int
+	ReviewedBy      int
+	ReviewComment   string
+	AppliedVersion  int // Version of the target written on approval
+	CreatedAt       time.Time
+	ReviewedAt      *time.Time
+}
+
+// ConfigPromotionFilter narrows ListConfigPromotions, zero values match everything
+type ConfigPromotionFilter struct {
+	TargetNamespace string
+	Status          string
+	UserID          int // Owner
+	RequestedBy     int
+}
+
+const configPromotionColumns = `id, name, user_id, source_namespace, source_version, target_namespace, target_config_id,
+	target_version, config_data, bases, status, message, requested_by, reviewed_by, review_comment, applied_version,
+	created_at, reviewed_at`
+
+func scanConfigPromotion(row interface{ Scan(...interface{}) error }) (*ConfigPromotion, error) {
+	p := &ConfigPromotion{}
+	var targetConfigID, requestedBy, reviewedBy, appliedVersion sql.NullInt64
+	var reviewedAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.UserID, &p.SourceNamespace, &p.SourceVersion, &p.TargetNamespace, &targetConfigID,
+		&p.TargetVersion, &p.ConfigData, &p.Bases, &p.Status, &p.Message, &requestedBy, &reviewedBy, &p.ReviewComment, &appliedVersion,
+		&p.CreatedAt, &reviewedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.TargetConfigID, p.RequestedBy = int(targetConfigID.Int64), int(requestedBy.Int64)
+	p.ReviewedBy, p.AppliedVersion = int(reviewedBy.Int64), int(appliedVersion.Int64)
+	if reviewedAt.Valid {
+		p.ReviewedAt = &reviewedAt.Time
+	}
+	return p, nil
+}
+
+// CreateConfigPromotion records a pending promotion of promotion.SourceVersion of a config into
+// promotion.TargetNamespace, copying the data and bases of that version and noting the current
+// version of the target. The event returned by audit is appended to the audit log in the same
+// transaction. sql.ErrNoRows is returned when the source version does not exist, a unique
+// constraint violation when a promotion into the same target is already pending.
+func (c *Client) CreateConfigPromotion(ctx context.Context, promotion *ConfigPromotion, audit func(*ConfigPromotion) AuditEvent) error {
+	return c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			SELECT v.config_data, v.bases
+			FROM application_config_versions v
+			JOIN application_configs c ON c.id = v.config_id
+			WHERE c.name = $1 AND c.namespace = $2 AND c.user_id = $3 AND v.version = $4`,
+			promotion.Name, promotion.SourceNamespace, promotion.UserID, promotion.SourceVersion,
+		).Scan(&promotion.ConfigData, &promotion.Bases)
+		if err != nil {
+			return err
+		}
+
+		promotion.TargetConfigID, promotion.TargetVersion = 0, 0
+		err = tx.QueryRowContext(ctx,
+			"SELECT id, version FROM application_configs WHERE name = $1 AND namespace = $2 AND user_id = $3",
+			promotion.Name, promotion.TargetNamespace, promotion.UserID,
+		).Scan(&promotion.TargetConfigID, &promotion.TargetVersion)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to read promotion target: %w", err)
+		}
+
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO config_promotions (name, user_id, source_namespace, source_version, target_namespace,
+				target_config_id, target_version, config_data, bases, message, requested_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING `+configPromotionColumns,
+			promotion.Name, promotion.UserID, promotion.SourceNamespace, promotion.SourceVersion, promotion.TargetNamespace,
+			nullableUserID(promotion.TargetConfigID), promotion.TargetVersion, promotion.ConfigData, promotion.Bases,
+			promotion.Message, nullableUserID(promotion.RequestedBy),
+		)
+		stored, err := scanConfigPromotion(row)
+		if err != nil {
+			return err
+		}
+		*promotion = *stored
+		return appendAuditEvents(ctx, tx, []AuditEvent{audit(promotion)})
+	})
+}
+
+// GetConfigPromotion returns a promotion by ID, sql.ErrNoRows when it does not exist
+func (c *Client) GetConfigPromotion(ctx context.Context, id int) (*ConfigPromotion, error) {
+	return scanConfigPromotion(c.db.QueryRowContext(ctx, "SELECT "+configPromotionColumns+" FROM config_promotions WHERE id = $1", id))
+}
+
+// ListConfigPromotions returns promotions matching filter, newest first
+func (c *Client) ListConfigPromotions(ctx context.Context, filter ConfigPromotionFilter, limit int) ([]ConfigPromotion, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.TargetNamespace != "" {
+		add("target_namespace = $%d", filter.TargetNamespace)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if filter.UserID != 0 {
+		add("user_id = $%d", filter.UserID)
+	}
+	if filter.RequestedBy != 0 {
+		add("requested_by = $%d", filter.RequestedBy)
+	}
+
+	query := "SELECT " + configPromotionColumns + " FROM config_promotions"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config promotions: %w", err)
+	}
+	defer rows.Close()
+
+	var promotions []ConfigPromotion
+	for rows.Next() {
+		p, err := scanConfigPromotion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan config promotion row: %w", err)
+		}
+		promotions = append(promotions, *p)
+	}
+	return promotions, rows.Err()
+}
+
+// ApproveConfigPromotion applies a pending promotion to its target as a new version and marks it
+// approved, together with the audit event returned by audit, in one transaction. The target must
+// still be at the version the promotion was requested against, otherwise ErrConfigVersionMismatch
+// is returned and the promotion stays pending. A target created since the request fails with a
+// unique constraint violation. ErrPromotionNotPending is returned when it was already reviewed.
+func (c *Client) ApproveConfigPromotion(ctx context.Context, id, reviewerID int, comment string, audit func(*ConfigPromotion) AuditEvent) (*ConfigPromotion, *ApplicationConfig, error) {
+	var promotion *ConfigPromotion
+	var config *ApplicationConfig
+	err := c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		promotion, err = scanConfigPromotion(tx.QueryRowContext(ctx,
+			"SELECT "+configPromotionColumns+" FROM config_promotions WHERE id = $1 FOR UPDATE", id))
+		if err != nil {
+			return err
+		}
+		if promotion.Status != PromotionPending {
+			return ErrPromotionNotPending
+		}
+
+		config = &ApplicationConfig{
+			Name:       promotion.Name,
+			Namespace:  promotion.TargetNamespace,
+			UserID:     promotion.UserID,
+			ConfigData: promotion.ConfigData,
+			Bases:      promotion.Bases,
+		}
+		if promotion.TargetConfigID == 0 {
+			err = insertApplicationConfig(ctx, tx, config)
+		} else {
+			err = updateConfigData(ctx, tx, config, ConfigRevision{ID: promotion.TargetConfigID, Version: promotion.TargetVersion})
+			if errors.Is(err, sql.ErrNoRows) {
+				// The target was deleted after the request, the promotion cannot apply as reviewed
+				err = ErrConfigVersionMismatch
+			}
+		}
+		if err != nil {
+			return err
+		}
+		message := fmt.Sprintf("Promoted from %s version %d", promotion.SourceNamespace, promotion.SourceVersion)
+		if promotion.Message != "" {
+			message += ": " + promotion.Message
+		}
+		if err := insertConfigVersion(ctx, tx, config, message, 0); err != nil {
+			return err
+		}
+
+		promotion, err = scanConfigPromotion(tx.QueryRowContext(ctx, `
+			UPDATE config_promotions
+			SET status = $2, reviewed_by = $3, review_comment = $4, applied_version = $5, reviewed_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING `+configPromotionColumns,
+			id, PromotionApproved, nullableUserID(reviewerID), comment, config.Version,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to mark config promotion approved: %w", err)
+		}
+		return appendAuditEvents(ctx, tx, []AuditEvent{audit(promotion)})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return promotion, config, nil
+}
+
+// RejectConfigPromotion marks a pending promotion rejected and appends the audit event returned by
+// audit in the same transaction. sql.ErrNoRows is returned when it does not exist,
+// ErrPromotionNotPending when it was already reviewed.
+func (c *Client) RejectConfigPromotion(ctx context.Context, id, reviewerID int, comment string, audit func(*ConfigPromotion) AuditEvent) (*ConfigPromotion, error) {
+	var promotion *ConfigPromotion
+	err := c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		promotion, err = scanConfigPromotion(tx.QueryRowContext(ctx, `
+			UPDATE config_promotions
+			SET status = $2, reviewed_by = $3, review_comment = $4, reviewed_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND status = $5
+			RETURNING `+configPromotionColumns,
+			id, PromotionRejected, nullableUserID(reviewerID), comment, PromotionPending,
+		))
+		if errors.Is(err, sql.ErrNoRows) {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM config_promotions WHERE id = $1)", id).Scan(&exists); err != nil {
+				return fmt.Errorf("failed to check config promotion: %w", err)
+			}
+			if exists {
+				return ErrPromotionNotPending
+			}
+			return sql.ErrNoRows
+		}
+		if err != nil {
+			return err
+		}
+		return appendAuditEvents(ctx, tx, []AuditEvent{audit(promotion)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
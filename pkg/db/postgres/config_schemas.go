@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ConfigSchema is one version of a JSON Schema bound to the configs of a namespace whose names match ConfigPattern
+type ConfigSchema struct {
+	ID            int
+	Namespace     string
+	Name          string
+	Version       int
+	ConfigPattern string // Glob matched against config names, see path.Match
+	Schema        string // JSON Schema document
+	Description   string
+	AuthorID      int
+	CreatedAt     time.Time
+}
+
+const configSchemaColumns = "id, namespace, name, version, config_pattern, schema, description, author_id, created_at"
+
+func scanConfigSchema(row interface{ Scan(...interface{}) error }) (*ConfigSchema, error) {
+	s := &ConfigSchema{}
+	var authorID sql.NullInt64
+	err := row.Scan(&s.ID, &s.Namespace, &s.Name, &s.Version, &s.ConfigPattern, &s.Schema, &s.Description, &authorID, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.AuthorID = int(authorID.Int64)
+	return s, nil
+}
+
+// CreateConfigSchema stores schema as the next version of its name in its namespace, filling in ID,
+// Version and CreatedAt. Two concurrent registrations of the same name fail one of them with a
+// unique constraint violation.
+func (c *Client) CreateConfigSchema(ctx context.Context, schema *ConfigSchema) error {
+	query := `
+		INSERT INTO config_schemas (namespace, name, version, config_pattern, schema, description, author_id)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+		FROM config_schemas WHERE namespace = $1 AND name = $2
+		RETURNING id, version, created_at
+	`
+	return c.db.QueryRowContext(ctx, query,
+		schema.Namespace, schema.Name, schema.ConfigPattern, schema.Schema, schema.Description, nullableUserID(schema.AuthorID),
+	).Scan(&schema.ID, &schema.Version, &schema.CreatedAt)
+}
+
+// ListConfigSchemas returns the latest version of every schema in a namespace, ordered by name
+func (c *Client) ListConfigSchemas(ctx context.Context, namespace string) ([]ConfigSchema, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (name) `+configSchemaColumns+`
+		FROM config_schemas
+		WHERE namespace = $1
+		ORDER BY name, version DESC`, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config schemas: %w", err)
+	}
+	return collectConfigSchemas(rows)
+}
+
+// ListConfigSchemaVersions returns every version of a schema, newest first
+func (c *Client) ListConfigSchemaVersions(ctx context.Context, namespace, name string) ([]ConfigSchema, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT `+configSchemaColumns+`
+		FROM config_schemas
+		WHERE namespace = $1 AND name = $2
+		ORDER BY version DESC`, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config schema versions: %w", err)
+	}
+	return collectConfigSchemas(rows)
+}
+
+func collectConfigSchemas(rows *sql.Rows) ([]ConfigSchema, error) {
+	defer rows.Close()
+	var schemas []ConfigSchema
+	for rows.Next() {
+		s, err := scanConfigSchema(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan config schema row: %w", err)
+		}
+		schemas = append(schemas, *s)
+	}
+	return schemas, rows.Err()
+}
+
+// GetConfigSchema returns one version of a schema, or the latest when version is zero.
+// sql.ErrNoRows is returned when it does not exist.
+func (c *Client) GetConfigSchema(ctx context.Context, namespace, name string, version int) (*ConfigSchema, error) {
+	query := `
+		SELECT ` + configSchemaColumns + `
+		FROM config_schemas
+		WHERE namespace = $1 AND name = $2 AND ($3 = 0 OR version = $3)
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	return scanConfigSchema(c.db.QueryRowContext(ctx, query, namespace, name, version))
+}
+
+// DeleteConfigSchema removes every version of a schema, unbinding it from its configs.
+// sql.ErrNoRows is returned when it does not exist.
+func (c *Client) DeleteConfigSchema(ctx context.Context, namespace, name string) error {
+	result, err := c.db.ExecContext(ctx, "DELETE FROM config_schemas WHERE namespace = $1 AND name = $2", namespace, name)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete config schema query: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected after delete: %w", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConfigVersionMismatch is returned when a conditional change finds that the config has moved on
+// from the expected revision
+var ErrConfigVersionMismatch error = &reportedError{
+	message: "application config version mismatch",
+	code:    "precondition_failed",
+	detail:  " has changed since it was read, fetch it again and retry",
+}
+
+// ConfigRevision identifies one version of one config. The config ID is part of it, so a config that
+// was deleted and created again does not match revisions of its predecessor. The zero value matches
+// any revision.
+type ConfigRevision struct {
+	ID      int
+	Version int
+}
+
+// IsZero reports whether the revision matches anything
+func (r ConfigRevision) IsZero() bool {
+	return r.ID == 0 && r.Version == 0
+}
+
+// ConfigRef names another config of the same user. An empty Namespace means the namespace of the
+// config holding the reference.
+type ConfigRef struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ConfigBases lists the configs a config is layered on, in the order they are merged beneath its own
+// data. It is stored as a JSONB array. A nil ConfigBases is written as NULL, which the update
+// statements read as "keep the stored bases".
+type ConfigBases []ConfigRef
+
+// Value implements driver.Valuer
+func (b ConfigBases) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal([]ConfigRef(b))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (b *ConfigBases) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*b = ConfigBases{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ConfigBases", src)
+	}
+	refs := ConfigBases{}
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return fmt.Errorf("failed to decode config bases: %w", err)
+	}
+	*b = refs
+	return nil
+}
+
+// ConfigVersion is an immutable snapshot of an application config written by a create, update or rollback
+type ConfigVersion struct {
+	ID             int64
+	ConfigID       int
+	Version        int
+	ConfigData     string      // Empty when listing versions
+	Bases          ConfigBases // Nil when listing versions
+	AuthorID       int         // Zero when the author is unknown
+	Message        string
+	RolledBackFrom int // Version restored by a rollback, zero for ordinary changes
+	CreatedAt      time.Time
+}
+
+// updateConfigData stores new data for the config identified by name, namespace and user, bumping
+// its version, and scans the stored row back into config. The stored bases are kept when config.Bases
+// is nil. Unless expected is zero the update is a
+// compare-and-swap on the stored revision.
+func updateConfigData(ctx context.Context, tx *sql.Tx, config *ApplicationConfig, expected ConfigRevision) error {
+	query := `
+		UPDATE application_configs
+		SET config_data = $1, bases = COALESCE($7::jsonb, bases), version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE name = $2 AND namespace = $3 AND user_id = $4 AND ($5 = 0 OR (id = $5 AND version = $6))
+		RETURNING id, version, bases, created_at, updated_at
+	`
+	err := tx.QueryRowContext(ctx, query,
+		config.ConfigData, config.Name, config.Namespace, config.UserID, expected.ID, expected.Version, config.Bases,
+	).Scan(&config.ID, &config.Version, &config.Bases, &config.CreatedAt, &config.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) && !expected.IsZero() {
+		return staleOrMissing(ctx, tx, config.Name, config.Namespace, config.UserID)
+	}
+	// sql.ErrNoRows is returned unwrapped when the config does not exist
+	return err
+}
+
+// staleOrMissing tells apart a failed compare-and-swap from a config that does not exist
+func staleOrMissing(ctx context.Context, tx *sql.Tx, name, namespace string, userID int) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM application_configs WHERE name = $1 AND namespace = $2 AND user_id = $3)",
+		name, namespace, userID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check application config: %w", err)
+	}
+	if exists {
+		return ErrConfigVersionMismatch
+	}
+	return sql.ErrNoRows
+}
+
+// insertConfigVersion records the current state of config as a version row
+func insertConfigVersion(ctx context.Context, tx *sql.Tx, config *ApplicationConfig, message string, rolledBackFrom int) error {
+	query := `
+		INSERT INTO application_config_versions (config_id, version, config_data, bases, author_id, message, rolled_back_from, name, namespace, user_id)
+		VALUES ($1, $2, $3, COALESCE($4::jsonb, '[]'), $5, $6, $7, $8, $9, $10)
+	`
+	rollback := sql.NullInt64{Int64: int64(rolledBackFrom), Valid: rolledBackFrom != 0}
+	_, err := tx.ExecContext(ctx, query,
+		config.ID, config.Version, config.ConfigData, config.Bases, nullableUserID(config.UserID), message, rollback,
+		config.Name, config.Namespace, config.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record config version: %w", err)
+	}
+	return nil
+}
+
+// historyConfigID finds the config whose history is kept under a name: the current config of that
+// name, or the last one deleted when there is none. Versions are looked up by the name stored on
+// them, so history stays readable after its config is deleted. sql.ErrNoRows is returned when no
+// config of that name ever had a version.
+func (c *Client) historyConfigID(ctx context.Context, name, namespace string, userID int) (int, error) {
+	var configID int
+	err := c.db.QueryRowContext(ctx, `
+		SELECT config_id FROM application_config_versions
+		WHERE name = $1 AND namespace = $2 AND user_id = $3
+		ORDER BY id DESC
+		LIMIT 1`, name, namespace, userID,
+	).Scan(&configID)
+	return configID, err
+}
+
+// ListApplicationConfigVersions returns the history of a config newest first, without the data, also
+// after the config was deleted. sql.ErrNoRows is returned when the config never existed.
+func (c *Client) ListApplicationConfigVersions(ctx context.Context, name, namespace string, userID int) ([]ConfigVersion, error) {
+	configID, err := c.historyConfigID(ctx, name, namespace, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT id, config_id, version, author_id, message, rolled_back_from, created_at
+		FROM application_config_versions
+		WHERE config_id = $1
+		ORDER BY version DESC`, configID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query config versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []ConfigVersion
+	for rows.Next() {
+		var v ConfigVersion
+		var authorID, rolledBackFrom sql.NullInt64
+		if err := rows.Scan(&v.ID, &v.ConfigID, &v.Version, &authorID, &v.Message, &rolledBackFrom, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan config version row: %w", err)
+		}
+		v.AuthorID, v.RolledBackFrom = int(authorID.Int64), int(rolledBackFrom.Int64)
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetApplicationConfigVersion returns one version of a config including its data, also after the
+// config was deleted. sql.ErrNoRows is returned when the config never existed or the version does not exist.
+func (c *Client) GetApplicationConfigVersion(ctx context.Context, name, namespace string, userID, version int) (*ConfigVersion, error) {
+	configID, err := c.historyConfigID(ctx, name, namespace, userID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT id, config_id, version, config_data, bases, author_id, message, rolled_back_from, created_at
+		FROM application_config_versions
+		WHERE config_id = $1 AND version = $2
+	`
+	v := &ConfigVersion{}
+	var authorID, rolledBackFrom sql.NullInt64
+	err = c.db.QueryRowContext(ctx, query, configID, version).Scan(
+		&v.ID, &v.ConfigID, &v.Version, &v.ConfigData, &v.Bases, &authorID, &v.Message, &rolledBackFrom, &v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	v.AuthorID, v.RolledBackFrom = int(authorID.Int64), int(rolledBackFrom.Int64)
+	return v, nil
+}
+
+// RollbackApplicationConfig restores the data and bases of an earlier version. The rollback is itself recorded
+// as a new version, so history is never rewritten. check is called with the restored config before it is
+// written, and an error from it aborts the rollback and is returned as is. sql.ErrNoRows is returned when the
+// config or the version does not exist, ErrConfigVersionMismatch when expected is set and no longer current.
+func (c *Client) RollbackApplicationConfig(ctx context.Context, name, namespace string, userID, version int, expected ConfigRevision, message string, check func(restored *ApplicationConfig) error) (*ApplicationConfig, error) {
+	config := &ApplicationConfig{Name: name, Namespace: namespace, UserID: userID}
+	err := c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT v.config_data, v.bases
+			FROM application_config_versions v
+			JOIN application_configs c ON c.id = v.config_id
+			WHERE c.name = $1 AND c.namespace = $2 AND c.user_id = $3 AND v.version = $4
+		`
+		if err := tx.QueryRowContext(ctx, query, name, namespace, userID, version).Scan(&config.ConfigData, &config.Bases); err != nil {
+			return err
+		}
+		if err := check(config); err != nil {
+			return err
+		}
+		if err := updateConfigData(ctx, tx, config, expected); err != nil {
+			return err
+		}
+		return insertConfigVersion(ctx, tx, config, message, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// PatchApplicationConfig computes new data from the stored config with apply and stores it as a new
+// version, keeping the bases. The row stays locked from read to write, so concurrent changes cannot slip in between.
+// An error from apply aborts the transaction and is returned as is. sql.ErrNoRows is returned when
+// the config does not exist, ErrConfigVersionMismatch when expected is set and no longer current.
+func (c *Client) PatchApplicationConfig(ctx context.Context, name, namespace string, userID int, expected ConfigRevision, message string, apply func(current *ApplicationConfig) (string, error)) (*ApplicationConfig, error) {
+	config := &ApplicationConfig{Name: name, Namespace: namespace, UserID: userID}
+	err := c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		var current ConfigRevision
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, version, config_data, bases FROM application_configs
+			WHERE name = $1 AND namespace = $2 AND user_id = $3
+			FOR UPDATE`, name, namespace, userID,
+		).Scan(&current.ID, &current.Version, &config.ConfigData, &config.Bases)
+		if err != nil {
+			return err
+		}
+		if !expected.IsZero() && expected != current {
+			return ErrConfigVersionMismatch
+		}
+
+		config.ID, config.Version = current.ID, current.Version
+		data, err := apply(config)
+		if err != nil {
+			return err
+		}
+		config.ConfigData = data
+		if err := updateConfigData(ctx, tx, config, current); err != nil {
+			return err
+		}
+		return insertConfigVersion(ctx, tx, config, message, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
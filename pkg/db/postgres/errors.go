@@ -0,0 +1,23 @@
+package postgres
+
+// reportedError is a sentinel error that also tells pkg/problem how to report it to a client, so
+// that the mapping lives with the error and not in the HTTP layer
+type reportedError struct {
+	message string
+	code    string // A pkg/problem code
+	detail  string // Follows the resource name in the problem detail
+}
+
+func (e *reportedError) Error() string {
+	return e.message
+}
+
+// ProblemCode names the problem the error stands for
+func (e *reportedError) ProblemCode() string {
+	return e.code
+}
+
+// ProblemDetail describes the error to a client, resource names the entity, e.g. "Application config"
+func (e *reportedError) ProblemDetail(resource string) string {
+	return resource + e.detail
+}
@@ -19,6 +19,11 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	// Connection pool settings, zero values use the defaults below
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 }
 
 // Client represents a PostgreSQL client
@@ -28,31 +33,46 @@ type Client struct {
 
 // ApplicationConfig represents an application configuration in the database
 type ApplicationConfig struct {
-	ID         int       `db:"id"`
-	Name       string    `db:"name"`
-	Namespace  string    `db:"namespace"`
-	UserID     int       `db:"user_id"`
-	ConfigData string    `db:"config_data"` // Stored as JSONB in DB, handled as string in Go
-	CreatedAt  time.Time `db:"created_at"`
-	UpdatedAt  time.Time `db:"updated_at"`
+	ID         int         `db:"id"`
+	Name       string      `db:"name"`
+	Namespace  string      `db:"namespace"`
+	UserID     int         `db:"user_id"`
+	ConfigData string      `db:"config_data"` // Stored as JSONB in DB, handled as string in Go
+	Version    int         `db:"version"`     // Incremented by every change, see application_config_versions
+	Bases      ConfigBases `db:"bases"`       // Configs layered beneath this one, see ConfigBases
+	CreatedAt  time.Time   `db:"created_at"`
+	UpdatedAt  time.Time   `db:"updated_at"`
 }
 
-// NewClient creates a new PostgreSQL client
-func NewClient(ctx context.Context, config Config) (*Client, error) {
-	connStr := fmt.Sprintf(
+// connString formats the connection settings for lib/pq
+func (config Config) connString() string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		config.Host, config.Port, config.User, config.Password, config.DBName, config.SSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", connStr)
+// NewClient creates a new PostgreSQL client
+func NewClient(ctx context.Context, config Config) (*Client, error) {
+	db, err := sql.Open("postgres", config.connString())
 	if err != nil {
 		return nil, fmt.Errorf("error opening database connection: %w", err)
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Minute * 5)
+	maxOpenConns, maxIdleConns, connMaxLifetime := 25, 5, time.Minute*5
+	if config.MaxOpenConns > 0 {
+		maxOpenConns = config.MaxOpenConns
+	}
+	if config.MaxIdleConns > 0 {
+		maxIdleConns = config.MaxIdleConns
+	}
+	if config.ConnMaxLifetime > 0 {
+		connMaxLifetime = config.ConnMaxLifetime
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(connMaxLifetime)
 
 	// Verify the connection
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -262,22 +282,35 @@ func (c *Client) GetCloudCredentialsByUserID(ctx context.Context, userID int) ([
 	return credentials, rows.Err()
 }
 
-// LogAuditEvent logs an audit event to the database
+// LogAuditEvent logs an audit event to the database.
+// A userID of 0 and an empty requestData are stored as NULL (system actors, no payload).
 func (c *Client) LogAuditEvent(ctx context.Context, userID int, action, resourceType, resourceName, namespace string, requestData string, status, message, clientIP string) error {
-	query := `
-		INSERT INTO audit_logs (user_id, action, resource_type, resource_name, namespace, request_data, status, message, client_ip)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
+	// Single events go through the batch insert so they join the hash chain
+	return c.InsertAuditEvents(ctx, []AuditEvent{{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+		Namespace:    namespace,
+		RequestData:  requestData,
+		Status:       status,
+		Message:      message,
+		ClientIP:     clientIP,
+	}})
+}
 
-	_, err := c.db.ExecContext(
-		ctx, query,
-		userID, action, resourceType, resourceName, namespace, requestData, status, message, clientIP,
-	)
-	return err
+// nullableUserID maps the zero user ID to NULL so the users foreign key is not violated
+func nullableUserID(userID int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+}
+
+// nullableString maps an empty string to NULL
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
 
 // ExecuteInTransaction executes the provided function within a transaction
-func (c *Client) ExecuteInTransaction(ctx context.Context, fn func(*sql.Tx) error) error {
+func (c *Client) ExecuteInTransaction(ctx context.Context, fn func(*sql.Tx) error) (err error) {
 	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -292,7 +325,7 @@ func (c *Client) ExecuteInTransaction(ctx context.Context, fn func(*sql.Tx) erro
 			// Rollback on error
 			_ = tx.Rollback()
 		} else {
-			// Commit if no error
+			// Commit if no error, a failed commit is reported to the caller
 			err = tx.Commit()
 		}
 	}()
@@ -301,31 +334,41 @@ func (c *Client) ExecuteInTransaction(ctx context.Context, fn func(*sql.Tx) erro
 	return err
 }
 
-// CreateApplicationConfig creates a new application configuration
-func (c *Client) CreateApplicationConfig(ctx context.Context, config *ApplicationConfig) error {
+// CreateApplicationConfig creates a new application configuration and records it as version 1
+func (c *Client) CreateApplicationConfig(ctx context.Context, config *ApplicationConfig, message string) error {
+	return c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		if err := insertApplicationConfig(ctx, tx, config); err != nil {
+			return err
+		}
+		return insertConfigVersion(ctx, tx, config, message, 0)
+	})
+}
+
+// insertApplicationConfig inserts config and scans the generated columns back into it
+func insertApplicationConfig(ctx context.Context, tx *sql.Tx, config *ApplicationConfig) error {
 	query := `
-		INSERT INTO application_configs (name, namespace, user_id, config_data)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, updated_at
+		INSERT INTO application_configs (name, namespace, user_id, config_data, bases)
+		VALUES ($1, $2, $3, $4, COALESCE($5::jsonb, '[]'))
+		RETURNING id, version, bases, created_at, updated_at
 	`
-	row := c.db.QueryRowContext(
+	row := tx.QueryRowContext(
 		ctx, query,
-		config.Name, config.Namespace, config.UserID, config.ConfigData,
+		config.Name, config.Namespace, config.UserID, config.ConfigData, config.Bases,
 	)
-	return row.Scan(&config.ID, &config.CreatedAt, &config.UpdatedAt)
+	return row.Scan(&config.ID, &config.Version, &config.Bases, &config.CreatedAt, &config.UpdatedAt)
 }
 
 // GetApplicationConfigByNameAndNamespace retrieves a config by name, namespace, and user
 func (c *Client) GetApplicationConfigByNameAndNamespace(ctx context.Context, name, namespace string, userID int) (*ApplicationConfig, error) {
 	query := `
-		SELECT id, name, namespace, user_id, config_data, created_at, updated_at
+		SELECT id, name, namespace, user_id, config_data, version, bases, created_at, updated_at
 		FROM application_configs
 		WHERE name = $1 AND namespace = $2 AND user_id = $3
 	`
 	config := &ApplicationConfig{}
 	err := c.db.QueryRowContext(ctx, query, name, namespace, userID).Scan(
 		&config.ID, &config.Name, &config.Namespace, &config.UserID, &config.ConfigData,
-		&config.CreatedAt, &config.UpdatedAt,
+		&config.Version, &config.Bases, &config.CreatedAt, &config.UpdatedAt,
 	)
 	// Don't wrap sql.ErrNoRows, let the caller handle it
 	return config, err
@@ -334,7 +377,7 @@ func (c *Client) GetApplicationConfigByNameAndNamespace(ctx context.Context, nam
 // ListApplicationConfigs retrieves configurations, optionally filtered by namespace and user
 func (c *Client) ListApplicationConfigs(ctx context.Context, namespace string, userID int) ([]ApplicationConfig, error) {
 	// Build query dynamically based on filters
-	baseQuery := `SELECT id, name, namespace, user_id, config_data, created_at, updated_at FROM application_configs`
+	baseQuery := `SELECT id, name, namespace, user_id, config_data, version, bases, created_at, updated_at FROM application_configs`
 	conditions := []string{}
 	args := []interface{}{}
 	argID := 1
@@ -365,7 +408,7 @@ func (c *Client) ListApplicationConfigs(ctx context.Context, namespace string, u
 	var configs []ApplicationConfig
 	for rows.Next() {
 		var cfg ApplicationConfig
-		if err := rows.Scan(&cfg.ID, &cfg.Name, &cfg.Namespace, &cfg.UserID, &cfg.ConfigData, &cfg.CreatedAt, &cfg.UpdatedAt); err != nil {
+		if err := rows.Scan(&cfg.ID, &cfg.Name, &cfg.Namespace, &cfg.UserID, &cfg.ConfigData, &cfg.Version, &cfg.Bases, &cfg.CreatedAt, &cfg.UpdatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan application config row: %w", err)
 		}
 		configs = append(configs, cfg)
@@ -374,52 +417,70 @@ func (c *Client) ListApplicationConfigs(ctx context.Context, namespace string, u
 	return configs, rows.Err()
 }
 
-// UpdateApplicationConfig updates an existing application configuration's data
-func (c *Client) UpdateApplicationConfig(ctx context.Context, config *ApplicationConfig) error {
-	query := `
-		UPDATE application_configs
-		SET config_data = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE name = $2 AND namespace = $3 AND user_id = $4
-		RETURNING updated_at -- Optionally return updated_at if needed, otherwise check rows affected
-	`
-	result, err := c.db.ExecContext(ctx, query, config.ConfigData, config.Name, config.Namespace, config.UserID)
-	if err != nil {
-		return fmt.Errorf("failed to execute update config query: %w", err)
-	}
-
-	// Check if any row was actually updated
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected after update: %w", err)
-	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows // Return ErrNoRows if the config wasn't found for the given user/name/namespace
-	}
+// UpdateApplicationConfig replaces an existing application configuration's data, and its bases unless
+// config.Bases is nil, and records the change as a new version. The stored row, including its new version, is scanned back into config.
+// Unless expected is zero, ErrConfigVersionMismatch is returned when the stored revision differs.
+// check, if not nil, sees the config as it would be stored, with the locked row's bases filled in
+// when config.Bases is nil, and rejects the update by returning an error.
+func (c *Client) UpdateApplicationConfig(ctx context.Context, config *ApplicationConfig, expected ConfigRevision, message string, check func(candidate *ApplicationConfig) error) error {
+	return c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		var current ConfigRevision
+		var bases ConfigBases
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, version, bases FROM application_configs
+			WHERE name = $1 AND namespace = $2 AND user_id = $3
+			FOR UPDATE`, config.Name, config.Namespace, config.UserID,
+		).Scan(&current.ID, &current.Version, &bases)
+		if err != nil {
+			return err
+		}
+		if !expected.IsZero() && expected != current {
+			return ErrConfigVersionMismatch
+		}
 
-	return nil
+		if check != nil {
+			candidate := *config
+			candidate.ID, candidate.Version = current.ID, current.Version
+			if candidate.Bases == nil {
+				candidate.Bases = bases
+			}
+			if err := check(&candidate); err != nil {
+				return err
+			}
+		}
+		if err := updateConfigData(ctx, tx, config, expected); err != nil {
+			return err
+		}
+		return insertConfigVersion(ctx, tx, config, message, 0)
+	})
 }
 
-// DeleteApplicationConfig deletes a configuration by name, namespace, and user
-func (c *Client) DeleteApplicationConfig(ctx context.Context, name, namespace string, userID int) error {
+// DeleteApplicationConfig deletes a configuration by name, namespace, and user. Unless expected is
+// zero, ErrConfigVersionMismatch is returned when the stored revision differs.
+func (c *Client) DeleteApplicationConfig(ctx context.Context, name, namespace string, userID int, expected ConfigRevision) error {
 	query := `
 		DELETE FROM application_configs
-		WHERE name = $1 AND namespace = $2 AND user_id = $3
+		WHERE name = $1 AND namespace = $2 AND user_id = $3 AND ($4 = 0 OR (id = $4 AND version = $5))
 	`
-	result, err := c.db.ExecContext(ctx, query, name, namespace, userID)
-	if err != nil {
-		return fmt.Errorf("failed to execute delete config query: %w", err)
-	}
-
-	// Check if any row was actually deleted
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected after delete: %w", err)
-	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows // Return ErrNoRows if the config wasn't found
-	}
+	return c.ExecuteInTransaction(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, name, namespace, userID, expected.ID, expected.Version)
+		if err != nil {
+			return fmt.Errorf("failed to execute delete config query: %w", err)
+		}
 
-	return nil
+		// Check if any row was actually deleted
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected after delete: %w", err)
+		}
+		if rowsAffected == 0 {
+			if !expected.IsZero() {
+				return staleOrMissing(ctx, tx, name, namespace, userID)
+			}
+			return sql.ErrNoRows // Return ErrNoRows if the config wasn't found
+		}
+		return nil
+	})
 }
 
 // IsUniqueConstraintViolation checks if an error is a PostgreSQL unique violation.
@@ -0,0 +1,211 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Report statuses
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// Checker checks a single dependency
+type Checker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+type checkerFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c checkerFunc) Name() string                    { return c.name }
+func (c checkerFunc) Check(ctx context.Context) error { return c.fn(ctx) }
+
+// NewChecker adapts a function to a Checker
+func NewChecker(name string, fn func(ctx context.Context) error) Checker {
+	return checkerFunc{name: name, fn: fn}
+}
+
+// Pinger is implemented by postgres.Client
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Postgres checks a Postgres connection
+func Postgres(db Pinger) Checker {
+	return NewChecker("postgres", db.PingContext)
+}
+
+// MongoPinger is implemented by mongodb.Client
+type MongoPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Mongo checks a MongoDB connection
+func Mongo(client MongoPinger) Checker {
+	return NewChecker("mongodb", client.Ping)
+}
+
+// HTTP checks that a GET to url returns a 2xx status, e.g. an upstream's /health endpoint
+func HTTP(name, url string, client *http.Client) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return NewChecker(name, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// EndpointFor derives a service's /health URL from its base URL, dropping any path
+func EndpointFor(base string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("service URL %q is not absolute", base)
+	}
+	return u.Scheme + "://" + u.Host + "/health", nil
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the JSON body returned by the probe endpoints
+type Report struct {
+	Status    string    `json:"status"`
+	Checks    []Result  `json:"checks,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type registeredCheck struct {
+	checker  Checker
+	critical bool
+}
+
+// Registry holds the readiness checks of a service
+type Registry struct {
+	checks  []registeredCheck
+	ready   func() bool
+	timeout time.Duration
+}
+
+// NewRegistry creates a Registry. ready reports process-level readiness, such as the lifecycle
+// manager failing readiness while draining; it may be nil.
+func NewRegistry(ready func() bool, timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Registry{ready: ready, timeout: timeout}
+}
+
+// Add registers a critical check, a failure makes the service unready
+func (r *Registry) Add(checker Checker) {
+	r.checks = append(r.checks, registeredCheck{checker: checker, critical: true})
+}
+
+// AddOptional registers a check whose failure is reported as degraded without failing readiness
+func (r *Registry) AddOptional(checker Checker) {
+	r.checks = append(r.checks, registeredCheck{checker: checker, critical: false})
+}
+
+// Check runs all checks concurrently and builds a report
+func (r *Registry) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	results := make([]Result, len(r.checks))
+	var wg sync.WaitGroup
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func(i int, check registeredCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check.checker.Check(ctx)
+			result := Result{
+				Name:      check.checker.Name(),
+				Status:    StatusOK,
+				Critical:  check.critical,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results, Timestamp: time.Now().UTC()}
+	for _, result := range results {
+		if result.Status == StatusOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusUnavailable
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	if r.ready != nil && !r.ready() {
+		report.Status = StatusUnavailable
+		report.Checks = append(report.Checks, Result{Name: "lifecycle", Status: StatusUnavailable, Critical: true, Error: "server is starting or draining"})
+	}
+	return report
+}
+
+// LivenessHandler serves /livez. It only reports that the process can serve HTTP and never checks
+// dependencies, so a database outage does not cause Kubernetes to restart every pod.
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, http.StatusOK, Report{Status: StatusOK, Timestamp: time.Now().UTC()})
+	})
+}
+
+// ReadinessHandler serves /readyz with the detailed check report, 503 when a critical check fails
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Check(req.Context())
+		status := http.StatusOK
+		if report.Status == StatusUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		writeReport(w, status, report)
+	})
+}
+
+func writeReport(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,229 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Options controls the shutdown sequence
+type Options struct {
+	// ReadinessGracePeriod is how long readiness fails before servers stop accepting connections,
+	// giving Kubernetes time to remove the pod from service endpoints
+	ReadinessGracePeriod time.Duration
+	// ShutdownTimeout bounds draining in-flight requests and running closers
+	ShutdownTimeout time.Duration
+	Logger          *zap.Logger
+}
+
+// DefaultOptions returns options suited to the default 30s Kubernetes termination grace period
+func DefaultOptions(logger *zap.Logger) Options {
+	return Options{
+		ReadinessGracePeriod: 5 * time.Second,
+		ShutdownTimeout:      20 * time.Second,
+		Logger:               logger,
+	}
+}
+
+type managedServer struct {
+	name   string
+	server *http.Server
+}
+
+type closer struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager runs HTTP servers until a termination signal arrives, then shuts them down in order:
+// fail readiness, wait the grace period, drain in-flight requests, stop background work, and
+// finally run the registered closers (database clients, audit writers) in registration order.
+type Manager struct {
+	opts    Options
+	servers []managedServer
+	closers []closer
+
+	ready    atomic.Bool
+	draining atomic.Bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a Manager. Readiness stays false until Run has bound the listeners of all servers.
+func New(opts Options) *Manager {
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{opts: opts, ctx: ctx, cancel: cancel}
+}
+
+// AddServer registers a server to be started by Run. Servers with a TLSConfig are served over TLS
+// with certificates taken from the TLSConfig.
+func (m *Manager) AddServer(name string, server *http.Server) {
+	m.servers = append(m.servers, managedServer{name: name, server: server})
+}
+
+// OnShutdown registers a closer that runs after all servers have stopped
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Context is cancelled once servers have drained, for background goroutines that should stop with the process
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Ready reports whether the process should receive traffic
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
+// Draining reports whether shutdown has started
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// Run starts the servers and blocks until SIGINT or SIGTERM is received or a server fails,
+// then performs the shutdown sequence
+func (m *Manager) Run() error {
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return m.RunContext(signalCtx)
+}
+
+// RunContext is Run with an explicit trigger, shutdown starts when ctx is done. A listener that
+// cannot be bound fails it before readiness is ever reported, closers still run.
+func (m *Manager) RunContext(ctx context.Context) error {
+	logger := m.opts.Logger
+	listeners := make([]net.Listener, 0, len(m.servers))
+	for _, s := range m.servers {
+		l, err := net.Listen("tcp", listenAddr(s.server))
+		if err != nil {
+			for _, bound := range listeners {
+				bound.Close()
+			}
+			runErr := fmt.Errorf("server %s failed: %w", s.name, err)
+			logger.Error("Server could not listen, shutting down", zap.Error(runErr))
+			m.shutdown()
+			return runErr
+		}
+		listeners = append(listeners, l)
+	}
+
+	serveErrs := make(chan error, len(m.servers))
+	for i, s := range m.servers {
+		go func(s managedServer, l net.Listener) {
+			logger.Info("Starting server", zap.String("server", s.name), zap.String("addr", l.Addr().String()), zap.Bool("tls", s.server.TLSConfig != nil))
+			var err error
+			if s.server.TLSConfig != nil {
+				err = s.server.ServeTLS(l, "", "")
+			} else {
+				err = s.server.Serve(l)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErrs <- fmt.Errorf("server %s failed: %w", s.name, err)
+			}
+		}(s, listeners[i])
+	}
+	// Every listener is bound, connections queue in the backlog until Serve accepts them
+	m.ready.Store(true)
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received")
+	case runErr = <-serveErrs:
+		logger.Error("Server stopped unexpectedly, shutting down", zap.Error(runErr))
+	}
+
+	if err := m.shutdown(); err != nil && runErr == nil {
+		runErr = err
+	}
+	return runErr
+}
+
+// listenAddr is the address ListenAndServe and ListenAndServeTLS would bind for server
+func listenAddr(server *http.Server) string {
+	switch {
+	case server.Addr != "":
+		return server.Addr
+	case server.TLSConfig != nil:
+		return ":https"
+	default:
+		return ":http"
+	}
+}
+
+// shutdown fails readiness, drains servers and runs closers within ShutdownTimeout
+func (m *Manager) shutdown() error {
+	logger := m.opts.Logger
+	m.draining.Store(true)
+	wasReady := m.ready.Swap(false)
+
+	// Nothing routed traffic here if readiness never passed
+	if m.opts.ReadinessGracePeriod > 0 && wasReady {
+		logger.Info("Readiness failing, waiting before draining", zap.Duration("grace_period", m.opts.ReadinessGracePeriod))
+		time.Sleep(m.opts.ReadinessGracePeriod)
+	}
+
+	timeout := m.opts.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, s := range m.servers {
+		wg.Add(1)
+		go func(s managedServer) {
+			defer wg.Done()
+			if err := s.server.Shutdown(ctx); err != nil {
+				// Deadline reached with requests still in flight, cut the remaining connections
+				logger.Warn("Server did not drain before the deadline, closing connections", zap.String("server", s.name), zap.Error(err))
+				s.server.Close()
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("server %s: %w", s.name, err))
+				mu.Unlock()
+				return
+			}
+			logger.Info("Server drained", zap.String("server", s.name))
+		}(s)
+	}
+	wg.Wait()
+
+	// Stop background work before releasing the resources it may use
+	m.cancel()
+
+	// Closers still get a short budget when draining used up the whole deadline
+	closeCtx := ctx
+	if ctx.Err() != nil {
+		var closeCancel context.CancelFunc
+		closeCtx, closeCancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer closeCancel()
+	}
+	for _, c := range m.closers {
+		if err := c.fn(closeCtx); err != nil {
+			logger.Error("Shutdown step failed", zap.String("step", c.name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+			continue
+		}
+		logger.Info("Shutdown step completed", zap.String("step", c.name))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,103 @@
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a loopback address with no listener on it
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func accepting(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func TestReadyOnlyOnceListening(t *testing.T) {
+	addrs := []string{freeAddr(t), freeAddr(t)}
+	m := New(Options{})
+	for _, addr := range addrs {
+		m.AddServer(addr, &http.Server{Addr: addr, Handler: http.NotFoundHandler()})
+	}
+	if m.Ready() {
+		t.Fatal("ready before Run")
+	}
+
+	ctx, trigger := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- m.RunContext(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("never became ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Readiness must not run ahead of the listeners
+	for _, addr := range addrs {
+		if !accepting(addr) {
+			t.Fatalf("ready while %s refuses connections", addr)
+		}
+	}
+
+	trigger()
+	if err := <-runErr; err != nil {
+		t.Fatalf("run returned %v", err)
+	}
+}
+
+func TestRunFailsWhenAddressInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	free := freeAddr(t)
+	m := New(Options{ReadinessGracePeriod: time.Minute})
+	m.AddServer("public", &http.Server{Addr: free, Handler: http.NotFoundHandler()})
+	m.AddServer("admin", &http.Server{Addr: taken.Addr().String(), Handler: http.NotFoundHandler()})
+	closed := false
+	m.OnShutdown("postgres", func(context.Context) error {
+		closed = true
+		return nil
+	})
+
+	// Never ready, so no readiness grace period is waited out
+	start := time.Now()
+	if err := m.RunContext(context.Background()); err == nil {
+		t.Fatal("run succeeded with its address in use")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("run took %v to fail", elapsed)
+	}
+	if m.Ready() {
+		t.Fatal("ready after failing to listen")
+	}
+	if !closed {
+		t.Fatal("closers did not run")
+	}
+	if m.Context().Err() == nil {
+		t.Fatal("background context not cancelled")
+	}
+	if accepting(free) {
+		t.Fatalf("listener on %s left open", free)
+	}
+}
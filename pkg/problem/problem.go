@@ -0,0 +1,209 @@
+package problem
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/n1xreyes/multi-cloud-k8s-platform/pkg/requestid"
+)
+
+// ContentType is the media type of problem responses (RFC 7807)
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the error code to form the problem type URI
+const typeBase = "urn:multi-cloud-k8s-platform:problem:"
+
+// Code identifies a class of error independent of its message
+type Code string
+
+// Error codes shared by all services
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeValidation           Code = "validation_failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodePreconditionRequired Code = "precondition_required"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeUnsupportedMedia     Code = "unsupported_media_type"
+	CodeHeadersTooLarge      Code = "headers_too_large"
+	CodeRateLimited          Code = "rate_limited"
+	CodeInternal             Code = "internal_error"
+	CodeBadGateway           Code = "bad_gateway"
+	CodeUnavailable          Code = "service_unavailable"
+	CodeTimeout              Code = "gateway_timeout"
+)
+
+type codeInfo struct {
+	status int
+	title  string
+}
+
+var codes = map[Code]codeInfo{
+	CodeBadRequest:           {http.StatusBadRequest, "Bad Request"},
+	CodeValidation:           {http.StatusUnprocessableEntity, "Validation Failed"},
+	CodeUnauthorized:         {http.StatusUnauthorized, "Unauthorized"},
+	CodeForbidden:            {http.StatusForbidden, "Forbidden"},
+	CodeNotFound:             {http.StatusNotFound, "Not Found"},
+	CodeMethodNotAllowed:     {http.StatusMethodNotAllowed, "Method Not Allowed"},
+	CodeConflict:             {http.StatusConflict, "Conflict"},
+	CodePreconditionFailed:   {http.StatusPreconditionFailed, "Precondition Failed"},
+	CodePreconditionRequired: {http.StatusPreconditionRequired, "Precondition Required"},
+	CodePayloadTooLarge:      {http.StatusRequestEntityTooLarge, "Payload Too Large"},
+	CodeUnsupportedMedia:     {http.StatusUnsupportedMediaType, "Unsupported Media Type"},
+	CodeHeadersTooLarge:      {http.StatusRequestHeaderFieldsTooLarge, "Request Header Fields Too Large"},
+	CodeRateLimited:          {http.StatusTooManyRequests, "Too Many Requests"},
+	CodeInternal:             {http.StatusInternalServerError, "Internal Server Error"},
+	CodeBadGateway:           {http.StatusBadGateway, "Bad Gateway"},
+	CodeUnavailable:          {http.StatusServiceUnavailable, "Service Unavailable"},
+	CodeTimeout:              {http.StatusGatewayTimeout, "Gateway Timeout"},
+}
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object with the code, request ID and field errors as extension members
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	// RetryAfter sets the Retry-After header in seconds when positive
+	RetryAfter int `json:"-"`
+}
+
+// New creates a problem for the code with a human-readable detail
+func New(code Code, detail string) *Problem {
+	info, ok := codes[code]
+	if !ok {
+		code, info = CodeInternal, codes[CodeInternal]
+	}
+	return &Problem{
+		Type:   typeBase + string(code),
+		Title:  info.title,
+		Status: info.status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Newf creates a problem with a formatted detail
+func Newf(code Code, format string, args ...interface{}) *Problem {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Error implements error so problems can be returned through service layers
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// WithFields attaches field-level validation errors
+func (p *Problem) WithFields(fields ...FieldError) *Problem {
+	p.Errors = append(p.Errors, fields...)
+	return p
+}
+
+// WithRetryAfter asks the client to retry after the given number of seconds
+func (p *Problem) WithRetryAfter(seconds int) *Problem {
+	p.RetryAfter = seconds
+	return p
+}
+
+// codedError is implemented by errors that name the problem they stand for, so that the packages
+// defining them, such as the storage layer, need not be known here. ProblemCode returns one of the
+// Code values, ProblemDetail the detail about the named resource.
+type codedError interface {
+	ProblemCode() string
+	ProblemDetail(resource string) string
+}
+
+// sqlStateError is implemented by database driver errors, lib/pq's among them
+type sqlStateError interface {
+	SQLState() string
+}
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation
+const uniqueViolation = "23505"
+
+// FromError maps storage errors to problems: sql.ErrNoRows becomes not found, unique constraint
+// violations become conflicts, errors that name their own problem get it, and problems pass
+// through. Anything else is an internal error whose message is not exposed. resource names the
+// entity in the detail, e.g. "Application config".
+func FromError(err error, resource string) *Problem {
+	var p *Problem
+	var coded codedError
+	var driverErr sqlStateError
+	switch {
+	case errors.As(err, &p):
+		return p
+	case errors.Is(err, sql.ErrNoRows):
+		return New(CodeNotFound, resource+" not found")
+	case errors.As(err, &driverErr) && driverErr.SQLState() == uniqueViolation:
+		return New(CodeConflict, resource+" already exists")
+	case errors.As(err, &coded) && codes[Code(coded.ProblemCode())].status != 0:
+		return New(Code(coded.ProblemCode()), coded.ProblemDetail(resource))
+	default:
+		return New(CodeInternal, "An unexpected error occurred")
+	}
+}
+
+// Write sends the problem as application/problem+json and aborts the handler chain
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestid.Get(c)
+	}
+	if p.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+	// gin keeps an explicitly set Content-Type when rendering JSON
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Abort writes a problem for the code and detail
+func Abort(c *gin.Context, code Code, detail string) {
+	Write(c, New(code, detail))
+}
+
+// AbortError maps err with FromError and writes the result
+func AbortError(c *gin.Context, err error, resource string) {
+	Write(c, FromError(err, resource))
+}
+
+// NoRoute answers unmatched paths
+func NoRoute(c *gin.Context) {
+	Abort(c, CodeNotFound, "No route matches "+c.Request.URL.Path)
+}
+
+// NoMethod answers matched paths with an unsupported method
+func NoMethod(c *gin.Context) {
+	Abort(c, CodeMethodNotAllowed, c.Request.Method+" is not supported on "+c.Request.URL.Path)
+}
+
+// Recovery turns panics into internal error problems
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		Abort(c, CodeInternal, "An unexpected error occurred")
+	})
+}
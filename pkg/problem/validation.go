@@ -0,0 +1,110 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// RegisterJSONFieldNames makes gin's validator report fields by their JSON names. Call it once at
+// startup before any request is bound, the validator caches struct metadata on first use.
+func RegisterJSONFieldNames() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// FromBindError converts an error from ShouldBindJSON into a problem without echoing parser
+// internals: malformed bodies are bad requests, rule violations are validation failures with
+// one entry per field
+func FromBindError(err error) *Problem {
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{Field: fieldPath(fe), Message: validationMessage(fe)})
+		}
+		return New(CodeValidation, "The request body failed validation").WithFields(fields...)
+	case errors.As(err, &typeErr):
+		return New(CodeValidation, "The request body failed validation").WithFields(FieldError{
+			Field:   typeErr.Field,
+			Message: "must be of type " + jsonType(typeErr.Type),
+		})
+	case errors.As(err, &syntaxErr):
+		return Newf(CodeBadRequest, "The request body is not valid JSON (offset %d)", syntaxErr.Offset)
+	case errors.Is(err, io.EOF):
+		return New(CodeBadRequest, "The request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return New(CodeBadRequest, "The request body is truncated JSON")
+	default:
+		return New(CodeBadRequest, "The request body could not be read")
+	}
+}
+
+// fieldPath drops the top-level struct name from the validator namespace, "Req.items[0].name" -> "items[0].name"
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param()
+	case "len":
+		return "must have length " + fe.Param()
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
+
+// jsonType names a Go type the way a JSON client would see it
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,64 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carries the request ID between clients, the gateway and the services
+const Header = "X-Request-ID"
+
+// contextKey is the gin context key holding the request ID
+const contextKey = "request_id"
+
+// maxLength bounds client-supplied IDs so they cannot bloat logs and audit records
+const maxLength = 128
+
+// Middleware reuses a well-formed incoming X-Request-ID or generates a new one, stores it in the
+// context, echoes it on the response and sets it on the request so proxies forward it upstream
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !valid(id) {
+			id = generate()
+		}
+		c.Set(contextKey, id)
+		c.Request.Header.Set(Header, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// Get returns the request ID assigned by Middleware, or the incoming header when the middleware did not run
+func Get(c *gin.Context) string {
+	if id := c.GetString(contextKey); id != "" {
+		return id
+	}
+	if id := c.GetHeader(Header); valid(id) {
+		return id
+	}
+	return ""
+}
+
+// valid accepts printable ASCII without spaces
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,248 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Config contains TLS settings for a server listener
+type Config struct {
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	ClientCAFile   string        `yaml:"client_ca_file"`  // Enables client certificate verification when set
+	ClientAuth     string        `yaml:"client_auth"`     // none, request, verify-if-given or require
+	MinVersion     string        `yaml:"min_version"`     // 1.2 or 1.3
+	CipherPolicy   string        `yaml:"cipher_policy"`   // modern or intermediate, ignored for TLS 1.3
+	ReloadInterval time.Duration `yaml:"reload_interval"` // How often certificate files are checked for changes
+}
+
+// Enabled reports whether a certificate has been configured
+func (c Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// Cipher suites for TLS 1.2 connections. TLS 1.3 suites are not configurable in crypto/tls.
+var cipherPolicies = map[string][]uint16{
+	"modern": {
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	},
+	"intermediate": {
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	},
+}
+
+func parseMinVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported minimum TLS version %q", version)
+	}
+}
+
+func parseClientAuth(mode string, hasCA bool) (tls.ClientAuthType, error) {
+	switch mode {
+	case "":
+		if hasCA {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.NoClientCert, nil
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unsupported client auth mode %q", mode)
+	}
+}
+
+// Reloader keeps the serving certificate and client CA pool in sync with files on disk
+type Reloader struct {
+	config Config
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+}
+
+// NewServerConfig builds a server tls.Config whose certificate and client CAs are served from a Reloader
+func NewServerConfig(config Config, logger *zap.Logger) (*tls.Config, *Reloader, error) {
+	minVersion, err := parseMinVersion(config.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientAuth, err := parseClientAuth(config.ClientAuth, config.ClientCAFile != "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && config.ClientCAFile == "" {
+		return nil, nil, fmt.Errorf("client auth mode %q requires a client CA file", config.ClientAuth)
+	}
+
+	var cipherSuites []uint16
+	if config.CipherPolicy != "" {
+		suites, ok := cipherPolicies[config.CipherPolicy]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported cipher policy %q", config.CipherPolicy)
+		}
+		cipherSuites = suites
+	}
+
+	reloader := &Reloader{
+		config: config,
+		logger: logger,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.getCertificate,
+	}
+	tlsConfig := base.Clone()
+	// Hand out a per-handshake config so a reloaded client CA pool takes effect without a restart
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		perConn := base.Clone()
+		perConn.ClientCAs = reloader.clientCAs()
+		return perConn, nil
+	}
+	return tlsConfig, reloader, nil
+}
+
+func (r *Reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *Reloader) clientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCA
+}
+
+// reload reads the certificate, key and client CA files and swaps them in atomically
+func (r *Reloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS key pair: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading client CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.mu.Unlock()
+	return nil
+}
+
+// currentModTimes returns the current modification times of the watched files
+func (r *Reloader) currentModTimes() map[string]time.Time {
+	times := make(map[string]time.Time)
+	for _, path := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		}
+	}
+	return times
+}
+
+func changedSince(previous, current map[string]time.Time) bool {
+	for path, modTime := range current {
+		if !modTime.Equal(previous[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls the certificate files and reloads them when they change, until ctx is cancelled.
+// Polling works with Kubernetes secret volumes, which swap files through symlinks.
+func (r *Reloader) Watch(ctx context.Context) {
+	interval := r.config.ReloadInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	loaded := r.currentModTimes()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := r.currentModTimes()
+			if !changedSince(loaded, current) {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				// Keep serving the previous certificate and retry on the next tick
+				r.logger.Error("Failed to reload TLS certificates", zap.Error(err))
+				continue
+			}
+			loaded = current
+			r.logger.Info("Reloaded TLS certificates", zap.String("cert_file", r.config.CertFile))
+		}
+	}
+}
+
+// ParseSubjectMap parses "common-name:account" pairs separated by commas, as used to map
+// client certificate subjects to service accounts
+func ParseSubjectMap(value string) map[string]string {
+	accounts := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		subject, account, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || subject == "" || account == "" {
+			continue
+		}
+		accounts[subject] = account
+	}
+	return accounts
+}